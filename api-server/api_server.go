@@ -1,9 +1,11 @@
 package api_server
 
 import (
+	"bufio"
 	"bytes"
 	"cmp"
 	"context"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -15,29 +17,63 @@ import (
 	"mime/multipart"
 	"net"
 	"net/http"
+	"path/filepath"
 	"slices"
 	"squidward/backend"
 	"squidward/modules/audio"
+	"squidward/modules/sttws"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 func NewApiServer(logger *logrus.Logger, aService *backend.AdapterService) *ApiServer {
 	return &ApiServer{
-		logger:      logger,
-		apiBase:     "/v1",
-		aService:    aService,
-		audioFrames: map[string]*audio.Audio{},
+		logger:       logger,
+		apiBase:      "/v1",
+		aService:     aService,
+		audioFrames:  map[string]*audio.Audio{},
+		audioResults: map[string]*audioResult{},
 	}
 }
 
+// SetAdminToken 设置管理接口的令牌, 请求需携带 Authorization: Bearer <token>
+func (s *ApiServer) SetAdminToken(token string) *ApiServer {
+	s.adminToken = token
+	return s
+}
+
 type ApiServer struct {
 	logger      *logrus.Logger
 	apiBase     string
 	netListener net.Listener
 	aService    *backend.AdapterService
+	adminToken  string // 管理接口的令牌, 为空时禁用管理接口
+
+	audioFrames   map[string]*audio.Audio
+	audioResults  map[string]*audioResult
+	audioFramesMu sync.Mutex
+}
+
+// loadAudio 获取或创建分帧上传中的音频
+func (s *ApiServer) loadAudio(id, mime string) *audio.Audio {
+	s.audioFramesMu.Lock()
+	defer s.audioFramesMu.Unlock()
 
-	audioFrames map[string]*audio.Audio // TODO 线程安全
+	af := s.audioFrames[id]
+	if af == nil {
+		af = audio.NewAudio(mime)
+		s.audioFrames[id] = af
+	}
+	return af
+}
+
+func (s *ApiServer) removeAudio(id string) {
+	s.audioFramesMu.Lock()
+	defer s.audioFramesMu.Unlock()
+	delete(s.audioFrames, id)
 }
 
 func (s *ApiServer) Serve(netListener net.Listener) error {
@@ -79,36 +115,114 @@ func (s *ApiServer) SetupRouter() *gin.Engine {
 		}
 	})
 
+	// 记录客户端 API Key, 后端据此应用按 key 覆盖的配置
+	router.Use(func(c *gin.Context) {
+		if key := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")); key != "" {
+			c.Request = c.Request.WithContext(backend.WithAPIKey(c.Request.Context(), key))
+		}
+		c.Next()
+	})
+
 	apiRouter := router.Group(s.apiBase)
 	{
+		apiRouter.POST("/completions", s.completions)
 		apiRouter.POST("/chat/completions", s.chatCompletions)
+		apiRouter.GET("/chat/completions/ws", s.wsChatCompletions)
 		apiRouter.POST("/images/generations", s.imagesGenerations)
+		apiRouter.POST("/embeddings", s.embeddings)
 		apiRouter.POST("/audio/speech", s.audioSpeech)
 		apiRouter.GET("/audio/speech", s.audioSpeech)
 		apiRouter.POST("/audio/transcriptions", s.audioTranscriptions)
+		apiRouter.POST("/audio/translations", s.audioTranslations)
 		apiRouter.GET("/audio/transcriptions/ws", s.wsAudioTranscriptions)
+		apiRouter.POST("/audio/conversations", s.audioConversations)
+		apiRouter.GET("/audio/sessions/:audio_id", s.audioSession)
+		apiRouter.DELETE("/audio/sessions/:audio_id", s.deleteAudioSession)
+		apiRouter.GET("/realtime", s.realtime)
 		apiRouter.GET("/models", s.models)
 	}
 
+	adminRouter := router.Group(s.apiBase+"/admin", s.adminAuth)
+	{
+		adminRouter.DELETE("/audio/speech/cache", s.purgeSpeechCache)
+		adminRouter.GET("/archives/:id", s.getArchive)
+		adminRouter.GET("/archives/:id/:file", s.getArchiveFile)
+		adminRouter.DELETE("/archives/:id", s.deleteArchive)
+	}
+
 	return router
 }
 
+// adminAuth 管理接口认证, 未配置令牌时拒绝全部请求
+func (s *ApiServer) adminAuth(c *gin.Context) {
+	if s.adminToken == "" {
+		writeAPIError(c, http.StatusForbidden, "admin_disabled", "", "admin API is disabled, configure admin_token to enable it")
+		return
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+		writeAPIError(c, http.StatusUnauthorized, "invalid_api_key", "", "invalid admin token")
+		return
+	}
+	c.Next()
+}
+
 func (s *ApiServer) Stop() {
 	_ = s.netListener.Close()
 }
 
+type chatCompletionStreamDelta struct {
+	openai.ChatCompletionStreamChoiceDelta
+	// 服务端语音合成的音频, 见 chatSpeechOptions
+	Audio *chatAudioDelta `json:"audio,omitempty"`
+}
+
 type chatCompletionStreamChoice struct {
-	Index        int                                    `json:"index"`
-	Delta        openai.ChatCompletionStreamChoiceDelta `json:"delta"`
-	FinishReason openai.FinishReason                    `json:"finish_reason"`
+	Index        int                       `json:"index"`
+	Delta        chatCompletionStreamDelta `json:"delta"`
+	FinishReason openai.FinishReason       `json:"finish_reason"`
 }
 
 type chatCompletionStreamResponse struct {
 	Choices []chatCompletionStreamChoice `json:"choices"`
 }
 
+func newChatCompletionStreamResponse(res openai.ChatCompletionStreamResponse) chatCompletionStreamResponse {
+	stream := chatCompletionStreamResponse{
+		Choices: []chatCompletionStreamChoice{},
+	}
+	for _, ch := range res.Choices {
+		stream.Choices = append(stream.Choices, chatCompletionStreamChoice{
+			Index:        ch.Index,
+			Delta:        chatCompletionStreamDelta{ChatCompletionStreamChoiceDelta: ch.Delta},
+			FinishReason: ch.FinishReason,
+		})
+	}
+	return stream
+}
+
+type chatCompletionMessage struct {
+	openai.ChatCompletionMessage
+	// 服务端语音合成的音频, 请求 audio 输出模态时返回
+	Audio *chatAudioDelta `json:"audio,omitempty"`
+}
+
+// MarshalJSON 内嵌的 openai.ChatCompletionMessage 自定义了序列化, 会忽略 Audio, 需要手动合并
+func (m chatCompletionMessage) MarshalJSON() ([]byte, error) {
+	bs, err := json.Marshal(m.ChatCompletionMessage)
+	if err != nil || m.Audio == nil {
+		return bs, err
+	}
+	audioBs, err := json.Marshal(m.Audio)
+	if err != nil {
+		return nil, err
+	}
+	bs = append(bs[:len(bs)-1], `,"audio":`...)
+	return append(append(bs, audioBs...), '}'), nil
+}
+
 type chatCompletionChoice struct {
-	Message openai.ChatCompletionMessage `json:"message"`
+	Message chatCompletionMessage `json:"message"`
 }
 
 type chatCompletionResponse struct {
@@ -131,7 +245,19 @@ func (s *ApiServer) chatCompletions(c *gin.Context) {
 		return
 	}
 
-	if req.Stream {
+	speech := chatSpeechRequest{}
+	_ = c.ShouldBindBodyWithJSON(&speech)
+
+	if body, ok := c.Get(gin.BodyBytesKey); ok {
+		if err := s.transcribeChatAudio(clientContext(c), body.([]byte), &req); err != nil {
+			s.writeChatAudioError(c, err)
+			return
+		}
+	}
+
+	if opts := speech.options(); req.Stream && opts != nil {
+		s.chatCompletionsSpeech(c, bk, req, *opts)
+	} else if req.Stream {
 		c.Stream(func(w io.Writer) bool {
 			res, err := bk.ChatCompletionsStreaming(context.Background(), req)
 			if err != nil {
@@ -147,18 +273,7 @@ func (s *ApiServer) chatCompletions(c *gin.Context) {
 					return true
 				}
 
-				stream := chatCompletionStreamResponse{
-					Choices: []chatCompletionStreamChoice{},
-				}
-				for _, ch := range streamObj.Choices {
-					stream.Choices = append(stream.Choices, chatCompletionStreamChoice{
-						Index:        ch.Index,
-						Delta:        ch.Delta,
-						FinishReason: ch.FinishReason,
-					})
-				}
-
-				bs, _ := json.Marshal(stream)
+				bs, _ := json.Marshal(newChatCompletionStreamResponse(streamObj))
 
 				line := "data: " + string(bs) + "\n\n"
 				_, _ = w.Write([]byte(line))
@@ -177,9 +292,16 @@ func (s *ApiServer) chatCompletions(c *gin.Context) {
 		}
 		for _, ch := range res.Choices {
 			res1.Choices = append(res1.Choices, chatCompletionChoice{
-				Message: ch.Message,
+				Message: chatCompletionMessage{ChatCompletionMessage: ch.Message},
 			})
 		}
+		if out := speech.audioOutput(); out != nil {
+			if err = s.synthesizeChoices(clientContext(c), *out, res1.Choices); err != nil {
+				s.logger.Error(err)
+				c.Status(http.StatusInternalServerError)
+				return
+			}
+		}
 
 		c.JSON(200, res1)
 	}
@@ -222,6 +344,8 @@ func (s *ApiServer) audioSpeech(c *gin.Context) {
 	}
 
 	req := openai.CreateSpeechRequest{}
+	// 后处理选项为扩展字段
+	opts := audio.PostProcessConfig{}
 
 	asfile := false
 
@@ -230,7 +354,13 @@ func (s *ApiServer) audioSpeech(c *gin.Context) {
 			c.Status(http.StatusBadRequest)
 			return
 		}
+		if err := c.ShouldBindBodyWithJSON(&opts); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
 	} else {
+		opts = speechProcessQuery(c.Request.URL.Query())
+
 		input := strings.TrimSpace(c.Query("input"))
 		if input == "" {
 			c.Status(http.StatusBadRequest)
@@ -254,12 +384,58 @@ func (s *ApiServer) audioSpeech(c *gin.Context) {
 		req.Voice = openai.SpeechVoice(voice)
 	}
 
-	res, err := bk.AudioSpeech(context.Background(), req)
+	if err := opts.Validate(); err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !opts.IsZero() && req.ResponseFormat != openai.SpeechResponseFormatWav && req.ResponseFormat != openai.SpeechResponseFormatPcm {
+		c.String(http.StatusBadRequest, errSpeechNotTranscodable.Error())
+		return
+	}
+
+	res, err := bk.AudioSpeech(clientContext(c), req)
+	if errors.Is(err, backend.ErrSpeechFormatNotConcatenable) {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		s.logger.Error(err)
 		c.Status(http.StatusInternalServerError)
 		return
 	}
+	defer res.Close()
+
+	if id := res.Header().Get(backend.HeaderArchiveID); id != "" {
+		c.Header(backend.HeaderArchiveID, id)
+	}
+	if etag := res.Header().Get("ETag"); etag != "" {
+		etag = speechProcessETag(etag, opts)
+		c.Header("ETag", etag)
+		c.Header("X-Cache", res.Header().Get("X-Cache"))
+		if etagMatch(c.GetHeader("If-None-Match"), etag) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	body := bufio.NewReader(res)
+	if needTranscodeSpeech(body, req.ResponseFormat, opts) {
+		data, errr := io.ReadAll(body)
+		if errr != nil {
+			s.logger.Error(errr)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		out, contentType, errt := transcodeSpeech(data, res.Header().Get("Content-Type"), req.ResponseFormat, opts)
+		if errt != nil {
+			s.logger.Error(errt)
+			c.String(http.StatusBadGateway, errt.Error())
+			return
+		}
+		c.Data(http.StatusOK, contentType, out)
+		return
+	}
+
 	length := int64(0)
 	lengthStr := strings.TrimSpace(res.Header().Get("Content-Length"))
 	if lengthStr == "" && !asfile {
@@ -269,7 +445,7 @@ func (s *ApiServer) audioSpeech(c *gin.Context) {
 	}
 
 	if length > 0 || asfile {
-		alldata, _ := io.ReadAll(res)
+		alldata, _ := io.ReadAll(body)
 		reader := bytes.NewReader(alldata)
 		c.DataFromReader(http.StatusOK, int64(reader.Len()), res.Header().Get("Content-Type"), reader, nil)
 	} else {
@@ -280,7 +456,7 @@ func (s *ApiServer) audioSpeech(c *gin.Context) {
 		w.WriteHeader(http.StatusOK)
 		var buf [85000]byte
 		for {
-			n, errn := res.Read(buf[0:])
+			n, errn := body.Read(buf[0:])
 			if errn != nil {
 				if errn != io.EOF {
 					s.logger.Warnf("read error: %v", errn)
@@ -295,6 +471,29 @@ func (s *ApiServer) audioSpeech(c *gin.Context) {
 
 }
 
+// etagMatch 判断 If-None-Match 是否包含 etag
+func etagMatch(ifNoneMatch, etag string) bool {
+	for _, v := range strings.Split(ifNoneMatch, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == etag || v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// purgeSpeechCache 清除TTS缓存, 可通过 key 指定单个条目(响应的 ETag)
+func (s *ApiServer) purgeSpeechCache(c *gin.Context) {
+	bk := s.aService.GetBackend(backend.ModelTypeTTS)
+	purger, ok := bk.(backend.SpeechCachePurger)
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	key := strings.Trim(c.Query("key"), `"`)
+	c.JSON(http.StatusOK, gin.H{"purged": purger.PurgeSpeechCache(key)})
+}
+
 // audioTranscriptions STT
 func (s *ApiServer) audioTranscriptions(c *gin.Context) {
 	bk := s.aService.GetBackend(backend.ModelTypeSTT)
@@ -304,9 +503,14 @@ func (s *ApiServer) audioTranscriptions(c *gin.Context) {
 		return
 	}
 
+	limits := uploadLimits(bk)
+	limitRequestBody(c, limits)
+
 	form, err := c.MultipartForm()
 	if err != nil {
-		c.Status(http.StatusBadRequest)
+		if !writeUploadError(c, err) {
+			c.Status(http.StatusBadRequest)
+		}
 		return
 	}
 
@@ -318,51 +522,55 @@ func (s *ApiServer) audioTranscriptions(c *gin.Context) {
 	if _, has := form.Value["is_frame"]; has {
 		// 非完整音频，需要整合
 
-		if _, hasf := form.Value["audio_id"]; !hasf {
-			c.Status(http.StatusBadRequest)
-			return
-		}
-		if _, hasf := form.Value["audio_mime"]; !hasf {
-			c.Status(http.StatusBadRequest)
-			return
-		}
-
-		if mimeok := audio.CheckMimeValid(form.Value["audio_mime"][0]); !mimeok {
+		if !validFrameForm(form) {
 			c.Status(http.StatusBadRequest)
 			return
 		}
 
-		if _, hasf := form.Value["frame_index"]; !hasf {
-			c.Status(http.StatusBadRequest)
-			return
-		}
-		if _, hasf := form.Value["is_finish"]; !hasf {
-			c.Status(http.StatusBadRequest)
-			return
-		}
-		if _, errf := strconv.Atoi(form.Value["frame_index"][0]); errf != nil {
-			c.Status(http.StatusBadRequest)
-			return
+		id := form.Value["audio_id"][0]
+		var result *audioResult
+		if form.Value["is_finish"][0] == "1" {
+			first := false
+			format := openai.AudioResponseFormat(formValue(form, "response_format"))
+			if result, first = s.beginAudioResult(id, format); !first {
+				// 重试的结束帧返回同一识别结果
+				<-result.done
+				if result.err != nil {
+					c.Status(http.StatusInternalServerError)
+					return
+				}
+				writeTranscription(c, result.format, result.res, result.raw)
+				return
+			}
 		}
 
-		req, errf := s.audioTranscriptionsFrame(form)
+		req, errf := s.audioTranscriptionsFrame(form, limits)
 		if errf != nil {
-			s.logger.Error(err)
-			c.Status(http.StatusInternalServerError)
+			if result != nil {
+				s.endAudioResult(id, result, openai.AudioResponse{}, "", errf)
+			}
+			if !writeUploadError(c, errf) {
+				s.logger.Error(errf)
+				c.Status(http.StatusInternalServerError)
+			}
 			return
 		}
 
 		if req != nil {
-			if req.Language == "" {
-				req.Language = "zh"
+			res, err := bk.AudioTranscriptions(clientContext(c), *req)
+			raw := ""
+			if err == nil {
+				raw = s.correctTranscription(clientContext(c), bk, req.Format, formValue(form, "correct"), &res)
 			}
-			res, err := bk.AudioTranscriptions(context.Background(), *req)
+			s.endAudioResult(id, result, res, raw, err)
 			if err != nil {
-				s.logger.Error(err)
-				c.Status(http.StatusInternalServerError)
+				if !writeUploadError(c, err) {
+					s.logger.Error(err)
+					c.Status(http.StatusInternalServerError)
+				}
 				return
 			}
-			c.JSON(http.StatusOK, res)
+			writeTranscription(c, req.Format, res, raw)
 		} else {
 			c.Status(http.StatusOK)
 		}
@@ -370,17 +578,19 @@ func (s *ApiServer) audioTranscriptions(c *gin.Context) {
 	}
 
 	req := openai.AudioRequest{}
-	if _, hasf := form.File["model"]; hasf {
-		req.Model = form.Value["model"][0]
+	if model, has := form.Value["model"]; has {
+		req.Model = model[0]
 	}
 
 	audio := form.File["file"]
-	fs, err := audio[0].Open()
+	data, err := readUpload(c, audio[0], limits)
 	if err != nil {
-		c.Status(http.StatusBadRequest)
+		if !writeUploadError(c, err) {
+			c.Status(http.StatusBadRequest)
+		}
 		return
 	}
-	req.Reader = fs
+	req.Reader = bytes.NewReader(data)
 	req.FilePath = audio[0].Filename
 
 	if lang, has := form.Value["language"]; has {
@@ -408,19 +618,53 @@ func (s *ApiServer) audioTranscriptions(c *gin.Context) {
 		}
 	}
 
-	res, err := bk.AudioTranscriptions(context.Background(), req)
+	if formValue(form, "stream") == "true" {
+		s.audioTranscriptionsStream(c, bk, req, formValue(form, "correct"))
+		return
+	}
+
+	res, err := bk.AudioTranscriptions(clientContext(c), req)
 	if err != nil {
-		s.logger.Error(err)
-		c.Status(http.StatusInternalServerError)
+		if !writeUploadError(c, err) {
+			s.logger.Error(err)
+			c.Status(http.StatusInternalServerError)
+		}
 		return
 	}
 
+	raw := s.correctTranscription(clientContext(c), bk, req.Format, formValue(form, "correct"), &res)
+	writeTranscription(c, req.Format, res, raw)
+}
+
+// transcriptionContentTypes 纯文本识别结果的 Content-Type
+var transcriptionContentTypes = map[openai.AudioResponseFormat]string{
+	openai.AudioResponseFormatText: "text/plain; charset=utf-8",
+	openai.AudioResponseFormatSRT:  "application/x-subrip; charset=utf-8",
+	openai.AudioResponseFormatVTT:  "text/vtt; charset=utf-8",
+}
+
+// writeTranscription json 格式输出识别结果, text/srt/vtt 直接输出文本
+// 请求未指定格式时以后端实际使用的格式为准, raw 为 LLM 纠错前的原始文本, 未纠错时为空
+func writeTranscription(c *gin.Context, format openai.AudioResponseFormat, res openai.AudioResponse, raw string) {
+	format = cmp.Or(backend.ResponseFormat(res), format)
+	if id := res.Header().Get(backend.HeaderArchiveID); id != "" {
+		c.Header(backend.HeaderArchiveID, id)
+	}
+	if ct, ok := transcriptionContentTypes[format]; ok {
+		c.Data(http.StatusOK, ct, []byte(res.Text))
+		return
+	}
+	if raw != "" {
+		c.JSON(http.StatusOK, correctedTranscription{AudioResponse: res, RawText: raw})
+		return
+	}
 	c.JSON(http.StatusOK, res)
 }
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    sttws.Protocols,
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
@@ -430,6 +674,141 @@ type audioFrame struct {
 	FrameIndex int    `json:"frame_index"`
 	IsFinish   int    `json:"is_finish"`
 	Data       string `json:"data"`
+
+	// 可选, 缺省使用连接参数
+	AudioID   string `json:"audio_id,omitempty"`
+	AudioMime string `json:"audio_mime,omitempty"`
+	Language  string `json:"language,omitempty"`
+	Prompt    string `json:"prompt,omitempty"`
+}
+
+// wsConn 串行化 websocket 写操作
+type wsConn struct {
+	*websocket.Conn
+	mu sync.Mutex
+	// ctx 建立连接的请求上下文, 携带客户端 API Key
+	ctx context.Context
+}
+
+// Context 调用后端使用的上下文, 不随请求结束取消
+func (c *wsConn) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// clientContext 携带客户端信息但不随请求结束取消的上下文
+func clientContext(c *gin.Context) context.Context {
+	return context.WithoutCancel(c.Request.Context())
+}
+
+func (c *wsConn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+func (c *wsConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Conn.WriteJSON(v)
+}
+
+const defaultPartialInterval = time.Second
+
+type wsTranscriptResult struct {
+	Type    string `json:"type"`
+	AudioID string `json:"audio_id,omitempty"`
+	Text    string `json:"text"`
+}
+
+// partialTranscriber 中间结果识别, 限制频率且同一时间只有一个识别请求
+type partialTranscriber struct {
+	interval time.Duration
+	running  atomic.Bool
+
+	// finish 在识别任务的协程中调用, last 与 generation 都需持有锁
+	mu         sync.Mutex
+	last       time.Time
+	generation int // 每次最终结果后递增, 丢弃过期的中间结果
+}
+
+// start 判断是否可以发起一次中间识别
+func (p *partialTranscriber) start() (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running.Load() || time.Since(p.last) < p.interval {
+		return 0, false
+	}
+	p.last = time.Now()
+	p.running.Store(true)
+	return p.generation, true
+}
+
+// finish 输出最终结果前调用, 之后到达的中间结果将被丢弃
+func (p *partialTranscriber) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.generation++
+	p.last = time.Now()
+}
+
+// transcribePartial 异步识别已缓冲的音频, 通过 emit 推送中间结果
+func (s *ApiServer) transcribePartial(ctx context.Context, p *partialTranscriber, generation int, bk backend.Adapter, req openai.AudioRequest, emit func(text string) error) {
+	go func() {
+		defer p.running.Store(false)
+
+		res, err := bk.AudioTranscriptions(backend.WithoutArchive(ctx), req)
+		if err != nil {
+			s.logger.Warn(err)
+			return
+		}
+		if strings.TrimSpace(res.Text) == "" {
+			return
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if generation != p.generation {
+			return
+		}
+		if errw := emit(res.Text); errw != nil {
+			s.logger.Debug(errw)
+		}
+	}()
+}
+
+// emitPartial 旧协议的中间结果
+func emitPartial(conn *wsConn, audioID string) func(text string) error {
+	return func(text string) error {
+		return conn.WriteJSON(wsTranscriptResult{Type: "partial", AudioID: audioID, Text: text})
+	}
+}
+
+// parsePartialInterval 解析中间结果间隔, 未开启返回0
+func parsePartialInterval(c *gin.Context) (time.Duration, error) {
+	if v := c.Query("partial_interval"); v != "" {
+		if ms, err := strconv.Atoi(v); err == nil {
+			return time.Duration(ms) * time.Millisecond, nil
+		}
+		return time.ParseDuration(v)
+	}
+	if c.Query("partial") == "1" {
+		return defaultPartialInterval, nil
+	}
+	return 0, nil
+}
+
+// writeTranscript 推送识别结果, 开启中间结果或多路音频时使用 json 格式区分
+func writeTranscript(conn *wsConn, partial *partialTranscriber, audioID string, text string) error {
+	if partial != nil {
+		partial.finish()
+	}
+	if partial == nil && audioID == "" {
+		return conn.WriteMessage(websocket.TextMessage, []byte(text))
+	}
+	return conn.WriteJSON(wsTranscriptResult{Type: "final", AudioID: audioID, Text: text})
 }
 
 // wsAudioTranscriptions STT websocket
@@ -447,86 +826,294 @@ func (s *ApiServer) wsAudioTranscriptions(c *gin.Context) {
 	audio_mime := c.Query("audio_mime")
 	language := c.Query("language")
 	prompt := c.Query("prompt")
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+
+	var segmenter *audio.Segmenter
+	if c.Query("vad") == "1" {
+		var errs error
+		if segmenter, errs = audio.NewSegmenter(audio_mime, vadConfig(bk)); errs != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+	}
+
+	var partial *partialTranscriber
+	interval, erri := parsePartialInterval(c)
+	if erri != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	if interval > 0 {
+		partial = &partialTranscriber{interval: interval, last: time.Now()}
+	}
+
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		s.logger.Debugln(err.Error())
 		c.Status(http.StatusBadRequest)
 		return
 	}
-	defer conn.Close()
+	defer ws.Close()
+	conn := &wsConn{Conn: ws, ctx: clientContext(c)}
+
+	if version := sttws.ProtocolVersion(ws.Subprotocol()); version > 0 {
+		s.wsAudioTranscriptionsV1(conn, bk, version)
+		return
+	}
+
+	tpl := openai.AudioRequest{
+		Model:    model,
+		FilePath: file_name,
+		Language: language,
+		Prompt:   prompt,
+	}
+
+	limits := uploadLimits(bk)
+
+	if segmenter != nil {
+		upload := &streamUpload{limits: limits, mime: audio_mime}
+		s.wsAudioTranscriptionsVAD(conn, bk, segmenter, upload, partial, tpl)
+		return
+	}
+
+	// 每帧可以携带自己的音频id, 同一连接上的多段音频互不影响
+	partials := map[string]*partialTranscriber{}
+	queues := map[string]*jobQueue{}
+	// 已结束但仍有识别任务的队列, 同一音频id的下一段音频排在其后, 连接关闭前等待完成
+	draining := map[string]*jobQueue{}
+	// release 音频结束或出错后释放该音频id的帧与队列
+	release := func(id string) {
+		s.removeAudio(id)
+		delete(partials, id)
+		for key, q := range draining {
+			if q.finished() {
+				delete(draining, key)
+			}
+		}
+		if q := queues[id]; q != nil {
+			delete(queues, id)
+			q.stop()
+			draining[id] = q
+		}
+	}
+	defer func() {
+		for id := range queues {
+			release(id)
+		}
+		for _, q := range draining {
+			q.wait()
+		}
+	}()
+
 	for {
 		var data audioFrame
 		if errc := conn.ReadJSON(&data); errc != nil {
 			s.logger.Error(errc)
 			break
 		}
-		s.logger.Tracef("audio frame %s %d", audio_id, data.FrameIndex)
 
-		af := s.audioFrames[audio_id]
-		if af == nil {
-			af = audio.NewAudio(audio_mime)
-			s.audioFrames[audio_id] = af
-		}
+		id := cmp.Or(data.AudioID, audio_id)
+		s.logger.Tracef("audio frame %s %d", id, data.FrameIndex)
+
 		bdata, errb := base64.StdEncoding.DecodeString(data.Data)
 		if errb != nil {
 			break
 		}
-		af.AddFrame(data.FrameIndex, bdata)
+		af, errl := s.setAudioFrame(id, cmp.Or(data.AudioMime, audio_mime), data.FrameIndex, bdata, limits)
+		if errl != nil {
+			s.wsUploadError(conn, id, errl)
+			release(id)
+			continue
+		}
 
-		if data.IsFinish == 1 {
-			defer delete(s.audioFrames, audio_id)
-
-			req := openai.AudioRequest{
-				Model:    model,
-				Reader:   af.ToAudioBytesReader(),
-				FilePath: file_name,
-				Language: language,
-				Prompt:   prompt,
+		req := tpl
+		req.Language = cmp.Or(data.Language, language)
+		req.Prompt = cmp.Or(data.Prompt, prompt)
+
+		partial := partials[id]
+		if partial == nil && interval > 0 {
+			partial = &partialTranscriber{interval: interval, last: time.Now()}
+			partials[id] = partial
+		}
+		queue := queues[id]
+		if queue == nil {
+			queue = newJobQueue()
+			queues[id] = queue
+			if previous := draining[id]; previous != nil {
+				delete(draining, id)
+				queue.push(previous.wait)
 			}
-			s.logger.Tracef("audio %s send stt...", audio_id)
-			res, errt := bk.AudioTranscriptions(context.Background(), req)
+		}
+
+		// 携带音频id的帧使用 json 返回结果以区分音频
+		tag := data.AudioID
+
+		if data.IsFinish != 1 {
+			if partial != nil {
+				if generation, ok := partial.start(); ok {
+					if req.Reader = s.audioFrameReader(af); req.Reader != nil {
+						s.transcribePartial(conn.Context(), partial, generation, bk, req, emitPartial(conn, tag))
+					} else {
+						partial.running.Store(false)
+					}
+				}
+			}
+			continue
+		}
+
+		// 一段音频结束, 后续帧作为新的音频
+		reader := s.audioFrameReader(af)
+		if reader == nil {
+			s.logger.Errorf("audio %s: unable to assemble audio frames", id)
+			s.wsUploadError(conn, id, audio.ErrUnsupportedMime)
+			release(id)
+			continue
+		}
+		req.Reader = reader
+
+		queue.push(func() {
+			s.logger.Tracef("audio %s send stt...", id)
+			res, errt := bk.AudioTranscriptions(conn.Context(), req)
 			if errt != nil {
 				s.logger.Error(errt)
 				return
 			}
-			s.logger.Tracef("audio %s: %s", audio_id, res.Text)
-			err = conn.WriteMessage(websocket.TextMessage, []byte(res.Text))
-			if err != nil {
-				s.logger.Error(err)
-				return
+			s.logger.Tracef("audio %s: %s", id, res.Text)
+			if errw := writeTranscript(conn, partial, tag, res.Text); errw != nil {
+				s.logger.Error(errw)
+			}
+		})
+		release(id)
+	}
+}
+
+// wsAudioTranscriptionsVAD 语音端点检测模式, 每段语音结束后自动识别并推送文本, 连接保持到客户端关闭
+func (s *ApiServer) wsAudioTranscriptionsVAD(conn *wsConn, bk backend.Adapter, segmenter *audio.Segmenter, upload *streamUpload, partial *partialTranscriber, tpl openai.AudioRequest) {
+	segments := make(chan audio.Segment, 16)
+	done := make(chan struct{})
+
+	// 按顺序识别, 不阻塞音频接收
+	go func() {
+		defer close(done)
+		for seg := range segments {
+			req := tpl
+			req.Reader = bytes.NewReader(seg.PCM.EncodeWAV())
+			req.FilePath = wavFileName(tpl.FilePath)
+
+			s.logger.Tracef("audio segment %s-%s send stt...", seg.Start, seg.End)
+			res, errt := bk.AudioTranscriptions(conn.Context(), req)
+			if errt != nil {
+				s.logger.Error(errt)
+				continue
+			}
+			if strings.TrimSpace(res.Text) == "" {
+				continue
+			}
+			s.logger.Tracef("audio segment %s-%s: %s", seg.Start, seg.End, res.Text)
+			if errw := writeTranscript(conn, partial, "", res.Text); errw != nil {
+				s.logger.Error(errw)
+			}
+		}
+	}()
+
+	defer func() {
+		close(segments)
+		<-done
+	}()
+
+	for {
+		var data audioFrame
+		if errc := conn.ReadJSON(&data); errc != nil {
+			s.logger.Debug(errc)
+			return
+		}
+
+		bdata, errb := base64.StdEncoding.DecodeString(data.Data)
+		if errb != nil {
+			return
+		}
+		if errl := upload.write(bdata); errl != nil {
+			s.wsUploadError(conn, "", errl)
+			return
+		}
+
+		ss, errs := segmenter.Write(bdata)
+		if errs != nil {
+			s.logger.Error(errs)
+			return
+		}
+		for _, seg := range ss {
+			segments <- seg
+		}
+
+		if data.IsFinish == 1 {
+			if seg := segmenter.Flush(); seg != nil {
+				segments <- *seg
+			}
+			continue
+		}
+
+		// 正在说话时识别当前语音段的中间结果
+		if partial != nil && len(ss) == 0 {
+			if current := segmenter.Current(); current != nil {
+				if generation, ok := partial.start(); ok {
+					req := tpl
+					req.Reader = bytes.NewReader(current.EncodeWAV())
+					req.FilePath = wavFileName(tpl.FilePath)
+					s.transcribePartial(conn.Context(), partial, generation, bk, req, emitPartial(conn, ""))
+				}
 			}
 		}
 	}
 }
 
-func (s *ApiServer) audioTranscriptionsFrame(form *multipart.Form) (*openai.AudioRequest, error) {
+// wavFileName 替换文件扩展名为 wav
+func wavFileName(name string) string {
+	if name == "" {
+		return "audio.wav"
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".wav"
+}
+
+// validFrameForm 检查分帧上传的参数
+func validFrameForm(form *multipart.Form) bool {
+	for _, key := range []string{"audio_id", "audio_mime", "frame_index", "is_finish"} {
+		if _, has := form.Value[key]; !has {
+			return false
+		}
+	}
+	if !audio.CheckMimeValid(form.Value["audio_mime"][0]) {
+		return false
+	}
+	_, err := strconv.Atoi(form.Value["frame_index"][0])
+	return err == nil
+}
+
+func (s *ApiServer) audioTranscriptionsFrame(form *multipart.Form, limits audio.Limits) (*openai.AudioRequest, error) {
 	id := form.Value["audio_id"][0]
 	mime := form.Value["audio_mime"][0]
 	finished := form.Value["is_finish"][0] == "1"
 	index, _ := strconv.Atoi(form.Value["frame_index"][0])
 
-	af := s.audioFrames[id]
-	if af == nil {
-		af = audio.NewAudio(mime)
-		s.audioFrames[id] = af
-	}
-
 	afile := form.File["file"][0]
 	content, _ := afile.Open()
 
 	bs, _ := io.ReadAll(content)
 
-	af.AddFrame(index, bs)
+	af, err := s.setAudioFrame(id, mime, index, bs, limits)
+	if err != nil {
+		return nil, err
+	}
 
 	if finished {
-		defer delete(s.audioFrames, id)
-
 		req := openai.AudioRequest{}
 
-		if _, hasf := form.File["model"]; hasf {
-			req.Model = form.Value["model"][0]
+		if model, has := form.Value["model"]; has {
+			req.Model = model[0]
+		}
+		req.Reader = s.audioFrameReader(af)
+		if req.Reader == nil {
+			return nil, errors.New("unable to assemble audio frames")
 		}
-		req.Reader = af.ToAudioBytesReader()
 
 		req.FilePath = afile.Filename
 
@@ -652,6 +1239,23 @@ func (s *ApiServer) models(c *gin.Context) {
 		}
 	}
 
+	if bk := s.aService.GetBackend(backend.ModelTypeEmbedding); bk != nil {
+		models, err := bk.Models(context.Background())
+		if err != nil {
+			s.logger.Error(err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+
+		for _, m := range models.Models {
+			model := Model{
+				Model:       m,
+				BackendName: bk.Name(),
+			}
+			allModels = append(allModels, model)
+		}
+	}
+
 	allModels = slices.SortedFunc(slices.Values(allModels), func(m1, m2 Model) int {
 		return cmp.Compare(m1.String(), m2.String())
 	})
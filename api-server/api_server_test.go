@@ -22,9 +22,23 @@ import (
 	"squidward/modules/audio"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
+// _testAdminToken 测试用的管理接口令牌
+const _testAdminToken = "admin-token"
+
+// _adminRequest 携带管理接口令牌请求
+func _adminRequest(t *testing.T, method, url string) *http.Response {
+	req, _ := http.NewRequest(method, url, nil)
+	req.Header.Set("Authorization", "Bearer "+_testAdminToken)
+	res, err := http.DefaultClient.Do(req)
+	assert.Empty(t, err)
+	return res
+}
+
 func _initApiServer() *ApiServer {
 	logger := lib.NewLogger(6, "test", 9)
 
@@ -532,3 +546,68 @@ func TestApiServer_AudioTranscriptionsFrame(t *testing.T) {
 	}
 
 }
+
+func TestPartialTranscriber(t *testing.T) {
+	p := &partialTranscriber{interval: 50 * time.Millisecond, last: time.Now()}
+
+	_, ok := p.start()
+	assert.False(t, ok)
+
+	time.Sleep(60 * time.Millisecond)
+	generation, ok := p.start()
+	assert.True(t, ok)
+
+	// 识别中不允许重叠
+	time.Sleep(60 * time.Millisecond)
+	_, ok = p.start()
+	assert.False(t, ok)
+
+	p.running.Store(false)
+	p.finish()
+	assert.NotEqual(t, generation, p.generation)
+}
+
+// go test -race 检查 start 与识别协程中的 finish 并发
+func TestPartialTranscriber_concurrent(t *testing.T) {
+	p := &partialTranscriber{last: time.Now()}
+
+	var wg sync.WaitGroup
+	ready := make(chan struct{})
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		<-ready
+		for i := 0; i < 1000; i++ {
+			p.finish()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		<-ready
+		for i := 0; i < 1000; i++ {
+			if _, ok := p.start(); ok {
+				p.running.Store(false)
+			}
+		}
+	}()
+	close(ready)
+	wg.Wait()
+	assert.Equal(t, 1000, p.generation)
+}
+
+func TestApiServer_adminAuth(t *testing.T) {
+	mserver := NewApiServer(lib.NewLogger(6, "test", 9), &backend.AdapterService{})
+	server := httptest.NewServer(mserver.SetupRouter())
+	t.Cleanup(server.Close)
+
+	// 未配置令牌时禁用管理接口
+	res := _adminRequest(t, http.MethodDelete, server.URL+"/v1/admin/audio/speech/cache")
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	server = httptest.NewServer(mserver.SetAdminToken("another-token").SetupRouter())
+	t.Cleanup(server.Close)
+	res = _adminRequest(t, http.MethodGet, server.URL+"/v1/admin/archives/xxx")
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
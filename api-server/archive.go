@@ -0,0 +1,76 @@
+package api_server
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"squidward/backend"
+	"squidward/modules/archive"
+)
+
+// archives STT 与 TTS 后端的存档, 两者可以共用同一存储
+func (s *ApiServer) archives() []*archive.Archive {
+	var archives []*archive.Archive
+	for _, t := range []backend.ModelType{backend.ModelTypeSTT, backend.ModelTypeTTS} {
+		if ar, ok := s.aService.GetBackend(t).(backend.Archiver); ok && ar.Archive() != nil {
+			archives = append(archives, ar.Archive())
+		}
+	}
+	return archives
+}
+
+// findArchive 查找存档所在的存储
+func (s *ApiServer) findArchive(c *gin.Context, id string) (*archive.Archive, archive.Record, bool) {
+	for _, a := range s.archives() {
+		rec, err := a.Get(c.Request.Context(), id)
+		if err == nil {
+			return a, rec, true
+		}
+		if !errors.Is(err, archive.ErrNotFound) {
+			s.logger.Error(err)
+		}
+	}
+	writeAPIError(c, http.StatusNotFound, "", "id", "archive not found")
+	return nil, archive.Record{}, false
+}
+
+// getArchive 查询存档元数据
+func (s *ApiServer) getArchive(c *gin.Context) {
+	if _, rec, ok := s.findArchive(c, c.Param("id")); ok {
+		c.JSON(http.StatusOK, rec)
+	}
+}
+
+// getArchiveFile 下载存档中的文件
+func (s *ApiServer) getArchiveFile(c *gin.Context) {
+	a, _, ok := s.findArchive(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	data, err := a.ReadFile(c.Request.Context(), c.Param("id"), c.Param("file"))
+	if err != nil {
+		writeAPIError(c, http.StatusNotFound, "", "file", "archive file not found")
+		return
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(c.Param("file")))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// deleteArchive 删除存档
+func (s *ApiServer) deleteArchive(c *gin.Context) {
+	a, _, ok := s.findArchive(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if err := a.Delete(c.Request.Context(), c.Param("id")); err != nil {
+		s.logger.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "object": "archive.deleted", "deleted": true})
+}
@@ -0,0 +1,127 @@
+package api_server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"squidward/backend"
+	"squidward/lib"
+	"squidward/modules/archive"
+	"squidward/modules/audio"
+	"strings"
+	"testing"
+	"time"
+)
+
+func _archiveRecord(t *testing.T, url, id string) archive.Record {
+	rec := archive.Record{}
+	// 存档异步写入
+	assert.Eventually(t, func() bool {
+		res := _adminRequest(t, http.MethodGet, url+"/v1/admin/archives/"+id)
+		defer res.Body.Close()
+		return res.StatusCode == http.StatusOK && json.NewDecoder(res.Body).Decode(&rec) == nil
+	}, time.Second, 10*time.Millisecond)
+	return rec
+}
+
+func TestApiServer_archives(t *testing.T) {
+	sample := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/audio/speech") {
+			pcm, _ := audio.DecodeRaw(_tone(16000, 0.5), "audio/L16;rate=16000")
+			w.Header().Set("Content-Type", "audio/wav")
+			_, _ = w.Write(pcm.EncodeWAV())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, `{"text":"一加二等于几?"}`)
+	}))
+	t.Cleanup(sample.Close)
+
+	cfg := &archive.Config{Keys: []string{"sk-audit-0001"}, Retention: 90 * 24 * time.Hour, Dir: t.TempDir()}
+	aServcie := &backend.AdapterService{}
+	for _, typ := range []backend.ModelType{backend.ModelTypeSTT, backend.ModelTypeTTS} {
+		bk, err := backend.NewOpenAIStyleBackend(&backend.AdapterConfig{
+			Name:     "sample",
+			Type:     typ,
+			ApiStyle: "openai",
+			ApiBase:  sample.URL + "/v1/",
+			Archive:  cfg,
+		})
+		assert.Empty(t, err)
+		aServcie.SetBackend(bk)
+	}
+	server := httptest.NewServer(NewApiServer(lib.NewLogger(6, "test", 9), aServcie).SetAdminToken(_testAdminToken).SetupRouter())
+	t.Cleanup(server.Close)
+
+	transcribe := func(key string) *http.Response {
+		body := new(bytes.Buffer)
+		mw := multipart.NewWriter(body)
+		fw, _ := mw.CreateFormFile("file", "call.wav")
+		pcm, _ := audio.DecodeRaw(_tone(8000, 1), "audio/L16;rate=8000")
+		_, _ = fw.Write(pcm.EncodeWAV())
+		_ = mw.Close()
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/audio/transcriptions", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+key)
+		res, err := http.DefaultClient.Do(req)
+		assert.Empty(t, err)
+		_ = res.Body.Close()
+		return res
+	}
+
+	// 未开启存档的 key
+	res := transcribe("sk-other")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "", res.Header.Get(backend.HeaderArchiveID))
+
+	res = transcribe("sk-audit-0001")
+	id := res.Header.Get(backend.HeaderArchiveID)
+	assert.NotEmpty(t, id)
+	rec := _archiveRecord(t, server.URL, id)
+	assert.Equal(t, archive.KindTranscription, rec.Kind)
+	assert.Equal(t, "sk-...0001", rec.Key)
+	assert.Equal(t, "一加二等于几?", rec.Text)
+	assert.InDelta(t, 1, rec.Duration, 0.01)
+	assert.Equal(t, []string{"audio.wav", "transcript.json"}, rec.Files)
+
+	// 存档只能通过管理令牌访问
+	res, err := http.Get(server.URL + "/v1/admin/archives/" + id)
+	assert.Empty(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	res = _adminRequest(t, http.MethodGet, server.URL+"/v1/admin/archives/"+id+"/audio.wav")
+	data, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.True(t, audio.IsWAV(data))
+
+	// TTS 输入与输出
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/audio/speech",
+		strings.NewReader(`{"model":"tts-1","input":"一加二等于三。","voice":"alloy","response_format":"wav"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-audit-0001")
+	res, err = http.DefaultClient.Do(req)
+	assert.Empty(t, err)
+	_, _ = io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	speechID := res.Header.Get(backend.HeaderArchiveID)
+	rec = _archiveRecord(t, server.URL, speechID)
+	assert.Equal(t, archive.KindSpeech, rec.Kind)
+	assert.Equal(t, "一加二等于三。", rec.Text)
+	assert.InDelta(t, 0.5, rec.Duration, 0.01)
+	assert.Equal(t, []string{"input.txt", "speech.wav"}, rec.Files)
+
+	res = _adminRequest(t, http.MethodDelete, server.URL+"/v1/admin/archives/"+id)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res = _adminRequest(t, http.MethodGet, server.URL+"/v1/admin/archives/"+id)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
@@ -0,0 +1,156 @@
+package api_server
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+	"io"
+	"net/http"
+	"squidward/modules/audio"
+	"time"
+)
+
+// audioResultTTL 分帧上传结束后识别结果的保留时长, 期间重试 is_finish 直接返回该结果
+const audioResultTTL = 10 * time.Minute
+
+const (
+	audioSessionReceiving    = "receiving"
+	audioSessionTranscribing = "transcribing"
+	audioSessionFinished     = "finished"
+)
+
+// audioResult 分帧上传音频的识别结果, done 关闭前正在识别
+type audioResult struct {
+	done     chan struct{}
+	format   openai.AudioResponseFormat
+	res      openai.AudioResponse
+	raw      string
+	err      error
+	created  time.Time
+	finished time.Time
+}
+
+// audioSessionStatus 分帧上传会话状态, 客户端断线重连后据此补发缺失的帧
+type audioSessionStatus struct {
+	AudioID   string `json:"audio_id"`
+	Status    string `json:"status"`
+	AudioMime string `json:"audio_mime,omitempty"`
+	// Frames 已收到的帧序号
+	Frames []int `json:"frames"`
+	Bytes  int   `json:"bytes"`
+	// Age 会话创建至今的秒数
+	Age int64 `json:"age"`
+}
+
+// setAudioFrame 写入分帧上传的一帧, 重发的帧覆盖原数据, 超出限制时不写入
+// 已识别完成的音频id再次收到帧时视为新的音频
+func (s *ApiServer) setAudioFrame(id, mime string, index int, data []byte, limits audio.Limits) (*audio.Audio, error) {
+	af := s.loadAudio(id, mime)
+
+	s.audioFramesMu.Lock()
+	defer s.audioFramesMu.Unlock()
+	if err := checkUploadFrame(af, index, data, limits); err != nil {
+		return nil, err
+	}
+	if r, ok := s.audioResults[id]; ok && !r.finished.IsZero() {
+		delete(s.audioResults, id)
+	}
+	af.SetFrame(index, data)
+	return af, nil
+}
+
+// audioFrameReader 持锁拼接分帧上传的音频, 避免与同一音频id重发的帧并发读写, 无法拼接时返回 nil
+func (s *ApiServer) audioFrameReader(af *audio.Audio) io.Reader {
+	s.audioFramesMu.Lock()
+	defer s.audioFramesMu.Unlock()
+	return af.ToAudioBytesReader()
+}
+
+// beginAudioResult 标记音频开始识别, 已有结果或正在识别时返回该结果与 false
+func (s *ApiServer) beginAudioResult(id string, format openai.AudioResponseFormat) (*audioResult, bool) {
+	s.audioFramesMu.Lock()
+	defer s.audioFramesMu.Unlock()
+
+	if s.audioResults == nil {
+		s.audioResults = map[string]*audioResult{}
+	}
+	now := time.Now()
+	for key, r := range s.audioResults {
+		if !r.finished.IsZero() && now.Sub(r.finished) > audioResultTTL {
+			delete(s.audioResults, key)
+		}
+	}
+
+	if r, ok := s.audioResults[id]; ok {
+		return r, false
+	}
+	r := &audioResult{done: make(chan struct{}), format: format, created: now}
+	if af, ok := s.audioFrames[id]; ok {
+		r.created = af.Created
+	}
+	s.audioResults[id] = r
+	return r, true
+}
+
+// endAudioResult 保存识别结果, 识别失败时保留已收到的帧并删除结果, 以便客户端重试
+func (s *ApiServer) endAudioResult(id string, r *audioResult, res openai.AudioResponse, raw string, err error) {
+	s.audioFramesMu.Lock()
+	defer s.audioFramesMu.Unlock()
+
+	r.res, r.raw, r.err, r.finished = res, raw, err, time.Now()
+	if err != nil {
+		delete(s.audioResults, id)
+	} else {
+		delete(s.audioFrames, id)
+	}
+	close(r.done)
+}
+
+// audioSession 查询分帧上传会话状态
+func (s *ApiServer) audioSession(c *gin.Context) {
+	id := c.Param("audio_id")
+
+	s.audioFramesMu.Lock()
+	defer s.audioFramesMu.Unlock()
+
+	status := audioSessionStatus{AudioID: id, Frames: []int{}}
+	af, received := s.audioFrames[id]
+	r, finishing := s.audioResults[id]
+	switch {
+	case finishing && !r.finished.IsZero():
+		status.Status = audioSessionFinished
+		status.Age = int64(time.Since(r.created).Seconds())
+	case finishing:
+		status.Status = audioSessionTranscribing
+		status.Age = int64(time.Since(r.created).Seconds())
+	case received:
+		status.Status = audioSessionReceiving
+	default:
+		writeAPIError(c, http.StatusNotFound, "", "audio_id", "audio session not found")
+		return
+	}
+	if received {
+		status.AudioMime = af.Mime
+		status.Frames = af.Indexes()
+		status.Bytes = af.Size()
+		status.Age = int64(time.Since(af.Created).Seconds())
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// deleteAudioSession 中止分帧上传会话, 丢弃已收到的帧与识别结果
+func (s *ApiServer) deleteAudioSession(c *gin.Context) {
+	id := c.Param("audio_id")
+
+	s.audioFramesMu.Lock()
+	defer s.audioFramesMu.Unlock()
+
+	_, received := s.audioFrames[id]
+	_, finishing := s.audioResults[id]
+	if !received && !finishing {
+		writeAPIError(c, http.StatusNotFound, "", "audio_id", "audio session not found")
+		return
+	}
+	delete(s.audioFrames, id)
+	delete(s.audioResults, id)
+	c.JSON(http.StatusOK, gin.H{"id": id, "object": "audio.session.deleted", "deleted": true})
+}
@@ -0,0 +1,121 @@
+package api_server
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"squidward/modules/audio"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func _postAudioFrame(t *testing.T, url, id string, index int, finish bool, data []byte) string {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("file", "frame.pcm")
+	_, _ = fw.Write(data)
+	fields := map[string]string{
+		"is_frame":    "1",
+		"audio_id":    id,
+		"audio_mime":  "audio/L16;rate=8000",
+		"frame_index": strconv.Itoa(index),
+		"is_finish":   "0",
+	}
+	if finish {
+		fields["is_finish"] = "1"
+	}
+	for k, v := range fields {
+		_ = mw.WriteField(k, v)
+	}
+	_ = mw.Close()
+
+	res, err := http.Post(url+"/v1/audio/transcriptions", mw.FormDataContentType(), body)
+	assert.Empty(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	bs, _ := io.ReadAll(res.Body)
+	return string(bs)
+}
+
+func _audioSessionStatus(t *testing.T, url, id string) (int, audioSessionStatus) {
+	res, err := http.Get(url + "/v1/audio/sessions/" + id)
+	assert.Empty(t, err)
+	defer res.Body.Close()
+	status := audioSessionStatus{}
+	_ = json.NewDecoder(res.Body).Decode(&status)
+	return res.StatusCode, status
+}
+
+func TestApiServer_audioSession(t *testing.T) {
+	_, server, count := _initSampleSTTServer(t)
+	frame := _tone(8000, 0.1)
+
+	// 帧 1 丢失
+	_postAudioFrame(t, server.URL, "s1", 0, false, frame)
+	_postAudioFrame(t, server.URL, "s1", 2, false, frame)
+	// 重发的帧不重复计算
+	_postAudioFrame(t, server.URL, "s1", 2, false, frame)
+
+	code, status := _audioSessionStatus(t, server.URL, "s1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, audioSessionReceiving, status.Status)
+	assert.Equal(t, "audio/L16;rate=8000", status.AudioMime)
+	assert.Equal(t, []int{0, 2}, status.Frames)
+	assert.Equal(t, 2*len(frame), status.Bytes)
+
+	// 补发缺失的帧后结束
+	_postAudioFrame(t, server.URL, "s1", 1, false, frame)
+	text := _postAudioFrame(t, server.URL, "s1", 3, true, frame)
+	assert.Contains(t, text, "一加二等于几? 1")
+
+	// 重试结束帧返回同一结果, 不再请求后端
+	assert.Equal(t, text, _postAudioFrame(t, server.URL, "s1", 3, true, frame))
+	assert.Equal(t, int32(1), count.Load())
+
+	code, status = _audioSessionStatus(t, server.URL, "s1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, audioSessionFinished, status.Status)
+	assert.Empty(t, status.Frames)
+
+	// 中止上传
+	_postAudioFrame(t, server.URL, "s2", 0, false, frame)
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/v1/audio/sessions/s2", nil)
+	res, err := http.DefaultClient.Do(req)
+	assert.Empty(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	code, _ = _audioSessionStatus(t, server.URL, "s2")
+	assert.Equal(t, http.StatusNotFound, code)
+	res, err = http.DefaultClient.Do(req)
+	assert.Empty(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestApiServer_audioFrameReader(t *testing.T) {
+	// 重发的帧与拼接并发执行
+	s := &ApiServer{audioFrames: map[string]*audio.Audio{}}
+	af, err := s.setAudioFrame("a1", "audio/L16;rate=8000", 0, make([]byte, 1600), audio.Limits{})
+	assert.Empty(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_, _ = s.setAudioFrame("a1", "audio/L16;rate=8000", i%5, make([]byte, 1600), audio.Limits{})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			assert.NotNil(t, s.audioFrameReader(af))
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,393 @@
+package api_server
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"github.com/sashabaranov/go-openai"
+	"slices"
+	"squidward/backend"
+	"squidward/lib"
+	"squidward/modules/audio"
+	"squidward/modules/sttws"
+	"time"
+)
+
+// vadConfig STT 后端的端点检测参数, 后端未配置时使用默认值
+func vadConfig(bk backend.Adapter) audio.VADConfig {
+	if configurer, ok := bk.(backend.VADConfigurer); ok {
+		return configurer.VADConfig()
+	}
+	return audio.DefaultVADConfig()
+}
+
+// jobQueue 按顺序执行同一音频的识别任务, 保证结果顺序且不阻塞读取
+type jobQueue struct {
+	jobs chan func()
+	done chan struct{}
+}
+
+func newJobQueue() *jobQueue {
+	q := &jobQueue{
+		jobs: make(chan func(), 16),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(q.done)
+		for job := range q.jobs {
+			job()
+		}
+	}()
+	return q
+}
+
+func (q *jobQueue) push(job func()) {
+	q.jobs <- job
+}
+
+// stop 不再接收新任务, 已排队的任务继续执行
+func (q *jobQueue) stop() {
+	close(q.jobs)
+}
+
+// wait 等待已排队的任务完成
+func (q *jobQueue) wait() {
+	<-q.done
+}
+
+// finished 任务是否已全部完成
+func (q *jobQueue) finished() bool {
+	select {
+	case <-q.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// sttSession 结构化协议中 start 到 stop 之间的一段音频
+type sttSession struct {
+	id        string
+	tpl       openai.AudioRequest
+	audio     *audio.Audio
+	segmenter *audio.Segmenter
+	partial   *partialTranscriber
+	queue     *jobQueue
+	index     int
+	upload    *streamUpload
+}
+
+// wsAudioTranscriptionsV1 结构化流式识别协议, version 2 支持多路音频, 见 modules/sttws/PROTOCOL.md
+func (s *ApiServer) wsAudioTranscriptionsV1(conn *wsConn, bk backend.Adapter, version int) {
+	_ = conn.SetReadDeadline(time.Now().Add(sttws.PongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(sttws.PongWait))
+	})
+
+	stopPing := make(chan struct{})
+	defer close(stopPing)
+	go func() {
+		ticker := time.NewTicker(sttws.PingPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(sttws.WriteWait)); err != nil {
+					return
+				}
+			case <-stopPing:
+				return
+			}
+		}
+	}()
+
+	sessions := map[string]*sttSession{}
+	// 停止后仍在识别的音频, 连接关闭前等待完成
+	var stopped []*jobQueue
+	defer func() {
+		for _, sess := range sessions {
+			sess.queue.stop()
+			sess.queue.wait()
+		}
+		for _, q := range stopped {
+			q.wait()
+		}
+	}()
+
+	// v1 只有一段进行中的音频
+	single := ""
+	sessionID := func(id string) string {
+		if version < 2 {
+			return single
+		}
+		return id
+	}
+
+	if err := s.wsWrite(conn, sttws.ServerMessage{Type: sttws.TypeReady, Version: version}); err != nil {
+		return
+	}
+
+	for {
+		mt, data, err := conn.ReadMessage()
+		if err != nil {
+			s.logger.Debug(err)
+			return
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(sttws.PongWait))
+
+		switch mt {
+		case websocket.BinaryMessage:
+			id := ""
+			if version >= 2 {
+				if id, data, err = sttws.DecodeAudioFrame(data); err != nil {
+					s.wsError(conn, "", sttws.ErrCodeInvalidMessage, err.Error())
+					continue
+				}
+			}
+			sess := sessions[sessionID(id)]
+			if sess == nil {
+				s.wsError(conn, id, sttws.ErrCodeNotStarted, "send a start message before audio")
+				continue
+			}
+			if errw := s.sttSessionWrite(conn, bk, sess, data); errw != nil {
+				s.wsError(conn, sess.id, wsErrorCode(errw), errw.Error())
+			}
+
+		case websocket.TextMessage:
+			msg := sttws.ClientMessage{}
+			if errj := json.Unmarshal(data, &msg); errj != nil {
+				s.wsError(conn, "", sttws.ErrCodeInvalidMessage, errj.Error())
+				continue
+			}
+			if version >= 2 && (msg.Type == sttws.TypeStart || msg.Type == sttws.TypeStop) {
+				if msg.AudioID == "" || len(msg.AudioID) > 255 {
+					s.wsError(conn, "", sttws.ErrCodeInvalidMessage, "audio_id is required and must be at most 255 bytes")
+					continue
+				}
+			}
+
+			switch msg.Type {
+			case sttws.TypeStart:
+				if version < 2 && single != "" {
+					s.wsError(conn, single, sttws.ErrCodeAlreadyStarted, "send a stop message first")
+					continue
+				}
+				if sessions[msg.AudioID] != nil {
+					s.wsError(conn, msg.AudioID, sttws.ErrCodeAlreadyStarted, "audio already started")
+					continue
+				}
+				sess, code := newSTTSession(msg, uploadLimits(bk), vadConfig(bk))
+				if sess == nil {
+					s.wsError(conn, msg.AudioID, code, "unsupported mime: "+msg.Mime)
+					continue
+				}
+				sessions[sess.id] = sess
+				if version < 2 {
+					single = sess.id
+				}
+				_ = s.wsWrite(conn, sttws.ServerMessage{Type: sttws.TypeStarted, AudioID: sess.id})
+
+			case sttws.TypeStop:
+				sess := sessions[sessionID(msg.AudioID)]
+				if sess == nil {
+					s.wsError(conn, msg.AudioID, sttws.ErrCodeNotStarted, "no audio in progress")
+					continue
+				}
+				s.sttSessionStop(conn, bk, sess)
+				delete(sessions, sess.id)
+				single = ""
+				sess.queue.stop()
+				stopped = slices.DeleteFunc(append(stopped, sess.queue), (*jobQueue).finished)
+
+			default:
+				s.wsError(conn, "", sttws.ErrCodeInvalidMessage, "unknown message type: "+msg.Type)
+			}
+		}
+	}
+}
+
+func newSTTSession(msg sttws.ClientMessage, limits audio.Limits, vad audio.VADConfig) (*sttSession, string) {
+	sess := &sttSession{
+		id: msg.AudioID,
+		tpl: openai.AudioRequest{
+			Model:       msg.Model,
+			FilePath:    "audio.wav",
+			Language:    msg.Language,
+			Prompt:      msg.Prompt,
+			Temperature: msg.Temperature,
+			Format:      openai.AudioResponseFormat(msg.ResponseFormat),
+		},
+	}
+	if sess.id == "" {
+		sess.id = lib.RandomID()
+	}
+	sess.queue = newJobQueue()
+	sess.upload = &streamUpload{limits: limits, mime: msg.Mime}
+
+	if msg.VAD {
+		segmenter, err := audio.NewSegmenter(msg.Mime, vad)
+		if err != nil {
+			return nil, sttws.ErrCodeUnsupportedMime
+		}
+		sess.segmenter = segmenter
+	} else {
+		if !audio.CheckMimeValid(msg.Mime) {
+			return nil, sttws.ErrCodeUnsupportedMime
+		}
+		sess.audio = audio.NewAudio(msg.Mime)
+		sess.tpl.FilePath = "audio." + sess.audio.Ext()
+	}
+
+	if msg.PartialInterval > 0 {
+		sess.partial = &partialTranscriber{
+			interval: time.Duration(msg.PartialInterval) * time.Millisecond,
+			last:     time.Now(),
+		}
+	}
+
+	return sess, ""
+}
+
+// sttSessionWrite 接收一帧音频, VAD 模式下语音段结束后立即识别
+func (s *ApiServer) sttSessionWrite(conn *wsConn, bk backend.Adapter, sess *sttSession, data []byte) error {
+	if err := sess.upload.write(data); err != nil {
+		return err
+	}
+
+	var partialReq *openai.AudioRequest
+
+	if sess.segmenter != nil {
+		segments, err := sess.segmenter.Write(data)
+		if err != nil {
+			return err
+		}
+		for _, seg := range segments {
+			sess.queue.push(s.sttSegmentJob(conn, bk, sess, seg))
+		}
+		if current := sess.segmenter.Current(); current != nil && len(segments) == 0 {
+			req := sess.tpl
+			req.Reader = bytes.NewReader(current.EncodeWAV())
+			partialReq = &req
+		}
+	} else {
+		sess.audio.AddFrame(sess.index, data)
+		sess.index++
+		partialReq = &sess.tpl
+	}
+
+	if sess.partial != nil && partialReq != nil {
+		if generation, ok := sess.partial.start(); ok {
+			req := *partialReq
+			if req.Reader == nil {
+				req.Reader = sess.audio.ToAudioBytesReader()
+			}
+			if req.Reader == nil {
+				sess.partial.running.Store(false)
+				return nil
+			}
+			s.transcribePartial(conn.Context(), sess.partial, generation, bk, req, func(text string) error {
+				return s.wsWrite(conn, sttws.ServerMessage{Type: sttws.TypePartial, AudioID: sess.id, Text: text})
+			})
+		}
+	}
+	return nil
+}
+
+// sttSessionStop 结束音频并排队识别
+func (s *ApiServer) sttSessionStop(conn *wsConn, bk backend.Adapter, sess *sttSession) {
+	if sess.segmenter != nil {
+		if seg := sess.segmenter.Flush(); seg != nil {
+			sess.queue.push(s.sttSegmentJob(conn, bk, sess, *seg))
+		}
+		return
+	}
+
+	// 入队前拼接, 识别任务不再读取会话的帧
+	reader := sess.audio.ToAudioBytesReader()
+	duration, _ := sess.audio.Duration()
+	sess.queue.push(func() {
+		if reader == nil {
+			s.wsError(conn, sess.id, sttws.ErrCodeUnsupportedMime, "unable to assemble audio frames")
+			return
+		}
+
+		req := sess.tpl
+		req.Reader = reader
+		res, err := bk.AudioTranscriptions(conn.Context(), req)
+		if err != nil {
+			s.logger.Error(err)
+			s.wsError(conn, sess.id, sttws.ErrCodeTranscriptionFailed, err.Error())
+			return
+		}
+		s.wsFinal(conn, sess, res, 0, duration)
+	})
+}
+
+func (s *ApiServer) sttSegmentJob(conn *wsConn, bk backend.Adapter, sess *sttSession, seg audio.Segment) func() {
+	return func() {
+		req := sess.tpl
+		req.Reader = bytes.NewReader(seg.PCM.EncodeWAV())
+		res, err := bk.AudioTranscriptions(conn.Context(), req)
+		if err != nil {
+			s.logger.Error(err)
+			s.wsError(conn, sess.id, sttws.ErrCodeTranscriptionFailed, err.Error())
+			return
+		}
+		s.wsFinal(conn, sess, res, seg.Start, seg.End-seg.Start)
+	}
+}
+
+// wsFinal 推送最终结果, 片段时间加上语音段在整段音频中的偏移
+func (s *ApiServer) wsFinal(conn *wsConn, sess *sttSession, res openai.AudioResponse, offset, duration time.Duration) {
+	if sess.partial != nil {
+		sess.partial.finish()
+	}
+
+	msg := sttws.ServerMessage{
+		Type:     sttws.TypeFinal,
+		AudioID:  sess.id,
+		Text:     res.Text,
+		Language: res.Language,
+		Duration: duration.Seconds(),
+	}
+	if msg.Duration == 0 {
+		msg.Duration = res.Duration
+	}
+	for _, seg := range res.Segments {
+		msg.Segments = append(msg.Segments, sttws.Segment{
+			ID:    seg.ID,
+			Start: seg.Start + offset.Seconds(),
+			End:   seg.End + offset.Seconds(),
+			Text:  seg.Text,
+		})
+	}
+	// VAD 语音段没有返回时间戳时, 以语音段本身作为片段
+	if len(msg.Segments) == 0 && sess.segmenter != nil {
+		msg.Segments = append(msg.Segments, sttws.Segment{
+			Start: offset.Seconds(),
+			End:   (offset + duration).Seconds(),
+			Text:  res.Text,
+		})
+	}
+	_ = s.wsWrite(conn, msg)
+}
+
+func (s *ApiServer) wsError(conn *wsConn, audioID, code, message string) {
+	_ = s.wsWrite(conn, sttws.ServerMessage{
+		Type:    sttws.TypeError,
+		AudioID: audioID,
+		Code:    code,
+		Message: message,
+	})
+}
+
+func (s *ApiServer) wsWrite(conn *wsConn, msg sttws.ServerMessage) error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	_ = conn.SetWriteDeadline(time.Now().Add(sttws.WriteWait))
+	err := conn.Conn.WriteJSON(msg)
+	if err != nil {
+		s.logger.Debug(err)
+	}
+	return err
+}
@@ -0,0 +1,277 @@
+package api_server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"squidward/backend"
+	"squidward/lib"
+	"squidward/modules/audio"
+	"squidward/modules/sttws"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// _initSampleSTTServer 模拟STT后端, 返回收到的请求次数
+func _initSampleSTTServer(t *testing.T) (*ApiServer, *httptest.Server, *atomic.Int32) {
+	count := &atomic.Int32{}
+	sample := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := count.Add(1)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprintf(w, `{"task":"transcribe","language":"zh","duration":1,"text":"一加二等于几? %d"}`, n)
+	}))
+	t.Cleanup(sample.Close)
+
+	bkSTT, err := backend.NewOpenAIStyleBackend(&backend.AdapterConfig{
+		Name:     "sample",
+		Type:     backend.ModelTypeSTT,
+		ApiStyle: "openai",
+		ApiBase:  sample.URL + "/v1/",
+	})
+	assert.Empty(t, err)
+
+	aServcie := &backend.AdapterService{}
+	aServcie.SetBackend(bkSTT)
+
+	mserver := &ApiServer{
+		logger:      lib.NewLogger(6, "test", 9),
+		apiBase:     "/v1",
+		aService:    aServcie,
+		audioFrames: map[string]*audio.Audio{},
+	}
+	server := httptest.NewServer(mserver.SetupRouter())
+	t.Cleanup(server.Close)
+
+	return mserver, server, count
+}
+
+func _tone(rate int, seconds float64) []byte {
+	frames := int(float64(rate) * seconds)
+	bs := make([]byte, frames*2)
+	for i := 0; i < frames; i++ {
+		binary.LittleEndian.PutUint16(bs[i*2:], uint16(int16(8000*math.Sin(2*math.Pi*440*float64(i)/float64(rate)))))
+	}
+	return bs
+}
+
+func TestApiServer_wsAudioTranscriptionsV1(t *testing.T) {
+	_, server, count := _initSampleSTTServer(t)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/audio/transcriptions/ws"
+	client, err := sttws.Dial(context.Background(), url, nil, sttws.ProtocolV1)
+	assert.Empty(t, err)
+	defer client.Close()
+	assert.Equal(t, 1, client.Version)
+
+	res, err := client.Transcribe(sttws.ClientMessage{AudioID: "a1", Mime: "audio/L16;rate=8000"}, _tone(8000, 1))
+	assert.Empty(t, err)
+	assert.Equal(t, "a1", res.AudioID)
+	assert.Equal(t, "一加二等于几? 1", res.Text)
+	assert.InDelta(t, 1, res.Duration, 0.01)
+
+	// 错误不会断开连接
+	assert.Empty(t, client.SendAudio([]byte{0, 0}))
+	_, err = client.Recv()
+	assert.Equal(t, sttws.ErrCodeNotStarted, err.(*sttws.Error).Code)
+
+	assert.Empty(t, client.Start(sttws.ClientMessage{Mime: "audio/ogg"}))
+	_, err = client.Recv()
+	assert.Equal(t, sttws.ErrCodeUnsupportedMime, err.(*sttws.Error).Code)
+
+	// VAD 模式, 两段语音各返回一个结果
+	assert.Empty(t, client.Start(sttws.ClientMessage{AudioID: "a2", Mime: "audio/L16;rate=8000", VAD: true}))
+	silence := make([]byte, 8000*2)
+	for _, chunk := range [][]byte{silence, _tone(8000, 1), silence, _tone(8000, 0.5), silence} {
+		assert.Empty(t, client.SendAudio(chunk))
+	}
+	assert.Empty(t, client.Stop())
+
+	finals := 0
+	for finals < 2 {
+		msg, errr := client.Recv()
+		assert.Empty(t, errr)
+		if msg.Type == sttws.TypeFinal {
+			assert.Equal(t, 1, len(msg.Segments))
+			finals++
+		}
+	}
+	assert.Equal(t, int32(3), count.Load())
+}
+
+func TestApiServer_wsAudioTranscriptionsV2(t *testing.T) {
+	_, server, count := _initSampleSTTServer(t)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/audio/transcriptions/ws"
+	client, err := sttws.Dial(context.Background(), url, nil)
+	assert.Empty(t, err)
+	defer client.Close()
+	assert.Equal(t, 2, client.Version)
+
+	// 两路音频交错发送, 各自独立结束
+	assert.Empty(t, client.Start(sttws.ClientMessage{AudioID: "mic1", Mime: "audio/L16;rate=8000", Language: "zh"}))
+	assert.Empty(t, client.Start(sttws.ClientMessage{AudioID: "mic2", Mime: "audio/x-alaw-basic", Language: "en"}))
+	for i := 0; i < 5; i++ {
+		assert.Empty(t, client.SendSessionAudio("mic1", _tone(8000, 0.1)))
+		assert.Empty(t, client.SendSessionAudio("mic2", make([]byte, 800)))
+	}
+	assert.Empty(t, client.StopSession("mic2"))
+
+	results := map[string]*sttws.ServerMessage{}
+	for len(results) < 1 {
+		msg, errr := client.Recv()
+		assert.Empty(t, errr)
+		if msg.Type == sttws.TypeFinal {
+			results[msg.AudioID] = msg
+		}
+	}
+	assert.NotNil(t, results["mic2"])
+	assert.InDelta(t, 0.5, results["mic2"].Duration, 0.01)
+
+	assert.Empty(t, client.SendSessionAudio("mic1", _tone(8000, 0.5)))
+	assert.Empty(t, client.StopSession("mic1"))
+	for len(results) < 2 {
+		msg, errr := client.Recv()
+		assert.Empty(t, errr)
+		if msg.Type == sttws.TypeFinal {
+			results[msg.AudioID] = msg
+		}
+	}
+	assert.InDelta(t, 1, results["mic1"].Duration, 0.01)
+
+	// 未开始的音频
+	assert.Empty(t, client.SendSessionAudio("mic3", []byte{0, 0}))
+	msg, err := client.Recv()
+	assert.Equal(t, "mic3", msg.AudioID)
+	assert.Equal(t, sttws.ErrCodeNotStarted, err.(*sttws.Error).Code)
+
+	res, err := client.Transcribe(sttws.ClientMessage{Mime: "audio/L16;rate=8000"}, _tone(8000, 1))
+	assert.Empty(t, err)
+	assert.Equal(t, "一加二等于几? 3", res.Text)
+	assert.Equal(t, int32(3), count.Load())
+}
+
+func TestApiServer_wsAudioTranscriptionsLegacy(t *testing.T) {
+	_, server, _ := _initSampleSTTServer(t)
+
+	// 未协商子协议时使用旧格式
+	wsurl := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/audio/transcriptions/ws?audio_id=1&audio_mime=" + url.QueryEscape("audio/L16;rate=8000")
+	conn, _, err := websocket.DefaultDialer.Dial(wsurl, nil)
+	assert.Empty(t, err)
+	defer conn.Close()
+
+	err = conn.WriteJSON(audioFrame{
+		FrameIndex: 0,
+		IsFinish:   1,
+		Data:       base64.StdEncoding.EncodeToString(_tone(8000, 1)),
+	})
+	assert.Empty(t, err)
+
+	_, text, err := conn.ReadMessage()
+	assert.Empty(t, err)
+	assert.Equal(t, "一加二等于几? 1", string(text))
+}
+
+func TestApiServer_wsAudioTranscriptionsLegacyMultiplex(t *testing.T) {
+	_, server, _ := _initSampleSTTServer(t)
+
+	wsurl := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/audio/transcriptions/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(wsurl, nil)
+	assert.Empty(t, err)
+	defer conn.Close()
+
+	for _, id := range []string{"a", "b"} {
+		err = conn.WriteJSON(audioFrame{
+			AudioID:   id,
+			AudioMime: "audio/L16;rate=8000",
+			Data:      base64.StdEncoding.EncodeToString(_tone(8000, 0.2)),
+		})
+		assert.Empty(t, err)
+	}
+	for _, id := range []string{"b", "a"} {
+		err = conn.WriteJSON(audioFrame{FrameIndex: 1, IsFinish: 1, AudioID: id})
+		assert.Empty(t, err)
+	}
+
+	ids := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		res := wsTranscriptResult{}
+		assert.Empty(t, conn.ReadJSON(&res))
+		assert.Equal(t, "final", res.Type)
+		ids[res.AudioID] = true
+	}
+	assert.Equal(t, map[string]bool{"a": true, "b": true}, ids)
+}
+
+func TestApiServer_wsAudioTranscriptionsLegacyFinish(t *testing.T) {
+	mserver, server, _ := _initSampleSTTServer(t)
+
+	wsurl := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/audio/transcriptions/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(wsurl, nil)
+	assert.Empty(t, err)
+	defer conn.Close()
+
+	// 无法拼接的音频返回错误, 连接保持可用
+	assert.Empty(t, conn.WriteJSON(audioFrame{IsFinish: 1, AudioID: "a", AudioMime: "audio/mpeg"}))
+	res := wsUploadError{}
+	assert.Empty(t, conn.ReadJSON(&res))
+	assert.Equal(t, "error", res.Type)
+	assert.Equal(t, "a", res.AudioID)
+
+	// 同一音频id的多段音频按顺序返回, 结束后释放帧
+	for i := 0; i < 2; i++ {
+		for index, finish := range []int{0, 1} {
+			assert.Empty(t, conn.WriteJSON(audioFrame{
+				FrameIndex: index,
+				IsFinish:   finish,
+				AudioID:    "a",
+				AudioMime:  "audio/L16;rate=8000",
+				Data:       base64.StdEncoding.EncodeToString(_tone(8000, 0.1)),
+			}))
+		}
+	}
+	for i := 1; i <= 2; i++ {
+		res := wsTranscriptResult{}
+		assert.Empty(t, conn.ReadJSON(&res))
+		assert.Equal(t, "final", res.Type)
+		assert.Equal(t, fmt.Sprintf("一加二等于几? %d", i), res.Text)
+	}
+	mserver.audioFramesMu.Lock()
+	assert.Empty(t, mserver.audioFrames)
+	mserver.audioFramesMu.Unlock()
+}
+
+func TestVadConfig(t *testing.T) {
+	assert.Equal(t, audio.DefaultVADConfig(), vadConfig(nil))
+
+	bk, err := backend.NewOpenAIStyleBackend(&backend.AdapterConfig{
+		Name: "sample",
+		Type: backend.ModelTypeSTT,
+		VAD:  &audio.VADConfig{MinSilence: 300 * time.Millisecond},
+	})
+	assert.Empty(t, err)
+	assert.Equal(t, 300*time.Millisecond, vadConfig(bk).MinSilence)
+
+	sess, code := newSTTSession(sttws.ClientMessage{Mime: "audio/L16;rate=16000", VAD: true}, audio.Limits{}, vadConfig(bk))
+	assert.Empty(t, code)
+	assert.NotNil(t, sess.segmenter)
+	sess.queue.stop()
+}
+
+func TestNewSTTSession_filePath(t *testing.T) {
+	// 上传的文件名与拼接后的格式一致, 后端按扩展名选择解码器
+	for mime, path := range map[string]string{"audio/mpeg": "audio.mp3", "audio/L16;rate=16000": "audio.wav"} {
+		sess, code := newSTTSession(sttws.ClientMessage{Mime: mime}, audio.Limits{}, audio.DefaultVADConfig())
+		assert.Empty(t, code)
+		assert.Equal(t, path, sess.tpl.FilePath)
+		sess.queue.stop()
+	}
+}
@@ -0,0 +1,161 @@
+package api_server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+	"net/http"
+	"squidward/backend"
+	"squidward/modules/audio"
+	"strings"
+)
+
+// chatMessagePartTypeInputAudio OpenAI 聊天请求中的音频输入内容
+const chatMessagePartTypeInputAudio openai.ChatMessagePartType = "input_audio"
+
+var (
+	errChatAudioInvalid = errors.New("invalid input_audio content")
+	errChatAudioNoSTT   = errors.New("input_audio requires a stt backend")
+)
+
+// chatAudioOptions input_audio 内容的转写参数, 扩展字段
+type chatAudioOptions struct {
+	Model    string `json:"model,omitempty"`
+	Language string `json:"language,omitempty"`
+	Prompt   string `json:"prompt,omitempty"`
+	// Annotate 在转写文本前附加语言与时长
+	Annotate bool `json:"annotate,omitempty"`
+}
+
+type chatInputAudio struct {
+	Data   string `json:"data"`
+	Format string `json:"format"`
+}
+
+type chatInputAudioPart struct {
+	Type       openai.ChatMessagePartType `json:"type"`
+	InputAudio *chatInputAudio            `json:"input_audio,omitempty"`
+}
+
+// chatAudioRequest go-openai 解析消息时丢弃 input_audio 字段, 从原始请求中单独读取
+type chatAudioRequest struct {
+	Messages []struct {
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+	Transcription *chatAudioOptions `json:"input_audio_transcription,omitempty"`
+}
+
+// transcribeChatAudio 经 STT 将消息中的 input_audio 内容替换为文本
+// LLM 后端均通过 go-openai 转发, 无法携带音频, 因此音频输入一律先转写
+func (s *ApiServer) transcribeChatAudio(ctx context.Context, body []byte, req *openai.ChatCompletionRequest) error {
+	if !bytes.Contains(body, []byte(chatMessagePartTypeInputAudio)) {
+		return nil
+	}
+	raw := chatAudioRequest{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return err
+	}
+	opts := chatAudioOptions{}
+	if raw.Transcription != nil {
+		opts = *raw.Transcription
+	}
+
+	for i, msg := range raw.Messages {
+		if i >= len(req.Messages) || len(msg.Content) == 0 || msg.Content[0] != '[' {
+			continue
+		}
+		var parts []chatInputAudioPart
+		if err := json.Unmarshal(msg.Content, &parts); err != nil {
+			return fmt.Errorf("%w: %v", errChatAudioInvalid, err)
+		}
+		for j, part := range parts {
+			if part.Type != chatMessagePartTypeInputAudio || j >= len(req.Messages[i].MultiContent) {
+				continue
+			}
+			text, err := s.transcribeInputAudio(ctx, part.InputAudio, opts)
+			if err != nil {
+				return err
+			}
+			req.Messages[i].MultiContent[j] = openai.ChatMessagePart{
+				Type: openai.ChatMessagePartTypeText,
+				Text: text,
+			}
+		}
+	}
+	return nil
+}
+
+// writeChatAudioError 输出 input_audio 转写失败的错误
+func (s *ApiServer) writeChatAudioError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errChatAudioInvalid):
+		writeAPIError(c, http.StatusBadRequest, "invalid_input_audio", "messages", err.Error())
+	case writeUploadError(c, err):
+	default:
+		s.logger.Error(err)
+		c.Status(http.StatusInternalServerError)
+	}
+}
+
+func (s *ApiServer) transcribeInputAudio(ctx context.Context, input *chatInputAudio, opts chatAudioOptions) (string, error) {
+	if input == nil || input.Data == "" {
+		return "", errChatAudioInvalid
+	}
+	stt := s.aService.GetBackend(backend.ModelTypeSTT)
+	if stt == nil {
+		return "", errChatAudioNoSTT
+	}
+	data, err := base64.StdEncoding.DecodeString(input.Data)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errChatAudioInvalid, err)
+	}
+
+	filename := "audio." + strings.ToLower(strings.TrimSpace(input.Format))
+	if input.Format == "" {
+		filename = "audio.wav"
+	}
+	mime := audio.DeclaredMime("", filename)
+	if err = audio.CheckContent(data, mime); err != nil {
+		return "", err
+	}
+	if err = uploadLimits(stt).CheckFile(data, mime); err != nil {
+		return "", err
+	}
+
+	format := openai.AudioResponseFormatJSON
+	if opts.Annotate {
+		format = openai.AudioResponseFormatVerboseJSON
+	}
+	res, err := stt.AudioTranscriptions(ctx, openai.AudioRequest{
+		Model:    opts.Model,
+		Reader:   bytes.NewReader(data),
+		FilePath: filename,
+		Language: opts.Language,
+		Prompt:   opts.Prompt,
+		Format:   format,
+	})
+	if err != nil {
+		return "", err
+	}
+	if !opts.Annotate {
+		return res.Text, nil
+	}
+	return annotateTranscript(res), nil
+}
+
+// annotateTranscript 在转写文本前附加元数据, 提示 LLM 该内容来自语音
+func annotateTranscript(res openai.AudioResponse) string {
+	meta := []string{"audio transcript"}
+	if res.Language != "" {
+		meta = append(meta, "language: "+res.Language)
+	}
+	if res.Duration > 0 {
+		meta = append(meta, fmt.Sprintf("duration: %.1fs", res.Duration))
+	}
+	return "[" + strings.Join(meta, ", ") + "]\n" + res.Text
+}
@@ -0,0 +1,88 @@
+package api_server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"squidward/backend"
+	"squidward/lib"
+	"squidward/modules/audio"
+	"strings"
+	"testing"
+)
+
+func TestApiServer_chatCompletionsInputAudio(t *testing.T) {
+	forwarded := make(chan openai.ChatCompletionRequest, 1)
+	sample := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if strings.HasSuffix(r.URL.Path, "/audio/transcriptions") {
+			fmt.Fprint(w, `{"task":"transcribe","language":"zh","duration":1,"text":"一加二等于几?"}`)
+			return
+		}
+		req := openai.ChatCompletionRequest{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		forwarded <- req
+		fmt.Fprint(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":"一加二等于三。"}}]}`)
+	}))
+	t.Cleanup(sample.Close)
+
+	aServcie := &backend.AdapterService{}
+	for _, typ := range []backend.ModelType{backend.ModelTypeSTT, backend.ModelTypeLLM} {
+		bk, err := backend.NewOpenAIStyleBackend(&backend.AdapterConfig{
+			Name:     "sample",
+			Type:     typ,
+			ApiStyle: "openai",
+			ApiBase:  sample.URL + "/v1/",
+		})
+		assert.Empty(t, err)
+		aServcie.SetBackend(bk)
+	}
+	server := httptest.NewServer(NewApiServer(lib.NewLogger(6, "test", 9), aServcie).SetupRouter())
+	t.Cleanup(server.Close)
+
+	pcm, _ := audio.DecodeRaw(_tone(16000, 1), "audio/L16;rate=16000")
+	data := base64.StdEncoding.EncodeToString(pcm.EncodeWAV())
+	chat := func(body string) *http.Response {
+		res, err := http.Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+		assert.Empty(t, err)
+		_, _ = io.ReadAll(res.Body)
+		_ = res.Body.Close()
+		return res
+	}
+
+	res := chat(`{"messages":[{"role":"user","content":[{"type":"text","text":"请回答:"},` +
+		`{"type":"input_audio","input_audio":{"data":"` + data + `","format":"wav"}}]}]}`)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	req := <-forwarded
+	parts := req.Messages[0].MultiContent
+	assert.Equal(t, 2, len(parts))
+	assert.Equal(t, "请回答:", parts[0].Text)
+	assert.Equal(t, openai.ChatMessagePartTypeText, parts[1].Type)
+	assert.Equal(t, "一加二等于几?", parts[1].Text)
+
+	// 附加转写元数据
+	res = chat(`{"messages":[{"role":"user","content":[{"type":"input_audio","input_audio":{"data":"` + data + `","format":"wav"}}]}],` +
+		`"input_audio_transcription":{"annotate":true}}`)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	req = <-forwarded
+	assert.Equal(t, "[audio transcript, language: zh, duration: 1.0s]\n一加二等于几?", req.Messages[0].MultiContent[0].Text)
+
+	// 声明的格式与内容不符
+	res = chat(`{"messages":[{"role":"user","content":[{"type":"input_audio","input_audio":{"data":"` + data + `","format":"mp3"}}]}]}`)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res = chat(`{"messages":[{"role":"user","content":[{"type":"input_audio","input_audio":{"data":"!!","format":"wav"}}]}]}`)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Equal(t, 0, len(forwarded))
+}
+
+func TestAnnotateTranscript(t *testing.T) {
+	assert.Equal(t, "[audio transcript]\n你好", annotateTranscript(openai.AudioResponse{Text: "你好"}))
+	assert.Equal(t, "[audio transcript, language: en, duration: 2.5s]\nhi",
+		annotateTranscript(openai.AudioResponse{Text: "hi", Language: "en", Duration: 2.5}))
+}
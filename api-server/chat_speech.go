@@ -0,0 +1,340 @@
+package api_server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/sashabaranov/go-openai"
+	"io"
+	"net/http"
+	"slices"
+	"squidward/backend"
+	"squidward/modules/sentence"
+	"sync"
+	"time"
+)
+
+// chatSpeechMaxLength 没有句末标点时单次合成的最大字符数, 控制首段音频延迟
+const chatSpeechMaxLength = 120
+
+// chatSpeechOptions 流式聊天的服务端语音合成参数, 请求中包含 tts 字段或 audio 输出模态时开启
+type chatSpeechOptions struct {
+	Model          string  `json:"model,omitempty"`
+	Voice          string  `json:"voice,omitempty"`
+	ResponseFormat string  `json:"response_format,omitempty"`
+	Speed          float64 `json:"speed,omitempty"`
+
+	// audioID OpenAI 音频输出的 id, 同一回复的音频分段共用
+	audioID string
+}
+
+// chatAudioOutput OpenAI 的音频输出参数, 与 modalities 包含 audio 时由 TTS 后端合成
+type chatAudioOutput struct {
+	Voice  string `json:"voice"`
+	Format string `json:"format"`
+}
+
+// chatAudioOutputFormats OpenAI 音频格式对应的 TTS 格式, 未列出的格式名称相同
+var chatAudioOutputFormats = map[string]string{
+	"pcm16": string(openai.SpeechResponseFormatPcm),
+}
+
+// chatAudioTTL 音频 id 的有效期, 服务端不保存音频, 仅为兼容 OpenAI 客户端
+const chatAudioTTL = time.Hour
+
+type chatSpeechRequest struct {
+	TTS        *chatSpeechOptions `json:"tts,omitempty"`
+	Modalities []string           `json:"modalities,omitempty"`
+	Audio      *chatAudioOutput   `json:"audio,omitempty"`
+}
+
+// audioOutput 请求 audio 输出模态时转换为 TTS 参数, 每次请求生成一个音频 id
+func (r chatSpeechRequest) audioOutput() *chatSpeechOptions {
+	if r.Audio == nil || !slices.Contains(r.Modalities, "audio") {
+		return nil
+	}
+	format := r.Audio.Format
+	if f, ok := chatAudioOutputFormats[format]; ok {
+		format = f
+	}
+	bs := make([]byte, 12)
+	_, _ = rand.Read(bs)
+	return &chatSpeechOptions{
+		Voice:          r.Audio.Voice,
+		ResponseFormat: format,
+		audioID:        "audio_" + hex.EncodeToString(bs),
+	}
+}
+
+// options 流式聊天的语音合成参数, tts 扩展字段优先
+func (r chatSpeechRequest) options() *chatSpeechOptions {
+	if r.TTS != nil {
+		return r.TTS
+	}
+	return r.audioOutput()
+}
+
+// chatAudioDelta 一句回复的合成音频, 每段都是完整可播放的音频文件
+// 请求 audio 输出模态时附带 OpenAI 的 id 与 expires_at 字段
+type chatAudioDelta struct {
+	ID         string `json:"id,omitempty"`
+	Index      int    `json:"index"`
+	Transcript string `json:"transcript"`
+	Data       string `json:"data"`
+	Format     string `json:"format"`
+	ExpiresAt  int64  `json:"expires_at,omitempty"`
+}
+
+// chatCompletionsSpeech SSE 输出文本增量, 每句话结束后追加该句的音频
+func (s *ApiServer) chatCompletionsSpeech(c *gin.Context, llm backend.Adapter, req openai.ChatCompletionRequest, opts chatSpeechOptions) {
+	tts := s.aService.GetBackend(backend.ModelTypeTTS)
+	if tts == nil {
+		s.logger.Error("未配置TTS")
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	w := c.Writer
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	err := s.streamChatSpeech(c.Request.Context(), llm, tts, req, opts, func(chunk chatCompletionStreamResponse) error {
+		bs, _ := json.Marshal(chunk)
+		if _, errw := w.Write([]byte("data: " + string(bs) + "\n\n")); errw != nil {
+			return errw
+		}
+		w.Flush()
+		return nil
+	})
+	if err != nil {
+		s.logger.Error(err)
+	}
+	_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	w.Flush()
+}
+
+// wsChatCompletions websocket 流式聊天, 每条文本消息为一次聊天请求
+// 返回与 SSE 相同的 json 分块, 以 [DONE] 结束, 请求包含 tts 字段或 audio 输出模态时附带按句合成的音频
+func (s *ApiServer) wsChatCompletions(c *gin.Context) {
+	llm := s.aService.GetBackend(backend.ModelTypeLLM)
+	if llm == nil {
+		s.logger.Error("未配置LLM")
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		s.logger.Error(err)
+		return
+	}
+	defer ws.Close()
+	conn := &wsConn{Conn: ws, ctx: clientContext(c)}
+
+	for {
+		_, message, errr := conn.ReadMessage()
+		if errr != nil {
+			return
+		}
+
+		req := openai.ChatCompletionRequest{}
+		speech := chatSpeechRequest{}
+		if errj := json.Unmarshal(message, &req); errj != nil {
+			_ = conn.WriteJSON(gin.H{"error": gin.H{"message": errj.Error()}})
+			continue
+		}
+		_ = json.Unmarshal(message, &speech)
+		opts := speech.options()
+		if errt := s.transcribeChatAudio(conn.Context(), message, &req); errt != nil {
+			_ = conn.WriteJSON(gin.H{"error": gin.H{"message": errt.Error()}})
+			continue
+		}
+
+		emit := func(chunk chatCompletionStreamResponse) error {
+			return conn.WriteJSON(chunk)
+		}
+		if opts != nil {
+			tts := s.aService.GetBackend(backend.ModelTypeTTS)
+			if tts == nil {
+				_ = conn.WriteJSON(gin.H{"error": gin.H{"message": "tts is not configured"}})
+				continue
+			}
+			err = s.streamChatSpeech(c.Request.Context(), llm, tts, req, *opts, emit)
+		} else {
+			var finish *chatCompletionStreamResponse
+			if finish, err = streamChatChunks(c.Request.Context(), llm, req, emit); finish != nil {
+				_ = emit(*finish)
+			}
+		}
+		if err != nil {
+			s.logger.Error(err)
+			_ = conn.WriteJSON(gin.H{"error": gin.H{"message": err.Error()}})
+		}
+		if errw := conn.WriteMessage(websocket.TextMessage, []byte("[DONE]")); errw != nil {
+			return
+		}
+	}
+}
+
+// streamChatSpeech 流式聊天, 文本按句切分后依次合成语音, 音频与文本增量交替输出
+// 带 finish_reason 的分块在全部音频输出后发送
+func (s *ApiServer) streamChatSpeech(ctx context.Context, llm, tts backend.Adapter, req openai.ChatCompletionRequest,
+	opts chatSpeechOptions, emit func(chunk chatCompletionStreamResponse) error) error {
+	var mu sync.Mutex
+	send := func(chunk chatCompletionStreamResponse) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return emit(chunk)
+	}
+
+	sentences := make(chan string, 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		index := 0
+		for text := range sentences {
+			delta, err := s.synthesizeSentence(ctx, tts, opts, text)
+			if err != nil {
+				s.logger.Warn(err)
+				continue
+			}
+			delta.Index = index
+			index++
+			_ = send(chatCompletionStreamResponse{Choices: []chatCompletionStreamChoice{{
+				Delta: chatCompletionStreamDelta{Audio: delta},
+			}}})
+		}
+	}()
+
+	splitter := &sentence.Splitter{MaxLength: chatSpeechMaxLength}
+	finish, err := streamChatChunks(ctx, llm, req, func(chunk chatCompletionStreamResponse) error {
+		if errs := send(chunk); errs != nil {
+			return errs
+		}
+		for _, ch := range chunk.Choices {
+			if ch.Index != 0 {
+				continue
+			}
+			for _, text := range splitter.Write(ch.Delta.Content) {
+				sentences <- text
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		for _, text := range splitter.Flush() {
+			sentences <- text
+		}
+	}
+	close(sentences)
+	<-done
+
+	if finish != nil {
+		if errs := send(*finish); err == nil {
+			err = errs
+		}
+	}
+	return err
+}
+
+// streamChatChunks 逐个输出流式聊天分块, 带 finish_reason 的分块不输出而是返回, 由调用方决定发送时机
+func streamChatChunks(ctx context.Context, llm backend.Adapter, req openai.ChatCompletionRequest,
+	emit func(chunk chatCompletionStreamResponse) error) (*chatCompletionStreamResponse, error) {
+	req.Stream = true
+	stream, err := llm.ChatCompletionsStreaming(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	var finish *chatCompletionStreamResponse
+	for {
+		res, errr := stream.Recv()
+		if errors.Is(errr, io.EOF) {
+			return finish, nil
+		}
+		if errr != nil {
+			return finish, errr
+		}
+
+		chunk := newChatCompletionStreamResponse(res)
+		finished := false
+		for _, ch := range chunk.Choices {
+			finished = finished || ch.FinishReason != ""
+		}
+		if finished {
+			// 结束分块中的文本照常输出, 只保留 finish_reason
+			content := newChatCompletionStreamResponse(res)
+			hasContent := false
+			for i := range content.Choices {
+				content.Choices[i].FinishReason = ""
+				hasContent = hasContent || content.Choices[i].Delta.Content != ""
+				chunk.Choices[i].Delta = chatCompletionStreamDelta{}
+			}
+			finish = &chatCompletionStreamResponse{Choices: chunk.Choices}
+			if !hasContent {
+				continue
+			}
+			chunk = content
+		}
+		if errw := emit(chunk); errw != nil {
+			return finish, errw
+		}
+	}
+}
+
+func (s *ApiServer) synthesizeSentence(ctx context.Context, tts backend.Adapter, opts chatSpeechOptions, text string) (*chatAudioDelta, error) {
+	format := openai.SpeechResponseFormat(opts.ResponseFormat)
+	res, err := tts.AudioSpeech(ctx, openai.CreateSpeechRequest{
+		Model:          openai.SpeechModel(opts.Model),
+		Input:          text,
+		Voice:          openai.SpeechVoice(opts.Voice),
+		ResponseFormat: format,
+		Speed:          opts.Speed,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	data, err := io.ReadAll(res)
+	if err != nil {
+		return nil, err
+	}
+	delta := &chatAudioDelta{
+		ID:         opts.audioID,
+		Transcript: text,
+		Data:       base64.StdEncoding.EncodeToString(data),
+		Format:     speechContentType(res.Header(), format),
+	}
+	if opts.audioID != "" {
+		delta.ExpiresAt = time.Now().Add(chatAudioTTL).Unix()
+	}
+	return delta, nil
+}
+
+// synthesizeChoices 合成每条回复的完整音频, 长文本由 TTS 后端分段合成
+func (s *ApiServer) synthesizeChoices(ctx context.Context, opts chatSpeechOptions, choices []chatCompletionChoice) error {
+	tts := s.aService.GetBackend(backend.ModelTypeTTS)
+	if tts == nil {
+		return errors.New("tts is not configured")
+	}
+	for i := range choices {
+		msg := &choices[i].Message
+		if msg.Content == "" {
+			continue
+		}
+		delta, err := s.synthesizeSentence(ctx, tts, opts, msg.Content)
+		if err != nil {
+			return err
+		}
+		msg.Audio = delta
+	}
+	return nil
+}
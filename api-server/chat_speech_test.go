@@ -0,0 +1,154 @@
+package api_server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"squidward/modules/audio"
+	"strings"
+	"testing"
+	"time"
+)
+
+const _chatSpeechBody = `{"messages":[{"role":"user","content":"一加二等于几?"}],"stream":true,"tts":{"voice":"alloy","response_format":"wav"}}`
+
+func _assertChatSpeechChunks(t *testing.T, chunks []chatCompletionStreamResponse) {
+	if !assert.Equal(t, 4, len(chunks)) {
+		return
+	}
+	assert.Equal(t, "一加二", chunks[0].Choices[0].Delta.Content)
+	assert.Equal(t, "等于三。", chunks[1].Choices[0].Delta.Content)
+
+	// 句子结束后输出该句的音频, finish_reason 在音频之后
+	delta := chunks[2].Choices[0].Delta.Audio
+	assert.Equal(t, 0, delta.Index)
+	assert.Equal(t, "一加二等于三。", delta.Transcript)
+	assert.Equal(t, "audio/wav", delta.Format)
+	data, err := base64.StdEncoding.DecodeString(delta.Data)
+	assert.Empty(t, err)
+	assert.True(t, audio.IsWAV(data))
+
+	assert.Equal(t, "stop", string(chunks[3].Choices[0].FinishReason))
+}
+
+func TestApiServer_chatCompletionsSpeech(t *testing.T) {
+	server := _initSampleVoiceServer(t)
+
+	res, err := http.Post(server.URL+"/v1/chat/completions", "application/json", bytes.NewReader([]byte(_chatSpeechBody)))
+	assert.Empty(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	var chunks []chatCompletionStreamResponse
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimPrefix(scanner.Text(), "data: ")
+		if line == "" || line == "[DONE]" {
+			continue
+		}
+		chunk := chatCompletionStreamResponse{}
+		assert.Empty(t, json.Unmarshal([]byte(line), &chunk))
+		chunks = append(chunks, chunk)
+	}
+	_assertChatSpeechChunks(t, chunks)
+}
+
+func TestApiServer_wsChatCompletions(t *testing.T) {
+	server := _initSampleVoiceServer(t)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/chat/completions/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Empty(t, err)
+	defer conn.Close()
+
+	read := func(body string) []chatCompletionStreamResponse {
+		assert.Empty(t, conn.WriteMessage(websocket.TextMessage, []byte(body)))
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var chunks []chatCompletionStreamResponse
+		for {
+			_, message, errr := conn.ReadMessage()
+			if !assert.Empty(t, errr) || string(message) == "[DONE]" {
+				return chunks
+			}
+			chunk := chatCompletionStreamResponse{}
+			assert.Empty(t, json.Unmarshal(message, &chunk))
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	_assertChatSpeechChunks(t, read(_chatSpeechBody))
+
+	// 同一连接上的下一次请求, 不合成语音
+	chunks := read(`{"messages":[{"role":"user","content":"一加二等于几?"}]}`)
+	assert.Equal(t, 3, len(chunks))
+	assert.Equal(t, "stop", string(chunks[2].Choices[0].FinishReason))
+}
+
+func TestApiServer_chatCompletionsAudioOutput(t *testing.T) {
+	server := _initSampleVoiceServer(t)
+
+	body := `{"messages":[{"role":"user","content":"一加二等于几?"}],"modalities":["text","audio"],"audio":{"voice":"alloy","format":"wav"}}`
+	res, err := http.Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	assert.Empty(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	out := struct {
+		Choices []struct {
+			Message struct {
+				Content string         `json:"content"`
+				Audio   chatAudioDelta `json:"audio"`
+			} `json:"message"`
+		} `json:"choices"`
+	}{}
+	assert.Empty(t, json.NewDecoder(res.Body).Decode(&out))
+	msg := out.Choices[0].Message
+	assert.Equal(t, "一加二等于三。", msg.Content)
+	assert.True(t, strings.HasPrefix(msg.Audio.ID, "audio_"))
+	assert.Equal(t, "一加二等于三。", msg.Audio.Transcript)
+	assert.Greater(t, msg.Audio.ExpiresAt, time.Now().Unix())
+	data, err := base64.StdEncoding.DecodeString(msg.Audio.Data)
+	assert.Empty(t, err)
+	assert.True(t, audio.IsWAV(data))
+
+	// 流式请求按句输出音频分块, 共用同一 id
+	body = `{"messages":[{"role":"user","content":"一加二等于几?"}],"stream":true,"modalities":["text","audio"],"audio":{"voice":"alloy","format":"wav"}}`
+	res, err = http.Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	assert.Empty(t, err)
+	defer res.Body.Close()
+
+	var chunks []chatCompletionStreamResponse
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimPrefix(scanner.Text(), "data: ")
+		if line == "" || line == "[DONE]" {
+			continue
+		}
+		chunk := chatCompletionStreamResponse{}
+		assert.Empty(t, json.Unmarshal([]byte(line), &chunk))
+		chunks = append(chunks, chunk)
+	}
+	_assertChatSpeechChunks(t, chunks)
+	assert.True(t, strings.HasPrefix(chunks[2].Choices[0].Delta.Audio.ID, "audio_"))
+}
+
+func TestChatSpeechRequest_options(t *testing.T) {
+	req := chatSpeechRequest{Audio: &chatAudioOutput{Voice: "alloy", Format: "pcm16"}}
+	assert.Nil(t, req.options())
+
+	req.Modalities = []string{"text", "audio"}
+	opts := req.options()
+	assert.Equal(t, "pcm", opts.ResponseFormat)
+	assert.Equal(t, "alloy", opts.Voice)
+	assert.NotEmpty(t, opts.audioID)
+
+	// tts 扩展字段优先
+	req.TTS = &chatSpeechOptions{Voice: "echo"}
+	assert.Equal(t, "echo", req.options().Voice)
+}
@@ -0,0 +1,88 @@
+package api_server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+	"io"
+	"net/http"
+	"squidward/backend"
+)
+
+// maxCompletionLogprobs 与 OpenAI 相同, logprobs 最大为 5
+const maxCompletionLogprobs = 5
+
+// completions 旧版文本补全, 供只支持 /v1/completions 的工具与代码补全插件使用
+func (s *ApiServer) completions(c *gin.Context) {
+	bk := s.aService.GetBackend(backend.ModelTypeLLM)
+	if bk == nil {
+		s.logger.Error("未配置LLM")
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	req := openai.CompletionRequest{}
+	if err := c.ShouldBindBodyWithJSON(&req); err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	switch {
+	case req.BestOf > 0 && req.BestOf < max(req.N, 1):
+		writeAPIError(c, http.StatusBadRequest, "", "best_of", "best_of must be greater than or equal to n")
+		return
+	case req.Stream && req.BestOf > 1:
+		writeAPIError(c, http.StatusBadRequest, "", "best_of", "best_of cannot be used with stream")
+		return
+	case req.LogProbs < 0 || req.LogProbs > maxCompletionLogprobs:
+		writeAPIError(c, http.StatusBadRequest, "", "logprobs", "logprobs must be between 0 and 5")
+		return
+	}
+
+	if !req.Stream {
+		res, err := bk.Completions(clientContext(c), req)
+		if err != nil {
+			s.writeCompletionError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, res)
+		return
+	}
+
+	stream, err := bk.CompletionsStreaming(c.Request.Context(), req)
+	if err != nil {
+		s.writeCompletionError(c, err)
+		return
+	}
+	defer stream.Close()
+
+	w := c.Writer
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	for {
+		chunk, errr := stream.Recv()
+		if errr != nil {
+			if !errors.Is(errr, io.EOF) {
+				s.logger.Error(errr)
+			}
+			break
+		}
+		bs, _ := json.Marshal(chunk)
+		if _, errw := w.Write([]byte("data: " + string(bs) + "\n\n")); errw != nil {
+			return
+		}
+		w.Flush()
+	}
+	_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	w.Flush()
+}
+
+func (s *ApiServer) writeCompletionError(c *gin.Context, err error) {
+	if errors.Is(err, backend.ErrCompletionPrompt) || errors.Is(err, backend.ErrCompletionStream) {
+		writeAPIError(c, http.StatusBadRequest, "", "prompt", err.Error())
+		return
+	}
+	s.logger.Error(err)
+	c.Status(http.StatusInternalServerError)
+}
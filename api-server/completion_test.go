@@ -0,0 +1,138 @@
+package api_server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"squidward/backend"
+	"squidward/lib"
+	"strings"
+	"testing"
+)
+
+func newCompletionServer(t *testing.T, native bool) (*httptest.Server, *[]string) {
+	var paths []string
+	sample := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		req := map[string]any{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/completions") && !strings.HasSuffix(r.URL.Path, "/chat/completions"):
+			if !native {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"error":{"message":"not found","type":"invalid_request_error"}}`)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			fmt.Fprintf(w, `{"id":"cmpl-1","object":"text_completion","model":"%s","choices":[{"text":"a + b","index":0,"finish_reason":"stop"}]}`, req["model"])
+		case req["stream"] == true:
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, text := range []string{"a +", " b"} {
+				fmt.Fprintf(w, `data: {"id":"chatcmpl-1","model":"qwen2.5-coder","choices":[{"index":0,"delta":{"content":"%s"}}]}`+"\n\n", text)
+			}
+			fmt.Fprint(w, `data: {"id":"chatcmpl-1","model":"qwen2.5-coder","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		default:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			fmt.Fprint(w, `{"id":"chatcmpl-1","object":"chat.completion","model":"qwen2.5-coder",`+
+				`"choices":[{"index":0,"message":{"role":"assistant","content":"a + b"},"finish_reason":"stop"}],`+
+				`"usage":{"prompt_tokens":5,"completion_tokens":3,"total_tokens":8}}`)
+		}
+	}))
+	t.Cleanup(sample.Close)
+
+	bk, err := backend.NewOpenAIStyleBackend(&backend.AdapterConfig{
+		Name:         "sample",
+		Type:         backend.ModelTypeLLM,
+		ApiStyle:     "openai",
+		ApiBase:      sample.URL + "/v1/",
+		DefaultModel: "qwen2.5-coder",
+	})
+	assert.Empty(t, err)
+	aServcie := &backend.AdapterService{}
+	aServcie.SetBackend(bk)
+	server := httptest.NewServer(NewApiServer(lib.NewLogger(6, "test", 9), aServcie).SetupRouter())
+	t.Cleanup(server.Close)
+	return server, &paths
+}
+
+func TestApiServer_completions(t *testing.T) {
+	server, paths := newCompletionServer(t, false)
+
+	res, err := http.Post(server.URL+"/v1/completions", "application/json",
+		strings.NewReader(`{"prompt":"return ","echo":true,"max_tokens":16}`))
+	assert.Empty(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	out := openai.CompletionResponse{}
+	_ = json.NewDecoder(res.Body).Decode(&out)
+	_ = res.Body.Close()
+	// 原生接口 404 后改用聊天接口
+	assert.Equal(t, []string{"/v1/completions", "/v1/chat/completions"}, *paths)
+	assert.Equal(t, "text_completion", out.Object)
+	assert.Equal(t, "return a + b", out.Choices[0].Text)
+	assert.Equal(t, 8, out.Usage.TotalTokens)
+
+	// 流式请求不再尝试原生接口, echo 时先返回提示词
+	res, err = http.Post(server.URL+"/v1/completions", "application/json",
+		strings.NewReader(`{"prompt":"return ","echo":true,"stream":true}`))
+	assert.Empty(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "/v1/chat/completions", (*paths)[2])
+	text := ""
+	done := false
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+		chunk := openai.CompletionResponse{}
+		assert.Empty(t, json.Unmarshal([]byte(data), &chunk))
+		for _, ch := range chunk.Choices {
+			text += ch.Text
+		}
+	}
+	_ = res.Body.Close()
+	assert.True(t, done)
+	assert.Equal(t, "return a + b", text)
+
+	for body, param := range map[string]string{
+		`{"prompt":"x","n":2,"best_of":1}`:         "best_of",
+		`{"prompt":"x","stream":true,"best_of":2}`: "best_of",
+		`{"prompt":"x","logprobs":6}`:              "logprobs",
+		`{"prompt":[1,2,3]}`:                       "prompt",
+		`{"prompt":["a","b"],"stream":true}`:       "prompt",
+	} {
+		res, err = http.Post(server.URL+"/v1/completions", "application/json", strings.NewReader(body))
+		assert.Empty(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, body)
+		out := apiErrorResponse{}
+		_ = json.NewDecoder(res.Body).Decode(&out)
+		_ = res.Body.Close()
+		assert.Equal(t, param, *out.Error.Param, body)
+	}
+}
+
+func TestApiServer_completionsNative(t *testing.T) {
+	server, paths := newCompletionServer(t, true)
+
+	res, err := http.Post(server.URL+"/v1/completions", "application/json",
+		strings.NewReader(`{"prompt":"def add(a, b):\n    return ","suffix":"\n","best_of":2}`))
+	assert.Empty(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	out := openai.CompletionResponse{}
+	_ = json.NewDecoder(res.Body).Decode(&out)
+	_ = res.Body.Close()
+	assert.Equal(t, []string{"/v1/completions"}, *paths)
+	assert.Equal(t, "cmpl-1", out.ID)
+	assert.Equal(t, "qwen2.5-coder", out.Model)
+	assert.Equal(t, "a + b", out.Choices[0].Text)
+}
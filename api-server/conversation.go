@@ -0,0 +1,337 @@
+package api_server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"squidward/backend"
+	"strconv"
+	"strings"
+)
+
+// conversationEvent 流式语音对话的 SSE 事件
+type conversationEvent struct {
+	Type    string `json:"type"`
+	Text    string `json:"text,omitempty"`
+	Delta   string `json:"delta,omitempty"`
+	Format  string `json:"format,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	conversationTranscript = "transcript"
+	conversationTextDelta  = "text.delta"
+	conversationTextDone   = "text.done"
+	conversationAudioDelta = "audio.delta"
+	conversationAudioDone  = "audio.done"
+	conversationError      = "error"
+)
+
+// speechContentTypes TTS 返回格式对应的 Content-Type, 后端未返回时使用
+var speechContentTypes = map[openai.SpeechResponseFormat]string{
+	openai.SpeechResponseFormatMp3:  "audio/mpeg",
+	openai.SpeechResponseFormatOpus: "audio/ogg",
+	openai.SpeechResponseFormatAac:  "audio/aac",
+	openai.SpeechResponseFormatFlac: "audio/flac",
+	openai.SpeechResponseFormatWav:  "audio/wav",
+	openai.SpeechResponseFormatPcm:  "audio/L16;rate=24000",
+}
+
+func formValue(form *multipart.Form, key string) string {
+	if v, has := form.Value[key]; has && len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// audioConversations 语音对话, 一次请求完成 STT -> LLM -> TTS
+// 默认以 multipart 返回 transcript、text 与 audio, stream=true 时以 SSE 返回
+func (s *ApiServer) audioConversations(c *gin.Context) {
+	stt := s.aService.GetBackend(backend.ModelTypeSTT)
+	llm := s.aService.GetBackend(backend.ModelTypeLLM)
+	tts := s.aService.GetBackend(backend.ModelTypeTTS)
+	if stt == nil || llm == nil || tts == nil {
+		s.logger.Error("语音对话需要同时配置STT、LLM与TTS")
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	limits := uploadLimits(stt)
+	limitRequestBody(c, limits)
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		if !writeUploadError(c, err) {
+			c.Status(http.StatusBadRequest)
+		}
+		return
+	}
+
+	if _, hasf := form.File["file"]; !hasf {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var sttReq *openai.AudioRequest
+	if _, has := form.Value["is_frame"]; has {
+		if !validFrameForm(form) {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		if sttReq, err = s.audioTranscriptionsFrame(form, limits); err != nil {
+			if !writeUploadError(c, err) {
+				s.logger.Error(err)
+				c.Status(http.StatusInternalServerError)
+			}
+			return
+		}
+		if sttReq == nil {
+			// 等待后续分帧
+			c.Status(http.StatusOK)
+			return
+		}
+		// 语音对话不保留识别结果, 收齐后即释放分帧, 同一音频id再次上传时视为新的音频
+		defer s.removeAudio(form.Value["audio_id"][0])
+	} else {
+		data, erro := readUpload(c, form.File["file"][0], limits)
+		if erro != nil {
+			if !writeUploadError(c, erro) {
+				c.Status(http.StatusBadRequest)
+			}
+			return
+		}
+		sttReq = &openai.AudioRequest{
+			Reader:   bytes.NewReader(data),
+			FilePath: form.File["file"][0].Filename,
+			Language: formValue(form, "language"),
+			Prompt:   formValue(form, "prompt"),
+		}
+	}
+	// response_format 等参数属于 TTS, STT 固定使用 json
+	sttReq.Model = formValue(form, "stt_model")
+	sttReq.Format = openai.AudioResponseFormatJSON
+
+	chatReq := openai.ChatCompletionRequest{
+		Model: formValue(form, "model"),
+	}
+	if system := formValue(form, "system"); system != "" {
+		chatReq.Messages = append(chatReq.Messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: system,
+		})
+	}
+	if history := formValue(form, "messages"); history != "" {
+		var messages []openai.ChatCompletionMessage
+		if errj := json.Unmarshal([]byte(history), &messages); errj != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		chatReq.Messages = append(chatReq.Messages, messages...)
+	}
+	chatReq.Messages = withSystemPrompt(llm, chatReq.Messages)
+
+	speechReq := openai.CreateSpeechRequest{
+		Model:          openai.SpeechModel(formValue(form, "tts_model")),
+		Voice:          openai.SpeechVoice(formValue(form, "voice")),
+		ResponseFormat: openai.SpeechResponseFormat(formValue(form, "response_format")),
+	}
+	if speed, errs := strconv.ParseFloat(formValue(form, "speed"), 64); errs == nil {
+		speechReq.Speed = speed
+	}
+
+	transcript, err := stt.AudioTranscriptions(c.Request.Context(), *sttReq)
+	if err != nil {
+		s.logger.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	chatReq.Messages = append(chatReq.Messages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: transcript.Text,
+	})
+
+	if formValue(form, "stream") == "true" {
+		s.audioConversationsStream(c, llm, tts, transcript.Text, chatReq, speechReq)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+	_ = mw.WriteField("transcript", transcript.Text)
+
+	// 没有识别到语音时不再请求 LLM 与 TTS
+	if strings.TrimSpace(transcript.Text) != "" {
+		res, errc := llm.ChatCompletions(c.Request.Context(), chatReq)
+		if errc != nil {
+			s.logger.Error(errc)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		reply := ""
+		if len(res.Choices) > 0 {
+			reply = res.Choices[0].Message.Content
+		}
+		_ = mw.WriteField("text", reply)
+
+		if strings.TrimSpace(reply) != "" {
+			speechReq.Input = reply
+			speech, errs := tts.AudioSpeech(c.Request.Context(), speechReq)
+			if errs != nil {
+				s.logger.Error(errs)
+				c.Status(http.StatusInternalServerError)
+				return
+			}
+			data, errr := io.ReadAll(speech)
+			_ = speech.Close()
+			if errr != nil {
+				s.logger.Error(errr)
+				c.Status(http.StatusInternalServerError)
+				return
+			}
+
+			header := textproto.MIMEHeader{}
+			header.Set("Content-Disposition", `form-data; name="audio"; filename="speech.`+speechExt(speechReq.ResponseFormat)+`"`)
+			header.Set("Content-Type", speechContentType(speech.Header(), speechReq.ResponseFormat))
+			pw, _ := mw.CreatePart(header)
+			_, _ = pw.Write(data)
+		}
+	}
+	_ = mw.Close()
+
+	c.Data(http.StatusOK, mw.FormDataContentType(), buf.Bytes())
+}
+
+// withSystemPrompt 未包含 system 消息时插入 LLM 后端配置的语音对话默认系统提示词
+func withSystemPrompt(llm backend.Adapter, messages []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	prompter, ok := llm.(backend.SystemPrompter)
+	if !ok || prompter.SystemPrompt() == "" {
+		return messages
+	}
+	for _, msg := range messages {
+		if msg.Role == openai.ChatMessageRoleSystem {
+			return messages
+		}
+	}
+	return append([]openai.ChatCompletionMessage{{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: prompter.SystemPrompt(),
+	}}, messages...)
+}
+
+// audioConversationsStream 以 SSE 依次推送识别文本、回复文本增量与音频分块
+func (s *ApiServer) audioConversationsStream(c *gin.Context, llm, tts backend.Adapter, transcript string,
+	chatReq openai.ChatCompletionRequest, speechReq openai.CreateSpeechRequest) {
+	ctx := c.Request.Context()
+
+	w := c.Writer
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(evt conversationEvent) {
+		bs, _ := json.Marshal(evt)
+		_, _ = w.Write([]byte("data: " + string(bs) + "\n\n"))
+		w.Flush()
+	}
+	defer func() {
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+		w.Flush()
+	}()
+
+	send(conversationEvent{Type: conversationTranscript, Text: transcript})
+	if strings.TrimSpace(transcript) == "" {
+		return
+	}
+
+	reply, err := streamChatText(ctx, llm, chatReq, func(delta string) {
+		send(conversationEvent{Type: conversationTextDelta, Delta: delta})
+	})
+	if err != nil {
+		s.logger.Error(err)
+		send(conversationEvent{Type: conversationError, Message: err.Error()})
+		return
+	}
+	send(conversationEvent{Type: conversationTextDone, Text: reply})
+	if strings.TrimSpace(reply) == "" {
+		return
+	}
+
+	speechReq.Input = reply
+	speech, err := tts.AudioSpeech(ctx, speechReq)
+	if err != nil {
+		s.logger.Error(err)
+		send(conversationEvent{Type: conversationError, Message: err.Error()})
+		return
+	}
+	defer speech.Close()
+
+	format := speechContentType(speech.Header(), speechReq.ResponseFormat)
+	var buf [32 * 1024]byte
+	for {
+		n, errr := speech.Read(buf[:])
+		if n > 0 {
+			send(conversationEvent{Type: conversationAudioDelta, Format: format, Delta: base64.StdEncoding.EncodeToString(buf[:n])})
+		}
+		if errr != nil {
+			if !errors.Is(errr, io.EOF) {
+				s.logger.Warnf("read error: %v", errr)
+				send(conversationEvent{Type: conversationError, Message: errr.Error()})
+				return
+			}
+			break
+		}
+	}
+	send(conversationEvent{Type: conversationAudioDone, Format: format})
+}
+
+// streamChatText 流式请求 LLM, 逐段回调文本增量, 返回完整文本
+func streamChatText(ctx context.Context, llm backend.Adapter, req openai.ChatCompletionRequest, emit func(delta string)) (string, error) {
+	req.Stream = true
+	stream, err := llm.ChatCompletionsStreaming(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	text := ""
+	for {
+		res, errr := stream.Recv()
+		if errors.Is(errr, io.EOF) {
+			return text, nil
+		}
+		if errr != nil {
+			return text, errr
+		}
+		for _, ch := range res.Choices {
+			if ch.Delta.Content != "" {
+				text += ch.Delta.Content
+				emit(ch.Delta.Content)
+			}
+		}
+	}
+}
+
+func speechContentType(header http.Header, format openai.SpeechResponseFormat) string {
+	if ct := header.Get("Content-Type"); ct != "" {
+		return ct
+	}
+	if ct, ok := speechContentTypes[format]; ok {
+		return ct
+	}
+	return speechContentTypes[openai.SpeechResponseFormatMp3]
+}
+
+func speechExt(format openai.SpeechResponseFormat) string {
+	if format == "" {
+		return string(openai.SpeechResponseFormatMp3)
+	}
+	return string(format)
+}
@@ -0,0 +1,147 @@
+package api_server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"squidward/backend"
+	"squidward/modules/audio"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func _conversationRequest(t *testing.T, url string, fields map[string]string) *http.Response {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("file", "audio.wav")
+	pcm, _ := audio.DecodeRaw(_tone(16000, 1), "audio/L16;rate=16000")
+	_, _ = fw.Write(pcm.EncodeWAV())
+	for k, v := range fields {
+		_ = mw.WriteField(k, v)
+	}
+	_ = mw.Close()
+
+	res, err := http.Post(url, mw.FormDataContentType(), body)
+	assert.Empty(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	return res
+}
+
+func TestApiServer_audioConversations(t *testing.T) {
+	server := _initSampleVoiceServer(t)
+	url := server.URL + "/v1/audio/conversations"
+
+	res := _conversationRequest(t, url, map[string]string{"system": "你是计算器", "response_format": "wav"})
+	defer res.Body.Close()
+
+	mediaType, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	assert.Empty(t, err)
+	assert.Equal(t, "multipart/form-data", mediaType)
+
+	parts := map[string][]byte{}
+	mr := multipart.NewReader(res.Body, params["boundary"])
+	for {
+		part, errp := mr.NextPart()
+		if errp != nil {
+			break
+		}
+		parts[part.FormName()], _ = io.ReadAll(part)
+		if part.FormName() == "audio" {
+			assert.Equal(t, "audio/wav", part.Header.Get("Content-Type"))
+			assert.Equal(t, "speech.wav", part.FileName())
+		}
+	}
+	assert.Equal(t, "一加二等于几?", string(parts["transcript"]))
+	assert.Equal(t, "一加二等于三。", string(parts["text"]))
+	assert.True(t, audio.IsWAV(parts["audio"]))
+}
+
+func TestApiServer_audioConversationsStream(t *testing.T) {
+	server := _initSampleVoiceServer(t)
+	url := server.URL + "/v1/audio/conversations"
+
+	res := _conversationRequest(t, url, map[string]string{"stream": "true", "response_format": "wav"})
+	defer res.Body.Close()
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	var events []conversationEvent
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := strings.TrimPrefix(scanner.Text(), "data: ")
+		if line == "" || line == "[DONE]" {
+			continue
+		}
+		evt := conversationEvent{}
+		assert.Empty(t, json.Unmarshal([]byte(line), &evt))
+		events = append(events, evt)
+	}
+
+	assert.Equal(t, conversationEvent{Type: conversationTranscript, Text: "一加二等于几?"}, events[0])
+	assert.Equal(t, conversationEvent{Type: conversationTextDelta, Delta: "一加二"}, events[1])
+	assert.Equal(t, conversationEvent{Type: conversationTextDone, Text: "一加二等于三。"}, events[3])
+	assert.Equal(t, conversationAudioDelta, events[4].Type)
+	assert.Equal(t, "audio/wav", events[4].Format)
+	assert.Equal(t, conversationAudioDone, events[len(events)-1].Type)
+}
+
+func TestWithSystemPrompt(t *testing.T) {
+	llm, _ := backend.NewOpenAIStyleBackend(&backend.AdapterConfig{
+		Name:         "sample",
+		Type:         backend.ModelTypeLLM,
+		SystemPrompt: "你是语音助手",
+	})
+
+	user := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "你好"}
+	messages := withSystemPrompt(llm, []openai.ChatCompletionMessage{user})
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, "你是语音助手", messages[0].Content)
+
+	// 请求的 system 优先
+	system := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: "你是计算器"}
+	messages = withSystemPrompt(llm, []openai.ChatCompletionMessage{system, user})
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, "你是计算器", messages[0].Content)
+}
+
+func TestApiServer_audioConversationsFrames(t *testing.T) {
+	server := _initSampleVoiceServer(t)
+	url := server.URL + "/v1/audio/conversations"
+
+	frame := func(index int, finish string) *http.Response {
+		body := new(bytes.Buffer)
+		mw := multipart.NewWriter(body)
+		fw, _ := mw.CreateFormFile("file", "frame.pcm")
+		_, _ = fw.Write(_tone(16000, 0.5))
+		for k, v := range map[string]string{"is_frame": "1", "audio_id": "c1", "audio_mime": "audio/L16;rate=16000",
+			"frame_index": strconv.Itoa(index), "is_finish": finish, "response_format": "wav"} {
+			_ = mw.WriteField(k, v)
+		}
+		_ = mw.Close()
+		res, err := http.Post(url, mw.FormDataContentType(), body)
+		assert.Empty(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		_, _ = io.Copy(io.Discard, res.Body)
+		_ = res.Body.Close()
+		return res
+	}
+
+	// 两次对话使用同一音频id, 前一次的帧在识别后释放
+	for i := 0; i < 2; i++ {
+		frame(0, "0")
+		status, session := _audioSessionStatus(t, server.URL, "c1")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, audioSessionReceiving, session.Status)
+		assert.Equal(t, 16000, session.Bytes)
+
+		frame(1, "1")
+		status, _ = _audioSessionStatus(t, server.URL, "c1")
+		assert.Equal(t, http.StatusNotFound, status)
+	}
+}
@@ -0,0 +1,46 @@
+package api_server
+
+import (
+	"cmp"
+	"context"
+	"github.com/sashabaranov/go-openai"
+	"squidward/backend"
+	"strconv"
+)
+
+// correctedTranscription LLM 纠错后的识别结果, text 为纠错后的文本
+type correctedTranscription struct {
+	openai.AudioResponse
+	RawText string `json:"raw_text"`
+}
+
+// correctTranscription 按请求的 correct 参数与 STT 后端配置用 LLM 纠正识别文本, 返回原始文本, 未纠错时为空
+// text/srt/vtt 格式无法同时返回原文, 不纠错; verbose_json 的分段保持原始识别结果
+func (s *ApiServer) correctTranscription(ctx context.Context, stt backend.Adapter, format openai.AudioResponseFormat,
+	flag string, res *openai.AudioResponse) string {
+	corrector, ok := stt.(backend.TranscriptCorrector)
+	llm := s.aService.GetBackend(backend.ModelTypeLLM)
+	if !ok || llm == nil {
+		return ""
+	}
+	if _, plain := transcriptionContentTypes[cmp.Or(backend.ResponseFormat(*res), format)]; plain {
+		return ""
+	}
+
+	var enabled *bool
+	if on, err := strconv.ParseBool(flag); err == nil {
+		enabled = &on
+	}
+	text, err := corrector.CorrectTranscript(ctx, llm, res.Text, enabled)
+	if err != nil {
+		// 纠错失败时返回原始识别结果
+		s.logger.Warn(err)
+		return ""
+	}
+	if text == "" {
+		return ""
+	}
+	raw := res.Text
+	res.Text = text
+	return raw
+}
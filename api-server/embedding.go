@@ -0,0 +1,87 @@
+package api_server
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+	"math"
+	"net/http"
+	"squidward/backend"
+)
+
+type embeddingData struct {
+	Object string `json:"object"`
+	// Embedding float 格式为数组, base64 格式为小端 float32 的 base64 编码
+	Embedding any `json:"embedding"`
+	Index     int `json:"index"`
+}
+
+type embeddingUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+type embeddingResponse struct {
+	Object string          `json:"object"`
+	Data   []embeddingData `json:"data"`
+	Model  string          `json:"model"`
+	Usage  embeddingUsage  `json:"usage"`
+}
+
+// embeddings 文本向量, 后端统一返回 float 格式, 请求 base64 时在此编码
+func (s *ApiServer) embeddings(c *gin.Context) {
+	bk := s.aService.GetBackend(backend.ModelTypeEmbedding)
+	if bk == nil {
+		s.logger.Error("未配置Embedding")
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	req := openai.EmbeddingRequest{}
+	if err := c.ShouldBindBodyWithJSON(&req); err != nil || req.Input == nil {
+		writeAPIError(c, http.StatusBadRequest, "", "input", "input is required")
+		return
+	}
+	if req.EncodingFormat != "" && req.EncodingFormat != openai.EmbeddingEncodingFormatFloat &&
+		req.EncodingFormat != openai.EmbeddingEncodingFormatBase64 {
+		writeAPIError(c, http.StatusBadRequest, "", "encoding_format", "encoding_format must be float or base64")
+		return
+	}
+
+	res, err := bk.Embeddings(clientContext(c), req)
+	if errors.Is(err, backend.ErrEmbeddingInput) {
+		writeAPIError(c, http.StatusBadRequest, "", "input", err.Error())
+		return
+	}
+	if err != nil {
+		s.logger.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	out := embeddingResponse{
+		Object: "list",
+		Data:   make([]embeddingData, 0, len(res.Data)),
+		Model:  string(res.Model),
+		Usage:  embeddingUsage{PromptTokens: res.Usage.PromptTokens, TotalTokens: res.Usage.TotalTokens},
+	}
+	for _, emb := range res.Data {
+		data := embeddingData{Object: "embedding", Embedding: emb.Embedding, Index: emb.Index}
+		if req.EncodingFormat == openai.EmbeddingEncodingFormatBase64 {
+			data.Embedding = encodeEmbedding(emb.Embedding)
+		}
+		out.Data = append(out.Data, data)
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// encodeEmbedding 与 OpenAI 相同, 以小端 float32 编码后 base64
+func encodeEmbedding(vec []float32) string {
+	bs := make([]byte, len(vec)*4)
+	for i, v := range vec {
+		binary.LittleEndian.PutUint32(bs[i*4:], math.Float32bits(v))
+	}
+	return base64.StdEncoding.EncodeToString(bs)
+}
@@ -0,0 +1,73 @@
+package api_server
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"squidward/backend"
+	"squidward/lib"
+	"strings"
+	"testing"
+)
+
+func TestApiServer_embeddings(t *testing.T) {
+	var forwarded []map[string]any
+	sample := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := map[string]any{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		forwarded = append(forwarded, req)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, `{"object":"list","model":"bge-m3","data":[`+
+			`{"object":"embedding","index":0,"embedding":[0.5,0.25]},{"object":"embedding","index":1,"embedding":[1,0]}],`+
+			`"usage":{"prompt_tokens":4,"total_tokens":4}}`)
+	}))
+	t.Cleanup(sample.Close)
+
+	bk, err := backend.NewOpenAIStyleBackend(&backend.AdapterConfig{
+		Name:         "sample",
+		Type:         backend.ModelTypeEmbedding,
+		ApiStyle:     "openai",
+		ApiBase:      sample.URL + "/v1/",
+		DefaultModel: "bge-m3",
+	})
+	assert.Empty(t, err)
+	aServcie := &backend.AdapterService{}
+	aServcie.SetBackend(bk)
+	server := httptest.NewServer(NewApiServer(lib.NewLogger(6, "test", 9), aServcie).SetupRouter())
+	t.Cleanup(server.Close)
+
+	post := func(body string) (*http.Response, embeddingResponse) {
+		res, errp := http.Post(server.URL+"/v1/embeddings", "application/json", strings.NewReader(body))
+		assert.Empty(t, errp)
+		defer res.Body.Close()
+		out := embeddingResponse{}
+		_ = json.NewDecoder(res.Body).Decode(&out)
+		return res, out
+	}
+
+	res, out := post(`{"input":["你好","世界"]}`)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "bge-m3", forwarded[0]["model"])
+	assert.Equal(t, "list", out.Object)
+	assert.Equal(t, []any{0.5, 0.25}, out.Data[0].Embedding)
+	assert.Equal(t, 4, out.Usage.TotalTokens)
+
+	// 后端统一以 float 请求, 在服务端编码为 base64
+	res, out = post(`{"input":["你好","世界"],"encoding_format":"base64"}`)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.NotContains(t, forwarded[1], "encoding_format")
+	bs, err := base64.StdEncoding.DecodeString(out.Data[0].Embedding.(string))
+	assert.Empty(t, err)
+	assert.Equal(t, float32(0.5), math.Float32frombits(binary.LittleEndian.Uint32(bs)))
+	assert.Equal(t, float32(0.25), math.Float32frombits(binary.LittleEndian.Uint32(bs[4:])))
+
+	res, _ = post(`{"input":{"text":"你好"}}`)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res, _ = post(`{"input":"你好","encoding_format":"int8"}`)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
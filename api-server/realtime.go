@@ -0,0 +1,637 @@
+package api_server
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/sashabaranov/go-openai"
+	"io"
+	"net/http"
+	"slices"
+	"squidward/backend"
+	"squidward/lib"
+	"squidward/modules/audio"
+	"squidward/modules/realtime"
+	"sync"
+	"time"
+)
+
+// realtimeUpgrader OpenAI Realtime 浏览器客户端通过子协议 "realtime" 连接
+var realtimeUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	Subprotocols:    []string{"realtime"},
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// realtimeAudioChunk 每个 response.audio.delta 的音频时长
+const realtimeAudioChunk = 100 * time.Millisecond
+
+// realtimeSession 一个 Realtime 连接的会话状态
+type realtimeSession struct {
+	s    *ApiServer
+	conn *wsConn
+
+	stt backend.Adapter
+	llm backend.Adapter
+	tts backend.Adapter
+
+	// 转写与响应按顺序执行
+	queue *jobQueue
+
+	mu        sync.Mutex
+	session   realtime.Session
+	items     []realtime.Item
+	buffer    []byte // 未提交的输入音频, server vad 开启时由 segmenter 保留语音段, 不缓存
+	received  int    // 已接收的输入音频字节数, 用于计算 server vad 时间
+	segmenter *audio.Segmenter
+	cancel    context.CancelFunc // 进行中的响应
+}
+
+// realtime OpenAI Realtime 协议, 由 STT、LLM 与 TTS 组合实现
+func (s *ApiServer) realtime(c *gin.Context) {
+	llm := s.aService.GetBackend(backend.ModelTypeLLM)
+	if llm == nil {
+		s.logger.Error("未配置LLM")
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	conn, err := realtimeUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		s.logger.Error(err)
+		return
+	}
+	defer conn.Close()
+
+	rs := &realtimeSession{
+		s:     s,
+		conn:  &wsConn{Conn: conn, ctx: clientContext(c)},
+		stt:   s.aService.GetBackend(backend.ModelTypeSTT),
+		llm:   llm,
+		tts:   s.aService.GetBackend(backend.ModelTypeTTS),
+		queue: newJobQueue(),
+	}
+	rs.session = rs.defaultSession(c.Query("model"))
+	rs.resetSegmenter()
+
+	rs.run()
+}
+
+func (rs *realtimeSession) defaultSession(model string) realtime.Session {
+	modalities := []string{realtime.ModalityText}
+	if rs.tts != nil {
+		modalities = append(modalities, realtime.ModalityAudio)
+	}
+	var turn *realtime.TurnDetection
+	if rs.stt != nil {
+		turn = &realtime.TurnDetection{
+			Type:              "server_vad",
+			Threshold:         0.5,
+			PrefixPaddingMs:   300,
+			SilenceDurationMs: 500,
+		}
+	}
+	return realtime.Session{
+		ID:                "sess_" + lib.RandomID(),
+		Object:            "realtime.session",
+		Model:             model,
+		Modalities:        modalities,
+		InputAudioFormat:  realtime.AudioFormatPCM16,
+		OutputAudioFormat: realtime.AudioFormatPCM16,
+		TurnDetection:     turn,
+	}
+}
+
+func (rs *realtimeSession) run() {
+	defer func() {
+		rs.mu.Lock()
+		if rs.cancel != nil {
+			rs.cancel()
+		}
+		rs.mu.Unlock()
+		rs.queue.stop()
+		rs.queue.wait()
+	}()
+
+	rs.mu.Lock()
+	session := rs.session
+	rs.mu.Unlock()
+	if err := rs.send(realtime.ServerEvent{Type: realtime.EventSessionCreated, Session: &session}); err != nil {
+		return
+	}
+
+	for {
+		_, message, err := rs.conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				rs.s.logger.Debug(err)
+			}
+			return
+		}
+
+		evt := realtime.ClientEvent{}
+		if err = json.Unmarshal(message, &evt); err != nil {
+			rs.sendError("", "invalid_request_error", "invalid_json", err.Error())
+			continue
+		}
+
+		switch evt.Type {
+		case realtime.EventSessionUpdate:
+			rs.updateSession(evt, message)
+		case realtime.EventInputAudioBufferAppend:
+			rs.appendAudio(evt)
+		case realtime.EventInputAudioBufferCommit:
+			rs.commitBuffer(evt)
+		case realtime.EventInputAudioBufferClear:
+			rs.mu.Lock()
+			rs.buffer = nil
+			rs.resetSegmenter()
+			rs.mu.Unlock()
+			_ = rs.send(realtime.ServerEvent{Type: realtime.EventInputAudioBufferCleared})
+		case realtime.EventConversationItemCreate:
+			rs.createItem(evt)
+		case realtime.EventResponseCreate:
+			rs.createResponse(evt.Response)
+		case realtime.EventResponseCancel:
+			rs.mu.Lock()
+			if rs.cancel != nil {
+				rs.cancel()
+			}
+			rs.mu.Unlock()
+		default:
+			rs.sendError(evt.EventID, "invalid_request_error", "unknown_event", "unsupported event type: "+evt.Type)
+		}
+	}
+}
+
+// updateSession 合并会话配置, turn_detection 为 null 时关闭 server vad
+func (rs *realtimeSession) updateSession(evt realtime.ClientEvent, message []byte) {
+	if evt.Session == nil {
+		rs.sendError(evt.EventID, "invalid_request_error", "missing_session", "session is required")
+		return
+	}
+	raw := struct {
+		Session map[string]json.RawMessage `json:"session"`
+	}{}
+	_ = json.Unmarshal(message, &raw)
+
+	update := evt.Session
+	for _, format := range []string{update.InputAudioFormat, update.OutputAudioFormat} {
+		if format != "" && format != realtime.AudioFormatPCM16 && format != realtime.AudioFormatG711ULaw && format != realtime.AudioFormatG711ALaw {
+			rs.sendError(evt.EventID, "invalid_request_error", "invalid_value", "unsupported audio format: "+format)
+			return
+		}
+	}
+
+	rs.mu.Lock()
+	cur := &rs.session
+	if update.Model != "" {
+		cur.Model = update.Model
+	}
+	if update.Modalities != nil {
+		cur.Modalities = update.Modalities
+	}
+	if update.Instructions != "" {
+		cur.Instructions = update.Instructions
+	}
+	if update.Voice != "" {
+		cur.Voice = update.Voice
+	}
+	if update.InputAudioFormat != "" {
+		cur.InputAudioFormat = update.InputAudioFormat
+	}
+	if update.OutputAudioFormat != "" {
+		cur.OutputAudioFormat = update.OutputAudioFormat
+	}
+	if update.InputAudioTranscription != nil {
+		cur.InputAudioTranscription = update.InputAudioTranscription
+	}
+	if _, ok := raw.Session["turn_detection"]; ok {
+		cur.TurnDetection = update.TurnDetection
+	}
+	if update.Temperature != 0 {
+		cur.Temperature = update.Temperature
+	}
+	if update.MaxResponseOutputTokens != nil {
+		cur.MaxResponseOutputTokens = update.MaxResponseOutputTokens
+	}
+	rs.resetSegmenter()
+	session := *cur
+	rs.mu.Unlock()
+
+	_ = rs.send(realtime.ServerEvent{Type: realtime.EventSessionUpdated, Session: &session})
+}
+
+// resetSegmenter 按会话配置重建 server vad, 需持有锁
+func (rs *realtimeSession) resetSegmenter() {
+	rs.segmenter = nil
+	rs.received = 0
+	turn := rs.session.TurnDetection
+	if turn == nil || turn.Type != "server_vad" {
+		return
+	}
+
+	cfg := vadConfig(rs.stt)
+	if turn.SilenceDurationMs > 0 {
+		cfg.MinSilence = time.Duration(turn.SilenceDurationMs) * time.Millisecond
+	}
+	if turn.PrefixPaddingMs > 0 {
+		cfg.Padding = time.Duration(turn.PrefixPaddingMs) * time.Millisecond
+	}
+	rs.segmenter, _ = audio.NewSegmenter(realtime.AudioMime(rs.session.InputAudioFormat), cfg)
+}
+
+func (rs *realtimeSession) appendAudio(evt realtime.ClientEvent) {
+	if rs.stt == nil {
+		rs.sendError(evt.EventID, "invalid_request_error", "stt_not_configured", "audio input is not available")
+		return
+	}
+	data, err := base64.StdEncoding.DecodeString(evt.Audio)
+	if err != nil {
+		rs.sendError(evt.EventID, "invalid_request_error", "invalid_audio", err.Error())
+		return
+	}
+
+	rs.mu.Lock()
+	rs.received += len(data)
+	segmenter := rs.segmenter
+	if segmenter == nil {
+		rs.buffer = append(rs.buffer, data...)
+	}
+	format := rs.session.InputAudioFormat
+	padding := 0
+	createResponse := true
+	if turn := rs.session.TurnDetection; turn != nil {
+		padding = turn.PrefixPaddingMs
+		if turn.CreateResponse != nil {
+			createResponse = *turn.CreateResponse
+		}
+	}
+	rs.mu.Unlock()
+
+	if segmenter == nil {
+		return
+	}
+
+	speaking := segmenter.Speaking()
+	segments, err := segmenter.Write(data)
+	if err != nil {
+		rs.sendError(evt.EventID, "invalid_request_error", "invalid_audio", err.Error())
+		return
+	}
+
+	if !speaking && (segmenter.Speaking() || len(segments) > 0) {
+		// 打断进行中的响应
+		rs.mu.Lock()
+		if rs.cancel != nil {
+			rs.cancel()
+		}
+		rs.mu.Unlock()
+		// 确认开始说话时已经过了 MinSpeech, audio_start_ms 包含前置静音
+		minSpeech := int(cmp.Or(vadConfig(rs.stt).MinSpeech, audio.DefaultVADConfig().MinSpeech) / time.Millisecond)
+		start := max(rs.receivedMs(format)-minSpeech-padding, 0)
+		_ = rs.send(realtime.ServerEvent{Type: realtime.EventInputAudioBufferSpeechStarted, AudioStartMs: realtime.Int(start)})
+	}
+
+	for _, seg := range segments {
+		_ = rs.send(realtime.ServerEvent{
+			Type:       realtime.EventInputAudioBufferSpeechStopped,
+			AudioEndMs: realtime.Int(int(seg.End / time.Millisecond)),
+		})
+		rs.commitAudio(seg.PCM)
+		if createResponse {
+			rs.createResponse(nil)
+		}
+	}
+}
+
+// receivedMs 已接收的输入音频时长
+func (rs *realtimeSession) receivedMs(format string) int {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	bytesPerMs := realtime.AudioSampleRate(format) / 1000
+	if format == realtime.AudioFormatPCM16 {
+		bytesPerMs *= 2
+	}
+	return rs.received / bytesPerMs
+}
+
+func (rs *realtimeSession) commitBuffer(evt realtime.ClientEvent) {
+	rs.mu.Lock()
+	data := rs.buffer
+	rs.buffer = nil
+	mime := realtime.AudioMime(rs.session.InputAudioFormat)
+	segmenter := rs.segmenter
+	rs.resetSegmenter()
+	rs.mu.Unlock()
+
+	// server vad 开启时提交正在说的语音段
+	if segmenter != nil {
+		if seg := segmenter.Flush(); seg != nil {
+			rs.commitAudio(seg.PCM)
+			return
+		}
+	}
+	if len(data) == 0 {
+		rs.sendError(evt.EventID, "invalid_request_error", "input_audio_buffer_commit_empty", "buffer is empty")
+		return
+	}
+	pcm, err := audio.DecodeRaw(data, mime)
+	if err != nil {
+		rs.sendError(evt.EventID, "invalid_request_error", "invalid_audio", err.Error())
+		return
+	}
+	rs.commitAudio(pcm)
+}
+
+// commitAudio 将一段输入音频加入会话并排队转写
+func (rs *realtimeSession) commitAudio(pcm *audio.PCM) {
+	item := realtime.Item{
+		ID:      "item_" + lib.RandomID(),
+		Object:  "realtime.item",
+		Type:    "message",
+		Status:  realtime.StatusCompleted,
+		Role:    string(openai.ChatMessageRoleUser),
+		Content: []realtime.ContentPart{{Type: realtime.ContentInputAudio}},
+	}
+	previous := rs.appendItem(item)
+
+	_ = rs.send(realtime.ServerEvent{Type: realtime.EventInputAudioBufferCommitted, ItemID: item.ID, PreviousItemID: previous})
+	_ = rs.send(realtime.ServerEvent{Type: realtime.EventConversationItemCreated, Item: &item, PreviousItemID: previous})
+
+	rs.mu.Lock()
+	req := openai.AudioRequest{
+		FilePath: "audio.wav",
+		Reader:   bytes.NewReader(pcm.EncodeWAV()),
+	}
+	if rs.session.InputAudioTranscription != nil {
+		req.Model = rs.session.InputAudioTranscription.Model
+	}
+	rs.mu.Unlock()
+
+	rs.queue.push(func() {
+		res, err := rs.stt.AudioTranscriptions(rs.conn.Context(), req)
+		if err != nil {
+			rs.s.logger.Warn(err)
+			_ = rs.send(realtime.ServerEvent{
+				Type:         realtime.EventInputAudioTranscriptionFailed,
+				ItemID:       item.ID,
+				ContentIndex: realtime.Int(0),
+				Error:        &realtime.Error{Type: "transcription_error", Message: err.Error()},
+			})
+			return
+		}
+
+		rs.mu.Lock()
+		for i := range rs.items {
+			if rs.items[i].ID == item.ID {
+				rs.items[i].Content[0].Transcript = res.Text
+			}
+		}
+		rs.mu.Unlock()
+
+		_ = rs.send(realtime.ServerEvent{
+			Type:         realtime.EventInputAudioTranscriptionCompleted,
+			ItemID:       item.ID,
+			ContentIndex: realtime.Int(0),
+			Transcript:   res.Text,
+		})
+	})
+}
+
+func (rs *realtimeSession) createItem(evt realtime.ClientEvent) {
+	if evt.Item == nil || evt.Item.Type != "message" {
+		rs.sendError(evt.EventID, "invalid_request_error", "invalid_item", "only message items are supported")
+		return
+	}
+	item := *evt.Item
+	if item.ID == "" {
+		item.ID = "item_" + lib.RandomID()
+	}
+	item.Object = "realtime.item"
+	item.Status = realtime.StatusCompleted
+	previous := rs.appendItem(item)
+	_ = rs.send(realtime.ServerEvent{Type: realtime.EventConversationItemCreated, Item: &item, PreviousItemID: previous})
+}
+
+// appendItem 加入会话, 返回前一条的 id
+func (rs *realtimeSession) appendItem(item realtime.Item) *string {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	var previous *string
+	if len(rs.items) > 0 {
+		previous = realtime.String(rs.items[len(rs.items)-1].ID)
+	}
+	rs.items = append(rs.items, item)
+	return previous
+}
+
+// createResponse 排队生成一次响应, 排在已提交音频的转写之后
+func (rs *realtimeSession) createResponse(cfg *realtime.ResponseConfig) {
+	ctx, cancel := context.WithCancel(rs.conn.Context())
+
+	rs.mu.Lock()
+	if rs.cancel != nil {
+		rs.cancel()
+	}
+	rs.cancel = cancel
+	session := rs.session
+	rs.mu.Unlock()
+
+	if cfg != nil {
+		if cfg.Modalities != nil {
+			session.Modalities = cfg.Modalities
+		}
+		if cfg.Instructions != "" {
+			session.Instructions = cfg.Instructions
+		}
+		if cfg.Voice != "" {
+			session.Voice = cfg.Voice
+		}
+		if cfg.OutputAudioFormat != "" {
+			session.OutputAudioFormat = cfg.OutputAudioFormat
+		}
+		if cfg.Temperature != 0 {
+			session.Temperature = cfg.Temperature
+		}
+		if cfg.MaxResponseOutputTokens != nil {
+			session.MaxResponseOutputTokens = cfg.MaxResponseOutputTokens
+		}
+	}
+
+	rs.queue.push(func() {
+		defer cancel()
+		rs.respond(ctx, session)
+	})
+}
+
+// respond 流式输出 LLM 文本, 需要音频时将完整文本合成后分块输出
+func (rs *realtimeSession) respond(ctx context.Context, session realtime.Session) {
+	resp := realtime.Response{
+		ID:     "resp_" + lib.RandomID(),
+		Object: "realtime.response",
+		Status: realtime.StatusInProgress,
+		Output: []realtime.Item{},
+	}
+	_ = rs.send(realtime.ServerEvent{Type: realtime.EventResponseCreated, Response: &resp})
+
+	withAudio := rs.tts != nil && slices.Contains(session.Modalities, realtime.ModalityAudio)
+	part := realtime.ContentPart{Type: realtime.ContentText}
+	deltaType, doneType := realtime.EventResponseTextDelta, realtime.EventResponseTextDone
+	if withAudio {
+		part.Type = realtime.ContentAudio
+		deltaType, doneType = realtime.EventResponseAudioTranscriptDelta, realtime.EventResponseAudioTranscriptDone
+	}
+
+	item := realtime.Item{
+		ID:     "item_" + lib.RandomID(),
+		Object: "realtime.item",
+		Type:   "message",
+		Status: realtime.StatusInProgress,
+		Role:   string(openai.ChatMessageRoleAssistant),
+	}
+	output := func(evt realtime.ServerEvent) {
+		evt.ResponseID = resp.ID
+		evt.OutputIndex = realtime.Int(0)
+		if evt.Item == nil {
+			evt.ItemID = item.ID
+			evt.ContentIndex = realtime.Int(0)
+		}
+		_ = rs.send(evt)
+	}
+	output(realtime.ServerEvent{Type: realtime.EventResponseOutputItemAdded, Item: &item})
+	output(realtime.ServerEvent{Type: realtime.EventResponseContentPartAdded, Part: &realtime.ContentPart{Type: part.Type}})
+
+	text, err := rs.generate(ctx, session, func(delta string) {
+		output(realtime.ServerEvent{Type: deltaType, Delta: delta})
+	})
+	if err == nil && withAudio && text != "" {
+		err = rs.synthesize(ctx, session, text, func(chunk []byte) {
+			output(realtime.ServerEvent{Type: realtime.EventResponseAudioDelta, Delta: base64.StdEncoding.EncodeToString(chunk)})
+		})
+	}
+
+	status := realtime.StatusCompleted
+	if err != nil {
+		status = realtime.StatusFailed
+		if ctx.Err() != nil {
+			status = realtime.StatusCancelled
+		} else {
+			rs.s.logger.Warn(err)
+			rs.sendError("", "server_error", "response_failed", err.Error())
+		}
+	}
+
+	if withAudio {
+		output(realtime.ServerEvent{Type: realtime.EventResponseAudioDone})
+		output(realtime.ServerEvent{Type: doneType, Transcript: text})
+		part.Transcript = text
+	} else {
+		output(realtime.ServerEvent{Type: doneType, Text: text})
+		part.Text = text
+	}
+	output(realtime.ServerEvent{Type: realtime.EventResponseContentPartDone, Part: &part})
+
+	item.Content = []realtime.ContentPart{part}
+	item.Status = realtime.StatusCompleted
+	if status != realtime.StatusCompleted {
+		item.Status = realtime.StatusIncomplete
+	}
+	output(realtime.ServerEvent{Type: realtime.EventResponseOutputItemDone, Item: &item})
+	rs.appendItem(item)
+
+	resp.Status = status
+	resp.Output = []realtime.Item{item}
+	_ = rs.send(realtime.ServerEvent{Type: realtime.EventResponseDone, Response: &resp})
+}
+
+// generate 以会话记录请求 LLM, 返回完整文本
+func (rs *realtimeSession) generate(ctx context.Context, session realtime.Session, emit func(delta string)) (string, error) {
+	req := openai.ChatCompletionRequest{
+		Model:       session.Model,
+		Temperature: session.Temperature,
+	}
+	if n, ok := session.MaxResponseOutputTokens.(float64); ok {
+		req.MaxTokens = int(n)
+	}
+	if session.Instructions != "" {
+		req.Messages = append(req.Messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: session.Instructions,
+		})
+	}
+	rs.mu.Lock()
+	for i := range rs.items {
+		if text := rs.items[i].Text(); text != "" {
+			req.Messages = append(req.Messages, openai.ChatCompletionMessage{Role: rs.items[i].Role, Content: text})
+		}
+	}
+	rs.mu.Unlock()
+
+	return streamChatText(ctx, rs.llm, req, emit)
+}
+
+// synthesize 合成语音并转换为会话输出格式, 按 realtimeAudioChunk 分块输出
+func (rs *realtimeSession) synthesize(ctx context.Context, session realtime.Session, text string, emit func(chunk []byte)) error {
+	res, err := rs.tts.AudioSpeech(ctx, openai.CreateSpeechRequest{
+		Input:          text,
+		Voice:          openai.SpeechVoice(session.Voice),
+		ResponseFormat: openai.SpeechResponseFormatWav,
+	})
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(res)
+	_ = res.Close()
+	if err != nil {
+		return err
+	}
+
+	pcm, err := audio.DecodeWAV(data)
+	if err != nil {
+		return err
+	}
+	rate := realtime.AudioSampleRate(session.OutputAudioFormat)
+	encoded, err := pcm.Mono().Resample(rate).Encode(realtime.AudioMime(session.OutputAudioFormat))
+	if err != nil {
+		return err
+	}
+
+	size := int(int64(rate) * int64(realtimeAudioChunk) / int64(time.Second))
+	if session.OutputAudioFormat == "" || session.OutputAudioFormat == realtime.AudioFormatPCM16 {
+		size *= 2
+	}
+	for i := 0; i < len(encoded); i += size {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		emit(encoded[i:min(i+size, len(encoded))])
+	}
+	return nil
+}
+
+func (rs *realtimeSession) sendError(eventID, typ, code, message string) {
+	_ = rs.send(realtime.ServerEvent{
+		Type:  realtime.EventError,
+		Error: &realtime.Error{Type: typ, Code: code, Message: message, EventID: eventID},
+	})
+}
+
+func (rs *realtimeSession) send(evt realtime.ServerEvent) error {
+	evt.EventID = "event_" + lib.RandomID()
+	rs.conn.mu.Lock()
+	defer rs.conn.mu.Unlock()
+	_ = rs.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	err := rs.conn.Conn.WriteJSON(evt)
+	if err != nil {
+		rs.s.logger.Debug(err)
+	}
+	return err
+}
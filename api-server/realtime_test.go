@@ -0,0 +1,228 @@
+package api_server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"squidward/backend"
+	"squidward/lib"
+	"squidward/modules/audio"
+	"squidward/modules/realtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// _initSampleVoiceServer 模拟 STT、LLM 与 TTS 后端
+func _initSampleVoiceServer(t *testing.T) *httptest.Server {
+	sample := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/audio/transcriptions"):
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			fmt.Fprint(w, `{"task":"transcribe","language":"zh","duration":1,"text":"一加二等于几?"}`)
+		case strings.HasSuffix(r.URL.Path, "/chat/completions"):
+			body, _ := io.ReadAll(r.Body)
+			if !strings.Contains(string(body), `"stream":true`) {
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				fmt.Fprint(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":"一加二等于三。"}}]}`)
+				return
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, delta := range []string{"一加二", "等于三。"} {
+				fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", delta)
+			}
+			fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		case strings.HasSuffix(r.URL.Path, "/audio/speech"):
+			pcm, _ := audio.DecodeRaw(_tone(16000, 0.5), "audio/L16;rate=16000")
+			w.Header().Set("Content-Type", "audio/wav")
+			_, _ = w.Write(pcm.EncodeWAV())
+		}
+	}))
+	t.Cleanup(sample.Close)
+
+	aServcie := &backend.AdapterService{}
+	for _, typ := range []backend.ModelType{backend.ModelTypeSTT, backend.ModelTypeLLM, backend.ModelTypeTTS} {
+		bk, err := backend.NewOpenAIStyleBackend(&backend.AdapterConfig{
+			Name:     "sample",
+			Type:     typ,
+			ApiStyle: "openai",
+			ApiBase:  sample.URL + "/v1/",
+		})
+		assert.Empty(t, err)
+		aServcie.SetBackend(bk)
+	}
+
+	mserver := &ApiServer{
+		logger:      lib.NewLogger(6, "test", 9),
+		apiBase:     "/v1",
+		aService:    aServcie,
+		audioFrames: map[string]*audio.Audio{},
+	}
+	server := httptest.NewServer(mserver.SetupRouter())
+	t.Cleanup(server.Close)
+	return server
+}
+
+// _realtimeUntil 读取事件直到指定类型
+func _realtimeUntil(t *testing.T, conn *websocket.Conn, typ string) []realtime.ServerEvent {
+	var events []realtime.ServerEvent
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		evt := realtime.ServerEvent{}
+		if !assert.Empty(t, conn.ReadJSON(&evt)) {
+			return events
+		}
+		events = append(events, evt)
+		if evt.Type == typ {
+			return events
+		}
+	}
+}
+
+func _realtimeTypes(events []realtime.ServerEvent) []string {
+	var types []string
+	for _, evt := range events {
+		types = append(types, evt.Type)
+	}
+	return types
+}
+
+func TestApiServer_realtime(t *testing.T) {
+	server := _initSampleVoiceServer(t)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/realtime?model=gpt-4o"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Empty(t, err)
+	defer conn.Close()
+
+	events := _realtimeUntil(t, conn, realtime.EventSessionCreated)
+	assert.Equal(t, "gpt-4o", events[0].Session.Model)
+	assert.Equal(t, "server_vad", events[0].Session.TurnDetection.Type)
+
+	// 关闭 server vad, 手动提交
+	assert.Empty(t, conn.WriteMessage(websocket.TextMessage,
+		[]byte(`{"type":"session.update","session":{"instructions":"你是计算器","output_audio_format":"g711_ulaw","turn_detection":null}}`)))
+	events = _realtimeUntil(t, conn, realtime.EventSessionUpdated)
+	assert.Nil(t, events[0].Session.TurnDetection)
+	assert.Equal(t, "你是计算器", events[0].Session.Instructions)
+
+	assert.Empty(t, conn.WriteJSON(realtime.ClientEvent{Type: realtime.EventInputAudioBufferCommit}))
+	events = _realtimeUntil(t, conn, realtime.EventError)
+	assert.Equal(t, "input_audio_buffer_commit_empty", events[0].Error.Code)
+
+	assert.Empty(t, conn.WriteJSON(realtime.ClientEvent{
+		Type:  realtime.EventInputAudioBufferAppend,
+		Audio: base64.StdEncoding.EncodeToString(_tone(24000, 1)),
+	}))
+	assert.Empty(t, conn.WriteJSON(realtime.ClientEvent{Type: realtime.EventInputAudioBufferCommit}))
+	assert.Empty(t, conn.WriteJSON(realtime.ClientEvent{Type: realtime.EventResponseCreate}))
+
+	events = _realtimeUntil(t, conn, realtime.EventResponseDone)
+	assert.Equal(t, []string{
+		realtime.EventInputAudioBufferCommitted,
+		realtime.EventConversationItemCreated,
+		realtime.EventInputAudioTranscriptionCompleted,
+		realtime.EventResponseCreated,
+		realtime.EventResponseOutputItemAdded,
+		realtime.EventResponseContentPartAdded,
+		realtime.EventResponseAudioTranscriptDelta,
+		realtime.EventResponseAudioTranscriptDelta,
+		realtime.EventResponseAudioDelta,
+		realtime.EventResponseAudioDelta,
+		realtime.EventResponseAudioDelta,
+		realtime.EventResponseAudioDelta,
+		realtime.EventResponseAudioDelta,
+		realtime.EventResponseAudioDone,
+		realtime.EventResponseAudioTranscriptDone,
+		realtime.EventResponseContentPartDone,
+		realtime.EventResponseOutputItemDone,
+		realtime.EventResponseDone,
+	}, _realtimeTypes(events))
+	assert.Equal(t, "一加二等于几?", events[2].Transcript)
+
+	// 0.5 秒 8kHz μ-law, 每块 100ms
+	chunk, err := base64.StdEncoding.DecodeString(events[8].Delta)
+	assert.Empty(t, err)
+	assert.Equal(t, 800, len(chunk))
+
+	done := events[len(events)-1].Response
+	assert.Equal(t, realtime.StatusCompleted, done.Status)
+	assert.Equal(t, "一加二等于三。", done.Output[0].Content[0].Transcript)
+
+	// 纯文本响应
+	assert.Empty(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"response.create","response":{"modalities":["text"]}}`)))
+	events = _realtimeUntil(t, conn, realtime.EventResponseDone)
+	assert.Contains(t, _realtimeTypes(events), realtime.EventResponseTextDelta)
+	assert.NotContains(t, _realtimeTypes(events), realtime.EventResponseAudioDelta)
+	assert.Equal(t, "一加二等于三。", events[len(events)-1].Response.Output[0].Content[0].Text)
+}
+
+func TestApiServer_realtimeServerVAD(t *testing.T) {
+	server := _initSampleVoiceServer(t)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/realtime"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Empty(t, err)
+	defer conn.Close()
+	_realtimeUntil(t, conn, realtime.EventSessionCreated)
+
+	data := append(make([]byte, 24000), _tone(24000, 1)...)
+	data = append(data, make([]byte, 48000)...)
+	for i := 0; i < len(data); i += 4800 {
+		assert.Empty(t, conn.WriteJSON(realtime.ClientEvent{
+			Type:  realtime.EventInputAudioBufferAppend,
+			Audio: base64.StdEncoding.EncodeToString(data[i:min(i+4800, len(data))]),
+		}))
+	}
+
+	events := _realtimeUntil(t, conn, realtime.EventResponseDone)
+	types := _realtimeTypes(events)
+	assert.Equal(t, realtime.EventInputAudioBufferSpeechStarted, types[0])
+	assert.Equal(t, realtime.EventInputAudioBufferSpeechStopped, types[1])
+	assert.Contains(t, types, realtime.EventInputAudioTranscriptionCompleted)
+	assert.InDelta(t, 200, *events[0].AudioStartMs, 100)
+	assert.Equal(t, realtime.StatusCompleted, events[len(events)-1].Response.Status)
+}
+
+func TestRealtimeSession_appendAudioServerVAD(t *testing.T) {
+	bk, err := backend.NewOpenAIStyleBackend(&backend.AdapterConfig{Name: "sample", Type: backend.ModelTypeSTT, ApiStyle: "openai"})
+	assert.Empty(t, err)
+	rs := &realtimeSession{stt: bk}
+	rs.session = rs.defaultSession("")
+	rs.resetSegmenter()
+
+	// server vad 开启时静音不缓存
+	for i := 0; i < 100; i++ {
+		rs.appendAudio(realtime.ClientEvent{Audio: base64.StdEncoding.EncodeToString(make([]byte, 4800))})
+	}
+	assert.Empty(t, rs.buffer)
+	assert.Equal(t, 480000, rs.received)
+}
+
+func TestApiServer_realtimeServerVADCommit(t *testing.T) {
+	server := _initSampleVoiceServer(t)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/realtime"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Empty(t, err)
+	defer conn.Close()
+	_realtimeUntil(t, conn, realtime.EventSessionCreated)
+
+	// 说话未结束时手动提交当前语音段
+	assert.Empty(t, conn.WriteJSON(realtime.ClientEvent{
+		Type:  realtime.EventInputAudioBufferAppend,
+		Audio: base64.StdEncoding.EncodeToString(append(make([]byte, 24000), _tone(24000, 1)...)),
+	}))
+	assert.Empty(t, conn.WriteJSON(realtime.ClientEvent{Type: realtime.EventInputAudioBufferCommit}))
+
+	events := _realtimeUntil(t, conn, realtime.EventInputAudioTranscriptionCompleted)
+	types := _realtimeTypes(events)
+	assert.Equal(t, realtime.EventInputAudioBufferSpeechStarted, types[0])
+	assert.Contains(t, types, realtime.EventInputAudioBufferCommitted)
+	assert.NotContains(t, types, realtime.EventError)
+}
@@ -0,0 +1,93 @@
+package api_server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"net/url"
+	"squidward/modules/audio"
+	"squidward/modules/diskcache"
+	"strconv"
+	"strings"
+)
+
+var (
+	errSpeechNotTranscodable = errors.New("audio post-processing requires response_format wav or pcm")
+	errSpeechNotDecodable    = errors.New("tts backend returned compressed audio instead of wav or pcm")
+)
+
+// speechPcmMime OpenAI pcm 格式: 24kHz 单声道 S16LE
+const speechPcmMime = "audio/L16;rate=24000"
+
+// speechProcessQuery GET 请求从查询参数读取后处理选项
+func speechProcessQuery(query url.Values) audio.PostProcessConfig {
+	opts := audio.PostProcessConfig{}
+	opts.SampleRate, _ = strconv.Atoi(query.Get("sample_rate"))
+	opts.Loudness, _ = strconv.ParseFloat(query.Get("loudness"), 64)
+	opts.Tempo, _ = strconv.ParseFloat(query.Get("tempo"), 64)
+	opts.TrimSilence, _ = strconv.ParseBool(query.Get("trim_silence"))
+	return opts
+}
+
+// speechProcessETag 后处理结果与原始音频不同, ETag 需包含处理选项
+func speechProcessETag(etag string, opts audio.PostProcessConfig) string {
+	if opts.IsZero() {
+		return etag
+	}
+	key := diskcache.Key(strings.Trim(etag, `"`), fmt.Sprintf("%+v", opts))
+	return `"` + key[:32] + `"`
+}
+
+// needTranscodeSpeech 需要后处理, 或后端返回的格式与请求不符(如请求 pcm 却返回 wav)
+func needTranscodeSpeech(body *bufio.Reader, format openai.SpeechResponseFormat, opts audio.PostProcessConfig) bool {
+	if !opts.IsZero() {
+		return true
+	}
+	if format != openai.SpeechResponseFormatWav && format != openai.SpeechResponseFormatPcm {
+		return false
+	}
+	head, _ := body.Peek(12)
+	return audio.IsWAV(head) != (format == openai.SpeechResponseFormatWav)
+}
+
+// transcodeSpeech wav 与 pcm 互转并做后处理, 返回数据与 Content-Type
+// 按文件头识别格式, pcm 输入按 Content-Type 解析, 无法解析时按 OpenAI 的 24kHz 单声道处理
+// 后端忽略 response_format 返回 mp3、opus 等压缩格式时无法在本地解码, 返回错误
+func transcodeSpeech(data []byte, contentType string, format openai.SpeechResponseFormat, opts audio.PostProcessConfig) ([]byte, string, error) {
+	if format != openai.SpeechResponseFormatWav && format != openai.SpeechResponseFormatPcm {
+		return nil, "", errSpeechNotTranscodable
+	}
+
+	var pcm *audio.PCM
+	var err error
+	switch sniffed := audio.Sniff(data); sniffed {
+	case audio.MimeWAV:
+		pcm, err = audio.DecodeWAV(data)
+	case "":
+		mime := contentType
+		if !strings.HasPrefix(mime, "audio/L16") || !strings.Contains(mime, "rate=") {
+			mime = speechPcmMime
+		}
+		pcm, err = audio.DecodeRaw(data, mime)
+	default:
+		return nil, "", fmt.Errorf("%w: %s", errSpeechNotDecodable, sniffed)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	// pcm 输出未指定采样率时与 OpenAI 保持一致
+	if format == openai.SpeechResponseFormatPcm {
+		pcm = pcm.Mono()
+		if opts.SampleRate <= 0 {
+			opts.SampleRate = 24000
+		}
+	}
+	pcm = opts.Apply(pcm)
+
+	if format == openai.SpeechResponseFormatWav {
+		return pcm.EncodeWAV(), speechContentTypes[openai.SpeechResponseFormatWav], nil
+	}
+	return pcm.Bytes(), fmt.Sprintf("audio/L16;rate=%d", pcm.SampleRate), nil
+}
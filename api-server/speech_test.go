@@ -0,0 +1,181 @@
+package api_server
+
+import (
+	"bytes"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"squidward/backend"
+	"squidward/lib"
+	"squidward/modules/audio"
+	"squidward/modules/diskcache"
+	"sync/atomic"
+	"testing"
+)
+
+func TestApiServer_audioSpeechCache(t *testing.T) {
+	count := &atomic.Int32{}
+	sample := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count.Add(1)
+		w.Header().Set("Content-Type", "audio/mpeg")
+		_, _ = w.Write([]byte("mp3 data"))
+	}))
+	t.Cleanup(sample.Close)
+
+	bk, err := backend.NewOpenAIStyleBackend(&backend.AdapterConfig{
+		Name:     "sample",
+		Type:     backend.ModelTypeTTS,
+		ApiStyle: "openai",
+		ApiBase:  sample.URL + "/v1/",
+		Cache:    &diskcache.Config{Dir: t.TempDir(), MaxSize: 1 << 20},
+	})
+	assert.Empty(t, err)
+	aServcie := &backend.AdapterService{}
+	aServcie.SetBackend(bk)
+	mserver := &ApiServer{
+		logger:      lib.NewLogger(6, "test", 9),
+		apiBase:     "/v1",
+		aService:    aServcie,
+		audioFrames: map[string]*audio.Audio{},
+		adminToken:  _testAdminToken,
+	}
+	server := httptest.NewServer(mserver.SetupRouter())
+	t.Cleanup(server.Close)
+
+	res, err := http.Post(server.URL+"/v1/audio/speech", "application/json",
+		bytes.NewReader([]byte(`{"input":"您好, 欢迎致电","voice":"alloy"}`)))
+	assert.Empty(t, err)
+	data, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	assert.Equal(t, "mp3 data", string(data))
+	assert.Equal(t, "MISS", res.Header.Get("X-Cache"))
+	etag := res.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	// GET 与 POST 使用同一缓存, 输入空白与缺省格式不影响命中
+	query := url.Values{"input": {" 您好,  欢迎致电 "}, "voice": {"alloy"}, "response_format": {"mp3"}}
+	res, err = http.Get(server.URL + "/v1/audio/speech?" + query.Encode())
+	assert.Empty(t, err)
+	data, _ = io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	assert.Equal(t, "mp3 data", string(data))
+	assert.Equal(t, "HIT", res.Header.Get("X-Cache"))
+	assert.Equal(t, "audio/mpeg", res.Header.Get("Content-Type"))
+	assert.Equal(t, "8", res.Header.Get("Content-Length"))
+	assert.Equal(t, etag, res.Header.Get("ETag"))
+	assert.Equal(t, int32(1), count.Load())
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/v1/audio/speech?"+query.Encode(), nil)
+	req.Header.Set("If-None-Match", etag)
+	res, err = http.DefaultClient.Do(req)
+	assert.Empty(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusNotModified, res.StatusCode)
+
+	// 管理接口需要令牌
+	req, _ = http.NewRequest(http.MethodDelete, server.URL+"/v1/admin/audio/speech/cache", nil)
+	res, err = http.DefaultClient.Do(req)
+	assert.Empty(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	res = _adminRequest(t, http.MethodDelete, server.URL+"/v1/admin/audio/speech/cache")
+	data, _ = io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	assert.JSONEq(t, `{"purged":1}`, string(data))
+
+	res, err = http.Get(server.URL + "/v1/audio/speech?" + query.Encode())
+	assert.Empty(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, "MISS", res.Header.Get("X-Cache"))
+	assert.Equal(t, int32(2), count.Load())
+}
+
+func TestApiServer_audioSpeechTranscode(t *testing.T) {
+	// 后端只输出 16kHz 双声道 wav, 首尾各带 0.5s 静音
+	pcm := &audio.PCM{SampleRate: 16000, Channels: 2}
+	pcm.Samples = append(pcm.Samples, make([]int16, 16000)...)
+	for i := 0; i < 16000; i++ {
+		v := int16(10000 * math.Sin(2*math.Pi*440*float64(i)/16000))
+		pcm.Samples = append(pcm.Samples, v, v)
+	}
+	pcm.Samples = append(pcm.Samples, make([]int16, 16000)...)
+	sample := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/wav")
+		_, _ = w.Write(pcm.EncodeWAV())
+	}))
+	t.Cleanup(sample.Close)
+
+	bk, err := backend.NewOpenAIStyleBackend(&backend.AdapterConfig{
+		Name:     "sample",
+		Type:     backend.ModelTypeTTS,
+		ApiStyle: "openai",
+		ApiBase:  sample.URL + "/v1/",
+	})
+	assert.Empty(t, err)
+	aServcie := &backend.AdapterService{}
+	aServcie.SetBackend(bk)
+	mserver := &ApiServer{
+		logger:      lib.NewLogger(6, "test", 9),
+		apiBase:     "/v1",
+		aService:    aServcie,
+		audioFrames: map[string]*audio.Audio{},
+	}
+	server := httptest.NewServer(mserver.SetupRouter())
+	t.Cleanup(server.Close)
+
+	// 请求 pcm, 默认转为 24kHz 单声道
+	res, err := http.Post(server.URL+"/v1/audio/speech", "application/json",
+		bytes.NewReader([]byte(`{"input":"您好","voice":"alloy","response_format":"pcm"}`)))
+	assert.Empty(t, err)
+	data, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	assert.Equal(t, "audio/L16;rate=24000", res.Header.Get("Content-Type"))
+	assert.Equal(t, 2*24000*2, len(data))
+
+	// 裁剪静音、变速并重采样
+	res, err = http.Post(server.URL+"/v1/audio/speech", "application/json",
+		bytes.NewReader([]byte(`{"input":"您好","voice":"alloy","response_format":"wav","sample_rate":8000,"trim_silence":true,"tempo":2,"loudness":-20}`)))
+	assert.Empty(t, err)
+	data, _ = io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	assert.Equal(t, "audio/wav", res.Header.Get("Content-Type"))
+	out, err := audio.DecodeWAV(data)
+	assert.Empty(t, err)
+	assert.Equal(t, 8000, out.SampleRate)
+	assert.Equal(t, 2, out.Channels)
+	assert.InDelta(t, 0.55, out.Duration().Seconds(), 0.05)
+	assert.InDelta(t, -20, out.Loudness(), 0.5)
+
+	// 变速倍率与采样率超出范围
+	for _, query := range []string{"tempo=0.0001", "sample_rate=2000000000"} {
+		res, err = http.Get(server.URL + "/v1/audio/speech?input=hi&response_format=wav&" + query)
+		assert.Empty(t, err)
+		_ = res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	}
+
+	// mp3 无法在本地处理
+	res, err = http.Get(server.URL + "/v1/audio/speech?input=hi&tempo=1.5")
+	assert.Empty(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestTranscodeSpeech(t *testing.T) {
+	// 裸数据按 Content-Type 解析
+	out, contentType, err := transcodeSpeech(_tone(16000, 1), "audio/L16;rate=16000", openai.SpeechResponseFormatWav, audio.PostProcessConfig{})
+	assert.Empty(t, err)
+	assert.Equal(t, "audio/wav", contentType)
+	assert.True(t, audio.IsWAV(out))
+
+	// 压缩格式不能当作裸数据处理
+	_, _, err = transcodeSpeech([]byte("ID3\x04\x00\x00\x00\x00\x00\x00"), "audio/mpeg", openai.SpeechResponseFormatPcm, audio.PostProcessConfig{})
+	assert.ErrorIs(t, err, errSpeechNotDecodable)
+	_, _, err = transcodeSpeech([]byte("OggS\x00\x02\x00\x00"), "audio/ogg", openai.SpeechResponseFormatWav, audio.PostProcessConfig{})
+	assert.ErrorIs(t, err, errSpeechNotDecodable)
+}
@@ -0,0 +1,68 @@
+package api_server
+
+import (
+	"cmp"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+	"net/http"
+	"squidward/backend"
+)
+
+const (
+	transcriptionProgress = "transcript.progress"
+	transcriptionDone     = "transcript.done"
+	transcriptionError    = "error"
+)
+
+// transcriptionEvent 长音频识别的 SSE 事件
+type transcriptionEvent struct {
+	Type string `json:"type"`
+	// Completed 已完成的分段数
+	Completed int `json:"completed,omitempty"`
+	// Total 分段总数
+	Total int `json:"total,omitempty"`
+	// Transcription json/verbose_json 格式的识别结果
+	Transcription *openai.AudioResponse `json:"transcription,omitempty"`
+	// RawText LLM 纠错前的原始文本, 未纠错时为空
+	RawText string `json:"raw_text,omitempty"`
+	// Text text/srt/vtt 格式的识别结果
+	Text  string `json:"text,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// audioTranscriptionsStream 以 SSE 推送长音频分段识别进度, 最后推送完整结果
+func (s *ApiServer) audioTranscriptionsStream(c *gin.Context, bk backend.Adapter, req openai.AudioRequest, correct string) {
+	w := c.Writer
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	events := make(chan transcriptionEvent, 16)
+	go func() {
+		defer close(events)
+		ctx := backend.WithProgress(c.Request.Context(), func(done, total int) {
+			events <- transcriptionEvent{Type: transcriptionProgress, Completed: done, Total: total}
+		})
+		res, err := bk.AudioTranscriptions(ctx, req)
+		if err != nil {
+			s.logger.Error(err)
+			events <- transcriptionEvent{Type: transcriptionError, Error: err.Error()}
+			return
+		}
+		if _, ok := transcriptionContentTypes[cmp.Or(backend.ResponseFormat(res), req.Format)]; ok {
+			events <- transcriptionEvent{Type: transcriptionDone, Text: res.Text}
+		} else {
+			raw := s.correctTranscription(ctx, bk, req.Format, correct, &res)
+			events <- transcriptionEvent{Type: transcriptionDone, Transcription: &res, RawText: raw}
+		}
+	}()
+
+	for evt := range events {
+		bs, _ := json.Marshal(evt)
+		_, _ = w.Write([]byte("data: " + string(bs) + "\n\n"))
+		w.Flush()
+	}
+	_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	w.Flush()
+}
@@ -0,0 +1,149 @@
+package api_server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"squidward/backend"
+	"squidward/lib"
+	"squidward/modules/audio"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApiServer_audioTranscriptionsStream(t *testing.T) {
+	sample := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, `{"task":"transcribe","language":"zh","duration":0.9,"text":"你好。","segments":[{"start":0,"end":0.8,"text":"你好。"}]}`)
+	}))
+	t.Cleanup(sample.Close)
+
+	bk, err := backend.NewOpenAIStyleBackend(&backend.AdapterConfig{
+		Name:      "sample",
+		Type:      backend.ModelTypeSTT,
+		ApiStyle:  "openai",
+		ApiBase:   sample.URL + "/v1/",
+		LongAudio: &audio.SplitConfig{MaxDuration: 1500 * time.Millisecond},
+	})
+	assert.Empty(t, err)
+	aServcie := &backend.AdapterService{}
+	aServcie.SetBackend(bk)
+	mserver := &ApiServer{
+		logger:      lib.NewLogger(6, "test", 9),
+		apiBase:     "/v1",
+		aService:    aServcie,
+		audioFrames: map[string]*audio.Audio{},
+	}
+	server := httptest.NewServer(mserver.SetupRouter())
+	t.Cleanup(server.Close)
+
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("file", "meeting.wav")
+	// 三段 0.8s 语音, 各接 0.2s 静音
+	var raw []byte
+	for i := 0; i < 3; i++ {
+		raw = append(raw, _tone(16000, 0.8)...)
+		raw = append(raw, make([]byte, 6400)...)
+	}
+	pcm, _ := audio.DecodeRaw(raw, "audio/L16;rate=16000")
+	_, _ = fw.Write(pcm.EncodeWAV())
+	_ = mw.WriteField("response_format", "srt")
+	_ = mw.WriteField("stream", "true")
+	_ = mw.Close()
+
+	res, err := http.Post(server.URL+"/v1/audio/transcriptions", mw.FormDataContentType(), body)
+	assert.Empty(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	var events []transcriptionEvent
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := strings.TrimPrefix(scanner.Text(), "data: ")
+		if line == "" || line == "[DONE]" {
+			continue
+		}
+		evt := transcriptionEvent{}
+		assert.Empty(t, json.Unmarshal([]byte(line), &evt))
+		events = append(events, evt)
+	}
+
+	assert.Equal(t, 4, len(events))
+	for i, evt := range events[:3] {
+		assert.Equal(t, transcriptionEvent{Type: transcriptionProgress, Completed: i + 1, Total: 3}, evt)
+	}
+	assert.Equal(t, transcriptionDone, events[3].Type)
+	// 切分点位于静音中, 时间戳加上分段偏移
+	assert.Equal(t, "1\n00:00:00,000 --> 00:00:00,800\n你好。\n\n"+
+		"2\n00:00:00,875 --> 00:00:01,675\n你好。\n\n"+
+		"3\n00:00:01,875 --> 00:00:02,675\n你好。\n\n", events[3].Text)
+}
+
+func TestApiServer_audioTranscriptionsCorrection(t *testing.T) {
+	sample := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if strings.HasSuffix(r.URL.Path, "/chat/completions") {
+			fmt.Fprint(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":"请帮我查询鱿鱼哥的订单。"}}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"text":"请帮我查询由于哥的订单"}`)
+	}))
+	t.Cleanup(sample.Close)
+
+	aServcie := &backend.AdapterService{}
+	for _, typ := range []backend.ModelType{backend.ModelTypeSTT, backend.ModelTypeLLM} {
+		bk, err := backend.NewOpenAIStyleBackend(&backend.AdapterConfig{
+			Name:       "sample",
+			Type:       typ,
+			ApiStyle:   "openai",
+			ApiBase:    sample.URL + "/v1/",
+			Correction: &backend.CorrectionConfig{Keys: map[string]bool{"sk-audit": true}},
+		})
+		assert.Empty(t, err)
+		aServcie.SetBackend(bk)
+	}
+	server := httptest.NewServer(NewApiServer(lib.NewLogger(6, "test", 9), aServcie).SetupRouter())
+	t.Cleanup(server.Close)
+
+	transcribe := func(key string, fields map[string]string) map[string]any {
+		body := new(bytes.Buffer)
+		mw := multipart.NewWriter(body)
+		fw, _ := mw.CreateFormFile("file", "call.wav")
+		pcm, _ := audio.DecodeRaw(_tone(16000, 1), "audio/L16;rate=16000")
+		_, _ = fw.Write(pcm.EncodeWAV())
+		for k, v := range fields {
+			_ = mw.WriteField(k, v)
+		}
+		_ = mw.Close()
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/audio/transcriptions", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+key)
+		res, err := http.DefaultClient.Do(req)
+		assert.Empty(t, err)
+		defer res.Body.Close()
+		out := map[string]any{}
+		assert.Empty(t, json.NewDecoder(res.Body).Decode(&out))
+		return out
+	}
+
+	out := transcribe("sk-audit", nil)
+	assert.Equal(t, "请帮我查询鱿鱼哥的订单。", out["text"])
+	assert.Equal(t, "请帮我查询由于哥的订单", out["raw_text"])
+
+	// 请求参数优先于按 key 的配置
+	out = transcribe("sk-audit", map[string]string{"correct": "false"})
+	assert.Equal(t, "请帮我查询由于哥的订单", out["text"])
+	assert.NotContains(t, out, "raw_text")
+
+	out = transcribe("sk-other", nil)
+	assert.NotContains(t, out, "raw_text")
+	out = transcribe("sk-other", map[string]string{"correct": "true"})
+	assert.Equal(t, "请帮我查询由于哥的订单", out["raw_text"])
+}
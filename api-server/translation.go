@@ -0,0 +1,296 @@
+package api_server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"squidward/backend"
+	"squidward/modules/subtitle"
+	"strconv"
+	"strings"
+)
+
+// translateBatchSize 单次请求 LLM 翻译的最大分段数
+const translateBatchSize = 40
+
+// translationLanguages 目标语言代码在提示词中的名称, 未列出的原样使用
+var translationLanguages = map[string]string{
+	"zh":      "Simplified Chinese (Mandarin)",
+	"zh-hans": "Simplified Chinese (Mandarin)",
+	"zh-hant": "Traditional Chinese (Mandarin)",
+	"yue":     "Cantonese, written in Traditional Chinese characters",
+	"en":      "English",
+	"ja":      "Japanese",
+	"ko":      "Korean",
+}
+
+// speechTranslationSegment 译文分段, 沿用原文的时间轴
+type speechTranslationSegment struct {
+	ID         int     `json:"id"`
+	Start      float64 `json:"start"`
+	End        float64 `json:"end"`
+	SourceText string  `json:"source_text"`
+	Text       string  `json:"text"`
+}
+
+type speechTranslationAudio struct {
+	Format string `json:"format"`
+	Data   string `json:"data"`
+}
+
+// speechTranslation 语音翻译结果, 指定 voice 时附带译文的合成音频
+type speechTranslation struct {
+	Task           string                     `json:"task"`
+	Language       string                     `json:"language"`
+	TargetLanguage string                     `json:"target_language"`
+	Duration       float64                    `json:"duration,omitempty"`
+	SourceText     string                     `json:"source_text"`
+	Text           string                     `json:"text"`
+	Segments       []speechTranslationSegment `json:"segments"`
+	Audio          *speechTranslationAudio    `json:"audio,omitempty"`
+}
+
+// audioTranslations 语音翻译, 默认与 OpenAI 相同由 STT 后端翻译为英文
+// 指定 target_language 时经 STT 识别、LLM 翻译为目标语言, 指定 voice 时再由 TTS 合成译文
+func (s *ApiServer) audioTranslations(c *gin.Context) {
+	bk := s.aService.GetBackend(backend.ModelTypeSTT)
+	if bk == nil {
+		s.logger.Error("未配置STT")
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	limits := uploadLimits(bk)
+	limitRequestBody(c, limits)
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		if !writeUploadError(c, err) {
+			c.Status(http.StatusBadRequest)
+		}
+		return
+	}
+
+	if _, hasf := form.File["file"]; !hasf {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	data, err := readUpload(c, form.File["file"][0], limits)
+	if err != nil {
+		if !writeUploadError(c, err) {
+			c.Status(http.StatusBadRequest)
+		}
+		return
+	}
+
+	req := openai.AudioRequest{
+		Model:    formValue(form, "model"),
+		Reader:   bytes.NewReader(data),
+		FilePath: form.File["file"][0].Filename,
+		Prompt:   formValue(form, "prompt"),
+		Format:   openai.AudioResponseFormat(formValue(form, "response_format")),
+	}
+	if temperature, errt := strconv.ParseFloat(formValue(form, "temperature"), 32); errt == nil {
+		req.Temperature = float32(temperature)
+	}
+
+	if target := formValue(form, "target_language"); target != "" {
+		s.speechTranslations(c, bk, req, target, form)
+		return
+	}
+
+	res, err := bk.AudioTranslations(clientContext(c), req)
+	if err != nil {
+		s.logger.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	writeTranscription(c, req.Format, res, "")
+}
+
+// speechTranslations 识别后按分段翻译, 保留原文的时间轴
+func (s *ApiServer) speechTranslations(c *gin.Context, stt backend.Adapter, req openai.AudioRequest, target string, form *multipart.Form) {
+	llm := s.aService.GetBackend(backend.ModelTypeLLM)
+	tts := s.aService.GetBackend(backend.ModelTypeTTS)
+	voice := formValue(form, "voice")
+	// 合成的语音只能放在 json 结果中
+	if _, ok := transcriptionContentTypes[req.Format]; ok && voice != "" {
+		writeAPIError(c, http.StatusBadRequest, "", "voice", "voice requires response_format json or verbose_json")
+		return
+	}
+	if llm == nil || voice != "" && tts == nil {
+		s.logger.Error("语音翻译需要配置LLM, 合成语音时还需要配置TTS")
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	ctx := clientContext(c)
+
+	// 需要分段时间戳, 输出格式在翻译后处理
+	format := req.Format
+	req.Format = openai.AudioResponseFormatVerboseJSON
+	req.TimestampGranularities = []openai.TranscriptionTimestampGranularity{openai.TranscriptionTimestampGranularitySegment}
+	req.Language = formValue(form, "language")
+	transcript, err := stt.AudioTranscriptions(ctx, req)
+	if err != nil {
+		s.logger.Error(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	result := speechTranslation{
+		Task:           "translate",
+		Language:       transcript.Language,
+		TargetLanguage: target,
+		Duration:       transcript.Duration,
+		SourceText:     transcript.Text,
+		Segments:       []speechTranslationSegment{},
+	}
+	var segments []speechTranslationSegment
+	for _, seg := range transcript.Segments {
+		if strings.TrimSpace(seg.Text) != "" {
+			segments = append(segments, speechTranslationSegment{Start: seg.Start, End: seg.End, SourceText: strings.TrimSpace(seg.Text)})
+		}
+	}
+	// 后端未返回分段时整段翻译
+	if len(segments) == 0 && strings.TrimSpace(transcript.Text) != "" {
+		segments = append(segments, speechTranslationSegment{End: transcript.Duration, SourceText: strings.TrimSpace(transcript.Text)})
+	}
+
+	for i := 0; i < len(segments); i += translateBatchSize {
+		batch, errt := translateSegments(ctx, llm, formValue(form, "llm_model"), target, segments[i:min(i+translateBatchSize, len(segments))])
+		if errt != nil {
+			s.logger.Error(errt)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		result.Segments = append(result.Segments, batch...)
+	}
+	for i := range result.Segments {
+		result.Segments[i].ID = i
+		result.Text = backend.JoinText(result.Text, result.Segments[i].Text)
+	}
+
+	switch format {
+	case openai.AudioResponseFormatText:
+		c.Data(http.StatusOK, transcriptionContentTypes[format], []byte(result.Text))
+		return
+	case openai.AudioResponseFormatSRT, openai.AudioResponseFormatVTT:
+		subSegments := make([]subtitle.Segment, 0, len(result.Segments))
+		for _, seg := range result.Segments {
+			subSegments = append(subSegments, subtitle.Segment{Start: seg.Start, End: seg.End, Text: seg.Text})
+		}
+		cues := subtitle.Cues(subSegments, subtitle.Config{})
+		text := subtitle.SRT(cues)
+		if format == openai.AudioResponseFormatVTT {
+			text = subtitle.VTT(cues)
+		}
+		c.Data(http.StatusOK, transcriptionContentTypes[format], []byte(text))
+		return
+	}
+
+	if voice != "" && strings.TrimSpace(result.Text) != "" {
+		speechReq := openai.CreateSpeechRequest{
+			Model:          openai.SpeechModel(formValue(form, "tts_model")),
+			Input:          result.Text,
+			Voice:          openai.SpeechVoice(voice),
+			ResponseFormat: openai.SpeechResponseFormat(formValue(form, "speech_format")),
+		}
+		speech, errs := tts.AudioSpeech(ctx, speechReq)
+		if errs != nil {
+			s.logger.Error(errs)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		audioData, errr := io.ReadAll(speech)
+		_ = speech.Close()
+		if errr != nil {
+			s.logger.Error(errr)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		result.Audio = &speechTranslationAudio{
+			Format: speechContentType(speech.Header(), speechReq.ResponseFormat),
+			Data:   base64.StdEncoding.EncodeToString(audioData),
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// translateSegments 以 json 数组请求 LLM 逐段翻译, 返回的段数不一致时合并为一段翻译
+func translateSegments(ctx context.Context, llm backend.Adapter, model, target string, segments []speechTranslationSegment) ([]speechTranslationSegment, error) {
+	language := target
+	if name, ok := translationLanguages[strings.ToLower(target)]; ok {
+		language = name
+	}
+	texts := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		texts = append(texts, seg.SourceText)
+	}
+	input, _ := json.Marshal(texts)
+
+	reply, err := chatText(ctx, llm, model, fmt.Sprintf("You are a professional interpreter. "+
+		"Translate each item of the JSON array from the user into %s. "+
+		"Reply with only a JSON array of strings with the same number of items in the same order.", language), string(input))
+	if err != nil {
+		return nil, err
+	}
+	var translated []string
+	if json.Unmarshal([]byte(trimCodeFence(reply)), &translated) == nil && len(translated) == len(segments) {
+		out := make([]speechTranslationSegment, len(segments))
+		for i, seg := range segments {
+			seg.Text = strings.TrimSpace(translated[i])
+			out[i] = seg
+		}
+		return out, nil
+	}
+
+	merged := speechTranslationSegment{Start: segments[0].Start, End: segments[len(segments)-1].End}
+	for _, text := range texts {
+		merged.SourceText = backend.JoinText(merged.SourceText, text)
+	}
+	reply, err = chatText(ctx, llm, model, fmt.Sprintf("You are a professional interpreter. "+
+		"Translate the text from the user into %s. Reply with only the translation.", language), merged.SourceText)
+	if err != nil {
+		return nil, err
+	}
+	merged.Text = strings.TrimSpace(reply)
+	return []speechTranslationSegment{merged}, nil
+}
+
+// chatText 单轮请求 LLM, 返回第一条回复的文本
+func chatText(ctx context.Context, llm backend.Adapter, model, system, user string) (string, error) {
+	res, err := llm.ChatCompletions(ctx, openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: system},
+			{Role: openai.ChatMessageRoleUser, Content: user},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(res.Choices) == 0 {
+		return "", nil
+	}
+	return res.Choices[0].Message.Content, nil
+}
+
+// trimCodeFence 去除 LLM 回复中包裹 json 的 markdown 代码块
+func trimCodeFence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+	text = strings.TrimPrefix(text, "```")
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[i+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+}
@@ -0,0 +1,129 @@
+package api_server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"squidward/backend"
+	"squidward/lib"
+	"squidward/modules/audio"
+	"strings"
+	"testing"
+)
+
+func _initSampleTranslationServer(t *testing.T, reply string) *httptest.Server {
+	sample := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/audio/translations"):
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			fmt.Fprint(w, `{"text":"What is one plus two?"}`)
+		case strings.HasSuffix(r.URL.Path, "/audio/transcriptions"):
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			fmt.Fprint(w, `{"task":"transcribe","language":"chinese","duration":3,"text":"一加二等于几?请回答。",`+
+				`"segments":[{"id":0,"start":0,"end":1.5,"text":"一加二等于几?"},{"id":1,"start":1.5,"end":3,"text":"请回答。"}]}`)
+		case strings.HasSuffix(r.URL.Path, "/chat/completions"):
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			bs, _ := json.Marshal(reply)
+			fmt.Fprintf(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":%s}}]}`, bs)
+		case strings.HasSuffix(r.URL.Path, "/audio/speech"):
+			pcm, _ := audio.DecodeRaw(_tone(16000, 0.5), "audio/L16;rate=16000")
+			w.Header().Set("Content-Type", "audio/wav")
+			_, _ = w.Write(pcm.EncodeWAV())
+		}
+	}))
+	t.Cleanup(sample.Close)
+
+	aServcie := &backend.AdapterService{}
+	for _, typ := range []backend.ModelType{backend.ModelTypeSTT, backend.ModelTypeLLM, backend.ModelTypeTTS} {
+		bk, err := backend.NewOpenAIStyleBackend(&backend.AdapterConfig{
+			Name:     "sample",
+			Type:     typ,
+			ApiStyle: "openai",
+			ApiBase:  sample.URL + "/v1/",
+		})
+		assert.Empty(t, err)
+		aServcie.SetBackend(bk)
+	}
+	server := httptest.NewServer(NewApiServer(lib.NewLogger(6, "test", 9), aServcie).SetupRouter())
+	t.Cleanup(server.Close)
+	return server
+}
+
+func _translationRequest(t *testing.T, url string, fields map[string]string) (*http.Response, []byte) {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("file", "call.wav")
+	pcm, _ := audio.DecodeRaw(_tone(16000, 1), "audio/L16;rate=16000")
+	_, _ = fw.Write(pcm.EncodeWAV())
+	for k, v := range fields {
+		_ = mw.WriteField(k, v)
+	}
+	_ = mw.Close()
+
+	res, err := http.Post(url+"/v1/audio/translations", mw.FormDataContentType(), body)
+	assert.Empty(t, err)
+	defer res.Body.Close()
+	data, _ := io.ReadAll(res.Body)
+	return res, data
+}
+
+func TestApiServer_audioTranslations(t *testing.T) {
+	server := _initSampleTranslationServer(t, `["What is one plus two?","Please answer."]`)
+
+	// OpenAI 兼容模式
+	res, data := _translationRequest(t, server.URL, nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, string(data), `"text":"What is one plus two?"`)
+
+	res, data = _translationRequest(t, server.URL, map[string]string{"target_language": "en", "voice": "alloy", "speech_format": "wav"})
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	result := speechTranslation{}
+	assert.Empty(t, json.Unmarshal(data, &result))
+	assert.Equal(t, "chinese", result.Language)
+	assert.Equal(t, "一加二等于几?请回答。", result.SourceText)
+	assert.Equal(t, "What is one plus two? Please answer.", result.Text)
+	assert.Equal(t, []speechTranslationSegment{
+		{ID: 0, Start: 0, End: 1.5, SourceText: "一加二等于几?", Text: "What is one plus two?"},
+		{ID: 1, Start: 1.5, End: 3, SourceText: "请回答。", Text: "Please answer."},
+	}, result.Segments)
+	assert.Equal(t, "audio/wav", result.Audio.Format)
+	speech, _ := base64.StdEncoding.DecodeString(result.Audio.Data)
+	assert.True(t, audio.IsWAV(speech))
+
+	res, data = _translationRequest(t, server.URL, map[string]string{"target_language": "en", "response_format": "srt"})
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "1\n00:00:00,000 --> 00:00:01,500\nWhat is one plus two?\n\n2\n00:00:01,500 --> 00:00:03,000\nPlease answer.\n\n", string(data))
+
+	// 纯文本与字幕格式无法携带合成的语音
+	res, data = _translationRequest(t, server.URL, map[string]string{"target_language": "en", "voice": "alloy", "response_format": "text"})
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	apiErr := apiErrorResponse{}
+	assert.Empty(t, json.Unmarshal(data, &apiErr))
+	assert.Equal(t, "voice", *apiErr.Error.Param)
+}
+
+func TestApiServer_audioTranslationsMerged(t *testing.T) {
+	// 返回的段数不一致时合并为一段
+	server := _initSampleTranslationServer(t, "```json\n[\"What is one plus two? Please answer.\"]\n```")
+
+	res, data := _translationRequest(t, server.URL, map[string]string{"target_language": "yue"})
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	result := speechTranslation{}
+	assert.Empty(t, json.Unmarshal(data, &result))
+	assert.Equal(t, 1, len(result.Segments))
+	assert.Equal(t, float64(0), result.Segments[0].Start)
+	assert.Equal(t, float64(3), result.Segments[0].End)
+	assert.Equal(t, "一加二等于几?请回答。", result.Segments[0].SourceText)
+	assert.Nil(t, result.Audio)
+}
+
+func TestTrimCodeFence(t *testing.T) {
+	assert.Equal(t, `["a"]`, trimCodeFence("```json\n[\"a\"]\n```"))
+	assert.Equal(t, `["a"]`, trimCodeFence(` ["a"] `))
+}
@@ -0,0 +1,173 @@
+package api_server
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"squidward/backend"
+	"squidward/modules/audio"
+	"squidward/modules/sttws"
+)
+
+// multipartOverhead 表单其他字段与分隔符预留的字节数
+const multipartOverhead = 1 << 20
+
+// uploadLimits STT 后端的上传限制, 后端不支持时不限制
+func uploadLimits(bk backend.Adapter) audio.Limits {
+	if limiter, ok := bk.(backend.UploadLimiter); ok {
+		return limiter.UploadLimits()
+	}
+	return audio.Limits{}
+}
+
+// limitRequestBody 按文件大小上限限制请求体, 超出时解析表单返回 *http.MaxBytesError
+func limitRequestBody(c *gin.Context, limits audio.Limits) {
+	if limits.MaxFileSize > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limits.MaxFileSize+multipartOverhead)
+	}
+}
+
+// readUpload 读取上传的完整音频, 检查内容与声明的类型一致且未超出限制
+// 声明的 mime 记录到请求上下文, 供后端解码无文件头的裸数据
+func readUpload(c *gin.Context, fh *multipart.FileHeader, limits audio.Limits) ([]byte, error) {
+	if limits.MaxFileSize > 0 && fh.Size > limits.MaxFileSize {
+		return nil, &audio.LimitError{Code: audio.LimitFileSize, Message: "audio file exceeds the maximum size"}
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	mime := audio.DeclaredMime(fh.Header.Get("Content-Type"), fh.Filename)
+	if err = audio.CheckContent(data, mime); err != nil {
+		return nil, err
+	}
+	c.Request = c.Request.WithContext(backend.WithAudioMime(c.Request.Context(), mime))
+	return data, limits.CheckFile(data, mime)
+}
+
+// checkUploadFrame 写入一帧前检查, 首帧同时检查内容与声明的类型一致
+func checkUploadFrame(af *audio.Audio, index int, data []byte, limits audio.Limits) error {
+	if index == 0 && len(data) > 0 {
+		if err := audio.CheckContent(data, af.Mime); err != nil {
+			return err
+		}
+	}
+	return limits.CheckFrame(af, index, data)
+}
+
+// streamUpload 流式上传的累计帧数与字节数, VAD 模式下语音段识别后不保留音频, 单独计数
+type streamUpload struct {
+	limits audio.Limits
+	mime   string
+	frames int
+	size   int
+}
+
+// write 收到一帧时检查, 超出限制的帧不计入
+func (u *streamUpload) write(data []byte) error {
+	if u.size == 0 && len(data) > 0 {
+		if err := audio.CheckContent(data, u.mime); err != nil {
+			return err
+		}
+	}
+	if err := u.limits.CheckStream(u.mime, u.frames+1, u.size+len(data), data); err != nil {
+		return err
+	}
+	u.frames++
+	u.size += len(data)
+	return nil
+}
+
+// apiErrorBody OpenAI 风格的错误
+type apiErrorBody struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
+
+type apiErrorResponse struct {
+	Error apiErrorBody `json:"error"`
+}
+
+func newAPIError(code, param, message string) apiErrorResponse {
+	body := apiErrorBody{Message: message, Type: "invalid_request_error"}
+	if param != "" {
+		body.Param = &param
+	}
+	if code != "" {
+		body.Code = &code
+	}
+	return apiErrorResponse{Error: body}
+}
+
+// writeAPIError 输出 OpenAI 风格的错误
+func writeAPIError(c *gin.Context, status int, code, param, message string) {
+	c.AbortWithStatusJSON(status, newAPIError(code, param, message))
+}
+
+// uploadError 上传检查错误对应的状态码与 OpenAI 风格错误, 其他错误返回 false
+func uploadError(err error) (int, apiErrorResponse, bool) {
+	var limitErr *audio.LimitError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &limitErr):
+		status := http.StatusBadRequest
+		if limitErr.Code == audio.LimitFileSize || limitErr.Code == audio.LimitFrameSize {
+			status = http.StatusRequestEntityTooLarge
+		}
+		return status, newAPIError(limitErr.Code, "file", limitErr.Message), true
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge, newAPIError(audio.LimitFileSize, "file", "request body exceeds the maximum size"), true
+	case errors.Is(err, audio.ErrMimeMismatch):
+		return http.StatusBadRequest, newAPIError("invalid_file_format", "file", err.Error()), true
+	case errors.Is(err, audio.ErrUnsupportedMime):
+		return http.StatusBadRequest, newAPIError("invalid_file_format", "file", "unsupported or unrecognized audio format"), true
+	case errors.Is(err, backend.ErrLongAudioUnsplittable):
+		return http.StatusRequestEntityTooLarge, newAPIError(audio.LimitFileSize, "file", backend.ErrLongAudioUnsplittable.Error()), true
+	}
+	return 0, apiErrorResponse{}, false
+}
+
+// wsUploadError 旧协议的上传错误, 推送后丢弃该音频
+type wsUploadError struct {
+	Type    string `json:"type"`
+	AudioID string `json:"audio_id,omitempty"`
+	apiErrorResponse
+}
+
+func (s *ApiServer) wsUploadError(conn *wsConn, audioID string, err error) {
+	_, res, _ := uploadError(err)
+	if errw := conn.WriteJSON(wsUploadError{Type: "error", AudioID: audioID, apiErrorResponse: res}); errw != nil {
+		s.logger.Debug(errw)
+	}
+}
+
+// wsErrorCode 结构化协议中上传检查错误的错误码
+func wsErrorCode(err error) string {
+	var limitErr *audio.LimitError
+	switch {
+	case errors.As(err, &limitErr):
+		return limitErr.Code
+	case errors.Is(err, audio.ErrMimeMismatch), errors.Is(err, audio.ErrUnsupportedMime):
+		return sttws.ErrCodeUnsupportedMime
+	}
+	return sttws.ErrCodeInvalidMessage
+}
+
+// writeUploadError 输出上传检查错误, 其他错误返回 false
+func writeUploadError(c *gin.Context, err error) bool {
+	status, res, ok := uploadError(err)
+	if ok {
+		c.AbortWithStatusJSON(status, res)
+	}
+	return ok
+}
@@ -0,0 +1,136 @@
+package api_server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"squidward/backend"
+	"squidward/lib"
+	"squidward/modules/audio"
+	"squidward/modules/sttws"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func _initLimitedSTTServer(t *testing.T, limits audio.Limits) (*httptest.Server, *atomic.Int32) {
+	count := &atomic.Int32{}
+	sample := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count.Add(1)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_, _ = w.Write([]byte(`{"text":"ok"}`))
+	}))
+	t.Cleanup(sample.Close)
+
+	bkSTT, err := backend.NewOpenAIStyleBackend(&backend.AdapterConfig{
+		Name:     "sample",
+		Type:     backend.ModelTypeSTT,
+		ApiStyle: "openai",
+		ApiBase:  sample.URL + "/v1/",
+		Upload:   &limits,
+	})
+	assert.Empty(t, err)
+
+	aServcie := &backend.AdapterService{}
+	aServcie.SetBackend(bkSTT)
+	mserver := NewApiServer(lib.NewLogger(6, "test", 9), aServcie)
+	server := httptest.NewServer(mserver.SetupRouter())
+	t.Cleanup(server.Close)
+	return server, count
+}
+
+func _postUpload(t *testing.T, url, filename string, data []byte, fields map[string]string) (int, apiErrorResponse) {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("file", filename)
+	_, _ = fw.Write(data)
+	for k, v := range fields {
+		_ = mw.WriteField(k, v)
+	}
+	_ = mw.Close()
+
+	res, err := http.Post(url+"/v1/audio/transcriptions", mw.FormDataContentType(), body)
+	assert.Empty(t, err)
+	defer res.Body.Close()
+	apiErr := apiErrorResponse{}
+	_ = json.NewDecoder(res.Body).Decode(&apiErr)
+	return res.StatusCode, apiErr
+}
+
+func TestApiServer_audioTranscriptionsLimits(t *testing.T) {
+	server, count := _initLimitedSTTServer(t, audio.Limits{
+		MaxFileSize:   64000,
+		MaxFrameSize:  8000,
+		MaxDuration:   2 * time.Second,
+		MaxSampleRate: 16000,
+	})
+	wav := func(rate int, seconds float64) []byte {
+		pcm, _ := audio.DecodeRaw(_tone(rate, seconds), "audio/L16;rate="+strconv.Itoa(rate))
+		return pcm.EncodeWAV()
+	}
+
+	status, _ := _postUpload(t, server.URL, "a.wav", wav(8000, 1), nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	status, apiErr := _postUpload(t, server.URL, "a.wav", wav(8000, 5), nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+	assert.Equal(t, audio.LimitFileSize, *apiErr.Error.Code)
+	assert.Equal(t, "file", *apiErr.Error.Param)
+	assert.Equal(t, "invalid_request_error", apiErr.Error.Type)
+
+	status, apiErr = _postUpload(t, server.URL, "a.wav", wav(8000, 3), nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, audio.LimitDuration, *apiErr.Error.Code)
+
+	status, apiErr = _postUpload(t, server.URL, "a.wav", wav(22050, 0.5), nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, audio.LimitSampleRate, *apiErr.Error.Code)
+
+	// 扩展名与内容不符
+	status, apiErr = _postUpload(t, server.URL, "a.mp3", wav(8000, 1), nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalid_file_format", *apiErr.Error.Code)
+
+	// 分帧上传逐帧检查
+	frame := map[string]string{"is_frame": "1", "audio_id": "f1", "audio_mime": "audio/L16;rate=8000", "frame_index": "0", "is_finish": "0"}
+	status, apiErr = _postUpload(t, server.URL, "frame.pcm", _tone(8000, 1), frame)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+	assert.Equal(t, audio.LimitFrameSize, *apiErr.Error.Code)
+
+	// 裸数据的首帧不能带文件头
+	status, apiErr = _postUpload(t, server.URL, "frame.pcm", wav(8000, 0.1), frame)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalid_file_format", *apiErr.Error.Code)
+
+	// 超出限制的请求不会发送到后端
+	assert.Equal(t, int32(1), count.Load())
+}
+
+func TestApiServer_wsAudioTranscriptionsLimits(t *testing.T) {
+	server, _ := _initLimitedSTTServer(t, audio.Limits{MaxDuration: time.Second})
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/audio/transcriptions/ws"
+	client, err := sttws.Dial(context.Background(), url, nil, sttws.ProtocolV1)
+	assert.Empty(t, err)
+	defer client.Close()
+
+	assert.Empty(t, client.Start(sttws.ClientMessage{AudioID: "a1", Mime: "audio/L16;rate=8000"}))
+	_, err = client.Recv()
+	assert.Empty(t, err)
+	assert.Empty(t, client.SendAudio(_tone(8000, 0.8)))
+	assert.Empty(t, client.SendAudio(_tone(8000, 0.8)))
+	_, err = client.Recv()
+	assert.Equal(t, audio.LimitDuration, err.(*sttws.Error).Code)
+
+	// 已收到的音频仍可识别
+	assert.Empty(t, client.Stop())
+	msg, err := client.Recv()
+	assert.Empty(t, err)
+	assert.Equal(t, "ok", msg.Text)
+}
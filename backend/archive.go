@@ -0,0 +1,140 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/sashabaranov/go-openai"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"path/filepath"
+	"squidward/modules/archive"
+	"squidward/modules/audio"
+	"strings"
+	"time"
+)
+
+// HeaderArchiveID 响应头, 存档的请求返回存档id
+const HeaderArchiveID = "X-Archive-Id"
+
+// Archiver 支持存档的后端
+type Archiver interface {
+	Archive() *archive.Archive
+}
+
+type noArchiveKey struct{}
+
+// WithoutArchive 不存档该请求, 用于中间结果等重复识别
+func WithoutArchive(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noArchiveKey{}, true)
+}
+
+func archiveEnabled(ctx context.Context, a *archive.Archive) bool {
+	if a == nil {
+		return false
+	}
+	if skip, _ := ctx.Value(noArchiveKey{}).(bool); skip {
+		return false
+	}
+	return a.Enabled(APIKey(ctx))
+}
+
+// archiveTranscription 存档识别的原始音频与结果, 在响应头中返回存档id, 存档失败只记录日志
+func archiveTranscription(ctx context.Context, a *archive.Archive, request openai.AudioRequest, data []byte, res *openai.AudioResponse) {
+	now := time.Now()
+	rec := archive.Record{
+		ID:      archive.NewID(now),
+		Created: now,
+		Kind:    archive.KindTranscription,
+		Key:     APIKey(ctx),
+		Model:   request.Model,
+		Text:    res.Text,
+		Format:  string(request.Format),
+	}
+	if _, duration, ok := audio.Probe(data, ""); ok {
+		rec.Duration = duration.Seconds()
+	} else {
+		rec.Duration = res.Duration
+	}
+	header := res.Header().Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set(HeaderArchiveID, rec.ID)
+	res.SetHeader(header)
+
+	ext := strings.ToLower(filepath.Ext(request.FilePath))
+	if ext == "" {
+		ext = ".bin"
+	}
+	transcript, _ := json.Marshal(*res)
+	go saveArchive(context.WithoutCancel(ctx), a, rec, map[string][]byte{
+		"audio" + ext:     data,
+		"transcript.json": transcript,
+	})
+}
+
+// archiveSpeech 客户端读完合成的音频后存档输入文本与音频, 在响应头中返回存档id
+func archiveSpeech(ctx context.Context, a *archive.Archive, request openai.CreateSpeechRequest, res openai.RawResponse) openai.RawResponse {
+	now := time.Now()
+	rec := archive.Record{
+		ID:      archive.NewID(now),
+		Created: now,
+		Kind:    archive.KindSpeech,
+		Key:     APIKey(ctx),
+		Model:   string(request.Model),
+		Text:    request.Input,
+		Voice:   string(request.Voice),
+		Format:  string(request.ResponseFormat),
+	}
+	ext := "." + string(request.ResponseFormat)
+	if request.ResponseFormat == "" {
+		ext = ".mp3"
+	}
+	contentType := res.Header().Get("Content-Type")
+
+	out := openai.RawResponse{ReadCloser: &archiveReader{
+		ReadCloser: res.ReadCloser,
+		done: func(data []byte) {
+			if _, duration, ok := audio.Probe(data, contentType); ok {
+				rec.Duration = duration.Seconds()
+			}
+			go saveArchive(context.WithoutCancel(ctx), a, rec, map[string][]byte{
+				"input.txt":    []byte(request.Input),
+				"speech" + ext: data,
+			})
+		},
+	}}
+	header := res.Header().Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set(HeaderArchiveID, rec.ID)
+	out.SetHeader(header)
+	return out
+}
+
+func saveArchive(ctx context.Context, a *archive.Archive, rec archive.Record, files map[string][]byte) {
+	if rec, err := a.Save(ctx, rec, files); err != nil {
+		logrus.WithField("prefix", "archive").Errorf("save %s %s: %v", rec.Kind, rec.ID, err)
+	}
+}
+
+// archiveReader 记录读取的数据, 读到结尾时回调, 未读完即关闭不回调
+type archiveReader struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	done func(data []byte)
+}
+
+func (r *archiveReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.buf.Write(p[:n])
+	if errors.Is(err, io.EOF) && r.done != nil {
+		r.done(r.buf.Bytes())
+		r.done = nil
+	}
+	return n, err
+}
@@ -0,0 +1,247 @@
+package backend
+
+import (
+	"errors"
+	"github.com/sashabaranov/go-openai"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	// CompletionsAuto 先请求原生接口, 后端不支持时改用聊天接口
+	CompletionsAuto = ""
+	// CompletionsNative 只使用原生 /completions 接口
+	CompletionsNative = "native"
+	// CompletionsChat 只使用聊天接口包装
+	CompletionsChat = "chat"
+)
+
+// maxChatTopLogprobs 聊天接口 top_logprobs 的上限
+const maxChatTopLogprobs = 20
+
+var (
+	ErrCompletionPrompt = errors.New("prompt must be a string or an array of strings")
+	ErrCompletionStream = errors.New("streaming with multiple prompts is not supported by this backend")
+)
+
+const (
+	completionPrompt = "You are a text completion engine. Continue the text from the user exactly where it ends. " +
+		"Reply with only the continuation, without repeating the text or adding any explanation."
+	completionSuffixPrompt = "You are a text completion engine. The user gives the text before and after a gap " +
+		"in <prefix> and <suffix>. Reply with only the text that fills the gap, without repeating the prefix or suffix."
+)
+
+// CompletionStream 文本补全流, 原生接口与聊天接口包装共用
+type CompletionStream interface {
+	Recv() (openai.CompletionResponse, error)
+	Close() error
+}
+
+// completionsUnsupported 后端没有原生补全接口
+func completionsUnsupported(err error) bool {
+	status := 0
+	apiErr := &openai.APIError{}
+	reqErr := &openai.RequestError{}
+	if errors.As(err, &apiErr) {
+		status = apiErr.HTTPStatusCode
+	} else if errors.As(err, &reqErr) {
+		status = reqErr.HTTPStatusCode
+	}
+	return status == http.StatusNotFound || status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented
+}
+
+// completionPrompts 拆分批量提示词, 不支持 token 数组
+func completionPrompts(prompt any) ([]string, error) {
+	switch v := prompt.(type) {
+	case nil:
+		return []string{""}, nil
+	case string:
+		return []string{v}, nil
+	case []string:
+		if len(v) > 0 {
+			return v, nil
+		}
+	case []any:
+		prompts := make([]string, 0, len(v))
+		for _, p := range v {
+			s, ok := p.(string)
+			if !ok {
+				return nil, ErrCompletionPrompt
+			}
+			prompts = append(prompts, s)
+		}
+		if len(prompts) > 0 {
+			return prompts, nil
+		}
+	}
+	return nil, ErrCompletionPrompt
+}
+
+// completionChatRequest 将补全请求包装为单轮聊天, best_of 大于 n 时多生成候选并按对数概率挑选
+func completionChatRequest(request openai.CompletionRequest, prompt string) openai.ChatCompletionRequest {
+	system, user := completionPrompt, prompt
+	if request.Suffix != "" {
+		system, user = completionSuffixPrompt, "<prefix>"+prompt+"</prefix>\n<suffix>"+request.Suffix+"</suffix>"
+	}
+	req := openai.ChatCompletionRequest{
+		Model: request.Model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: system},
+			{Role: openai.ChatMessageRoleUser, Content: user},
+		},
+		MaxTokens:        request.MaxTokens,
+		Temperature:      request.Temperature,
+		TopP:             request.TopP,
+		N:                max(request.N, request.BestOf),
+		Stop:             request.Stop,
+		PresencePenalty:  request.PresencePenalty,
+		FrequencyPenalty: request.FrequencyPenalty,
+		Seed:             request.Seed,
+		User:             request.User,
+		LogProbs:         request.LogProbs > 0 || request.BestOf > max(request.N, 1),
+		TopLogProbs:      min(request.LogProbs, maxChatTopLogprobs),
+	}
+	if req.N == 1 {
+		req.N = 0
+	}
+	return req
+}
+
+// completionLogprobs 聊天接口的 token 对数概率转换为补全格式, offset 为文本起始偏移
+func completionLogprobs(tokens []openai.LogProb, offset int) openai.LogprobResult {
+	result := openai.LogprobResult{}
+	for _, token := range tokens {
+		top := make(map[string]float32, len(token.TopLogProbs))
+		for _, t := range token.TopLogProbs {
+			top[t.Token] = float32(t.LogProb)
+		}
+		result.Tokens = append(result.Tokens, token.Token)
+		result.TokenLogprobs = append(result.TokenLogprobs, float32(token.LogProb))
+		result.TopLogprobs = append(result.TopLogprobs, top)
+		result.TextOffset = append(result.TextOffset, offset)
+		offset += len(token.Token)
+	}
+	return result
+}
+
+// completionFromChat 聊天回复转换为补全结果, 按提示词顺序编号, 每个提示词保留 n 个候选
+func completionFromChat(request openai.CompletionRequest, prompts []string, responses []openai.ChatCompletionResponse) openai.CompletionResponse {
+	n := max(request.N, 1)
+	res := openai.CompletionResponse{
+		Object:  "text_completion",
+		Created: time.Now().Unix(),
+		Model:   request.Model,
+		Choices: []openai.CompletionChoice{},
+	}
+	for i, chat := range responses {
+		if res.ID == "" {
+			res.ID, res.Created, res.Model = chat.ID, chat.Created, chat.Model
+		}
+		res.Usage.PromptTokens += chat.Usage.PromptTokens
+		res.Usage.CompletionTokens += chat.Usage.CompletionTokens
+		res.Usage.TotalTokens += chat.Usage.TotalTokens
+
+		choices := chat.Choices
+		if len(choices) > n {
+			// 与 OpenAI 相同, 按平均每个 token 的对数概率挑选候选
+			score := func(ch openai.ChatCompletionChoice) float64 {
+				if ch.LogProbs == nil || len(ch.LogProbs.Content) == 0 {
+					return 0
+				}
+				sum := float64(0)
+				for _, token := range ch.LogProbs.Content {
+					sum += token.LogProb
+				}
+				return sum / float64(len(ch.LogProbs.Content))
+			}
+			choices = append([]openai.ChatCompletionChoice{}, choices...)
+			sort.SliceStable(choices, func(a, b int) bool { return score(choices[a]) > score(choices[b]) })
+			choices = choices[:n]
+		}
+
+		for j, ch := range choices {
+			choice := openai.CompletionChoice{
+				Text:         ch.Message.Content,
+				Index:        i*n + j,
+				FinishReason: string(ch.FinishReason),
+			}
+			if request.Echo {
+				choice.Text = prompts[i] + choice.Text
+			}
+			if request.LogProbs > 0 && ch.LogProbs != nil {
+				offset := 0
+				if request.Echo {
+					offset = len(prompts[i])
+				}
+				choice.LogProbs = completionLogprobs(ch.LogProbs.Content, offset)
+			}
+			res.Choices = append(res.Choices, choice)
+		}
+	}
+	return res
+}
+
+// chatCompletionStream 将聊天流转换为补全流, echo 时先返回提示词
+type chatCompletionStream struct {
+	stream  *openai.ChatCompletionStream
+	request openai.CompletionRequest
+	prompt  string
+	echoed  bool
+	offsets map[int]int
+}
+
+func newChatCompletionStream(stream *openai.ChatCompletionStream, request openai.CompletionRequest, prompt string) *chatCompletionStream {
+	return &chatCompletionStream{stream: stream, request: request, prompt: prompt, echoed: !request.Echo, offsets: map[int]int{}}
+}
+
+func (s *chatCompletionStream) Recv() (openai.CompletionResponse, error) {
+	res := openai.CompletionResponse{
+		Object:  "text_completion",
+		Created: time.Now().Unix(),
+		Model:   s.request.Model,
+		Choices: []openai.CompletionChoice{},
+	}
+	if !s.echoed {
+		s.echoed = true
+		for i := 0; i < max(s.request.N, 1); i++ {
+			res.Choices = append(res.Choices, openai.CompletionChoice{Text: s.prompt, Index: i})
+			s.offsets[i] = len(s.prompt)
+		}
+		return res, nil
+	}
+
+	chunk, err := s.stream.Recv()
+	if err != nil {
+		return openai.CompletionResponse{}, err
+	}
+	res.ID, res.Created, res.Model = chunk.ID, chunk.Created, chunk.Model
+	if chunk.Usage != nil {
+		res.Usage = *chunk.Usage
+	}
+	for _, ch := range chunk.Choices {
+		choice := openai.CompletionChoice{
+			Text:         ch.Delta.Content,
+			Index:        ch.Index,
+			FinishReason: string(ch.FinishReason),
+		}
+		if s.request.LogProbs > 0 && ch.Logprobs != nil {
+			tokens := make([]openai.LogProb, 0, len(ch.Logprobs.Content))
+			for _, token := range ch.Logprobs.Content {
+				top := make([]openai.TopLogProbs, 0, len(token.TopLogprobs))
+				for _, t := range token.TopLogprobs {
+					top = append(top, openai.TopLogProbs{Token: t.Token, LogProb: t.Logprob})
+				}
+				tokens = append(tokens, openai.LogProb{Token: token.Token, LogProb: token.Logprob, TopLogProbs: top})
+			}
+			choice.LogProbs = completionLogprobs(tokens, s.offsets[ch.Index])
+		}
+		s.offsets[ch.Index] += len(choice.Text)
+		res.Choices = append(res.Choices, choice)
+	}
+	return res, nil
+}
+
+func (s *chatCompletionStream) Close() error {
+	return s.stream.Close()
+}
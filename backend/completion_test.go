@@ -0,0 +1,69 @@
+package backend
+
+import (
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCompletionPrompts(t *testing.T) {
+	prompts, err := completionPrompts("def add(")
+	assert.Empty(t, err)
+	assert.Equal(t, []string{"def add("}, prompts)
+
+	prompts, err = completionPrompts([]any{"a", "b"})
+	assert.Empty(t, err)
+	assert.Equal(t, []string{"a", "b"}, prompts)
+
+	_, err = completionPrompts([]any{float64(1), float64(2)})
+	assert.ErrorIs(t, err, ErrCompletionPrompt)
+	_, err = completionPrompts([]any{})
+	assert.ErrorIs(t, err, ErrCompletionPrompt)
+}
+
+func TestCompletionChatRequest(t *testing.T) {
+	req := completionChatRequest(openai.CompletionRequest{Model: "qwen2.5", N: 1, BestOf: 3, LogProbs: 2, MaxTokens: 16}, "def add(")
+	assert.Equal(t, 3, req.N)
+	assert.True(t, req.LogProbs)
+	assert.Equal(t, 2, req.TopLogProbs)
+	assert.Equal(t, "def add(", req.Messages[1].Content)
+
+	req = completionChatRequest(openai.CompletionRequest{Suffix: "\n    return c"}, "def add(a, b):\n")
+	assert.Equal(t, 0, req.N)
+	assert.False(t, req.LogProbs)
+	assert.Equal(t, completionSuffixPrompt, req.Messages[0].Content)
+	assert.Equal(t, "<prefix>def add(a, b):\n</prefix>\n<suffix>\n    return c</suffix>", req.Messages[1].Content)
+}
+
+func TestCompletionFromChat(t *testing.T) {
+	choice := func(text string, logprobs ...float64) openai.ChatCompletionChoice {
+		ch := openai.ChatCompletionChoice{Message: openai.ChatCompletionMessage{Content: text}, FinishReason: openai.FinishReasonStop,
+			LogProbs: &openai.LogProbs{}}
+		for _, lp := range logprobs {
+			ch.LogProbs.Content = append(ch.LogProbs.Content, openai.LogProb{Token: text, LogProb: lp,
+				TopLogProbs: []openai.TopLogProbs{{Token: text, LogProb: lp}}})
+		}
+		return ch
+	}
+	responses := []openai.ChatCompletionResponse{
+		{ID: "chatcmpl-1", Model: "qwen2.5", Choices: []openai.ChatCompletionChoice{choice("x", -2), choice("y", -0.5), choice("z", -1)},
+			Usage: openai.Usage{PromptTokens: 3, CompletionTokens: 3, TotalTokens: 6}},
+		{ID: "chatcmpl-2", Model: "qwen2.5", Choices: []openai.ChatCompletionChoice{choice("b", -1), choice("a", -0.1), choice("c", -3)},
+			Usage: openai.Usage{PromptTokens: 2, CompletionTokens: 3, TotalTokens: 5}},
+	}
+
+	// best_of 3 保留对数概率最高的 1 个, echo 时文本包含提示词, 偏移从提示词之后开始
+	res := completionFromChat(openai.CompletionRequest{N: 1, BestOf: 3, Echo: true, LogProbs: 1}, []string{"p1", "p2"}, responses)
+	assert.Equal(t, "chatcmpl-1", res.ID)
+	assert.Equal(t, "text_completion", res.Object)
+	assert.Equal(t, 2, len(res.Choices))
+	assert.Equal(t, "p1y", res.Choices[0].Text)
+	assert.Equal(t, 0, res.Choices[0].Index)
+	assert.Equal(t, "p2a", res.Choices[1].Text)
+	assert.Equal(t, 1, res.Choices[1].Index)
+	assert.Equal(t, "stop", res.Choices[1].FinishReason)
+	assert.Equal(t, []string{"a"}, res.Choices[1].LogProbs.Tokens)
+	assert.Equal(t, []int{2}, res.Choices[1].LogProbs.TextOffset)
+	assert.Equal(t, float32(-0.1), res.Choices[1].LogProbs.TopLogprobs[0]["a"])
+	assert.Equal(t, 11, res.Usage.TotalTokens)
+}
@@ -0,0 +1,29 @@
+package backend
+
+import "context"
+
+type apiKeyKey struct{}
+
+// WithAPIKey 在 ctx 中记录客户端的 API Key, 后端据此应用按 key 覆盖的配置
+func WithAPIKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, apiKeyKey{}, key)
+}
+
+// APIKey 客户端的 API Key, 未记录时为空
+func APIKey(ctx context.Context) string {
+	key, _ := ctx.Value(apiKeyKey{}).(string)
+	return key
+}
+
+type audioMimeKey struct{}
+
+// WithAudioMime 在 ctx 中记录上传音频声明的 mime, 后端据此解码无文件头的裸 PCM、A-law、μ-law 数据
+func WithAudioMime(ctx context.Context, mime string) context.Context {
+	return context.WithValue(ctx, audioMimeKey{}, mime)
+}
+
+// AudioMime 上传音频声明的 mime, 未记录时为空
+func AudioMime(ctx context.Context) string {
+	mime, _ := ctx.Value(audioMimeKey{}).(string)
+	return mime
+}
@@ -0,0 +1,151 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"github.com/sashabaranov/go-openai"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// defaultCorrectionMaxInput 单次纠错的默认最大字符数
+	defaultCorrectionMaxInput = 2000
+	// defaultCorrectionBudgetPeriod 纠错预算的默认周期
+	defaultCorrectionBudgetPeriod = 24 * time.Hour
+)
+
+var (
+	ErrCorrectionTooLong = errors.New("transcript is too long to correct")
+	ErrCorrectionBudget  = errors.New("transcript correction budget exceeded")
+)
+
+const correctionPrompt = "You correct speech recognition transcripts. " +
+	"Restore punctuation, fix homophone and near-homophone errors (common in Chinese speech recognition) and obvious formatting problems. " +
+	"Do not translate, summarize, answer or add content; keep the original language and meaning. " +
+	"Reply with only the corrected transcript."
+
+// CorrectionConfig STT 识别结果的 LLM 纠错配置, 可按 API Key 或请求开关
+type CorrectionConfig struct {
+	// Enabled 默认是否纠错, 请求的 correct 参数优先
+	Enabled bool `mapstructure:"enabled"`
+	// Keys 按 API Key 覆盖是否纠错
+	Keys map[string]bool `mapstructure:"keys"`
+	// Model LLM 模型, 为空时使用 LLM 后端的默认模型
+	Model string `mapstructure:"model"`
+	// Glossary 领域词表, 与热词一起提示 LLM 优先使用其中的写法
+	Glossary []string `mapstructure:"glossary"`
+	// MaxInput 单次纠错的最大字符数, 超出时不纠错, 默认 2000
+	MaxInput int `mapstructure:"max_input"`
+	// Budget 每个 API Key 每个周期可纠错的字符数, 0 不限制
+	Budget int `mapstructure:"budget"`
+	// GlobalBudget 所有请求每个周期合计可纠错的字符数, 0 不限制
+	// API Key 未经校验, 更换 key 可绕过 Budget, 需要限制总开销时配置
+	GlobalBudget int `mapstructure:"global_budget"`
+	// BudgetPeriod 预算周期, 默认 24h
+	BudgetPeriod time.Duration `mapstructure:"budget_period"`
+}
+
+// TranscriptCorrector 支持用 LLM 纠正识别结果的后端
+type TranscriptCorrector interface {
+	// CorrectTranscript 纠正识别文本, enabled 为请求的开关, nil 时按配置, 不纠错时返回空
+	CorrectTranscript(ctx context.Context, llm Adapter, text string, enabled *bool) (string, error)
+}
+
+// correctionBudget 按 API Key 与合计统计周期内已纠错的字符数, 周期结束后全部清零
+type correctionBudget struct {
+	mu    sync.Mutex
+	start time.Time
+	used  map[string]int
+	total int
+}
+
+// take 扣除 n 个字符的预算, 任一预算超出时不扣除, budget 与 global 为 0 不限制
+// 返回扣除时的周期起点, 用于退还
+func (b *correctionBudget) take(key string, n, budget, global int, period time.Duration) (time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if b.used == nil || now.Sub(b.start) >= period {
+		b.start, b.used, b.total = now, map[string]int{}, 0
+	}
+	if budget > 0 && b.used[key]+n > budget || global > 0 && b.total+n > global {
+		return b.start, false
+	}
+	b.used[key] += n
+	b.total += n
+	return b.start, true
+}
+
+// refund 纠错失败时退还预算, 周期已结束时无需退还
+func (b *correctionBudget) refund(key string, n int, start time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.used == nil || !b.start.Equal(start) {
+		return
+	}
+	b.used[key] -= n
+	b.total -= n
+}
+
+func (c *CorrectionConfig) enabled(key string, enabled *bool) bool {
+	if enabled != nil {
+		return *enabled
+	}
+	if on, ok := c.Keys[key]; ok {
+		return on
+	}
+	return c.Enabled
+}
+
+// correctTranscript 请求 LLM 纠错, 回复为空时视为未纠错
+func correctTranscript(ctx context.Context, llm Adapter, cfg CorrectionConfig, budget *correctionBudget,
+	text string, hotwords []string) (string, error) {
+	if strings.TrimSpace(text) == "" {
+		return "", nil
+	}
+	if cfg.MaxInput <= 0 {
+		cfg.MaxInput = defaultCorrectionMaxInput
+	}
+	if cfg.BudgetPeriod <= 0 {
+		cfg.BudgetPeriod = defaultCorrectionBudgetPeriod
+	}
+	n := utf8.RuneCountInString(text)
+	if n > cfg.MaxInput {
+		return "", ErrCorrectionTooLong
+	}
+	key := APIKey(ctx)
+	limited := cfg.Budget > 0 || cfg.GlobalBudget > 0
+	var start time.Time
+	if limited {
+		var ok bool
+		if start, ok = budget.take(key, n, cfg.Budget, cfg.GlobalBudget, cfg.BudgetPeriod); !ok {
+			return "", ErrCorrectionBudget
+		}
+	}
+
+	system := correctionPrompt
+	if terms := slices.Concat(cfg.Glossary, hotwords); len(terms) > 0 {
+		system += " Prefer these spellings when the speech likely contained them: " + strings.Join(terms, ", ") + "."
+	}
+	res, err := llm.ChatCompletions(ctx, openai.ChatCompletionRequest{
+		Model: cfg.Model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: system},
+			{Role: openai.ChatMessageRoleUser, Content: text},
+		},
+	})
+	if err != nil || len(res.Choices) == 0 {
+		// 未纠错时退还预算
+		if limited {
+			budget.refund(key, n, start)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(res.Choices[0].Message.Content), nil
+}
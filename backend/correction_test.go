@@ -0,0 +1,122 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCorrectionConfig_enabled(t *testing.T) {
+	cfg := CorrectionConfig{Keys: map[string]bool{"sk-a": true}}
+	off, on := false, true
+	assert.False(t, cfg.enabled("sk-b", nil))
+	assert.True(t, cfg.enabled("sk-a", nil))
+	assert.False(t, cfg.enabled("sk-a", &off))
+	assert.True(t, cfg.enabled("sk-b", &on))
+
+	cfg.Enabled = true
+	cfg.Keys["sk-b"] = false
+	assert.True(t, cfg.enabled("sk-c", nil))
+	assert.False(t, cfg.enabled("sk-b", nil))
+}
+
+func TestCorrectionBudget(t *testing.T) {
+	b := &correctionBudget{}
+	take := func(key string, n int) bool {
+		_, ok := b.take(key, n, 10, 0, time.Hour)
+		return ok
+	}
+	assert.True(t, take("sk-a", 6))
+	assert.False(t, take("sk-a", 6))
+	assert.True(t, take("sk-b", 6))
+	assert.True(t, take("sk-a", 4))
+
+	// 周期结束后清零
+	b.start = time.Now().Add(-2 * time.Hour)
+	assert.True(t, take("sk-a", 10))
+
+	// 合计预算不区分 key
+	b = &correctionBudget{}
+	_, ok := b.take("sk-a", 6, 0, 15, time.Hour)
+	assert.True(t, ok)
+	start, ok := b.take("sk-b", 6, 0, 15, time.Hour)
+	assert.True(t, ok)
+	_, ok = b.take("sk-c", 6, 0, 15, time.Hour)
+	assert.False(t, ok)
+
+	// 退还后可再次使用, 上一周期的退还忽略
+	b.refund("sk-b", 6, start)
+	_, ok = b.take("sk-c", 6, 0, 15, time.Hour)
+	assert.True(t, ok)
+	b.refund("sk-c", 6, start.Add(-time.Hour))
+	assert.Equal(t, 12, b.total)
+}
+
+func TestOpenAIStyleBackend_CorrectTranscript(t *testing.T) {
+	var got openai.ChatCompletionRequest
+	sample := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":" 请帮我查询鱿鱼哥的订单。"}}]}`)
+	}))
+	defer sample.Close()
+
+	newBackend := func(cfg *AdapterConfig) *OpenAIStyleBackend {
+		cfg.Name, cfg.ApiStyle, cfg.ApiBase = "sample", "openai", sample.URL+"/v1/"
+		bk, err := NewOpenAIStyleBackend(cfg)
+		assert.Empty(t, err)
+		return bk
+	}
+	llm := newBackend(&AdapterConfig{Type: ModelTypeLLM, DefaultModel: "qwen"})
+	stt := newBackend(&AdapterConfig{
+		Type:          ModelTypeSTT,
+		Transcription: &TranscriptionConfig{TranscriptionDefaults: TranscriptionDefaults{Hotwords: []string{"订单"}}},
+		Correction:    &CorrectionConfig{Enabled: true, Glossary: []string{"鱿鱼哥"}, MaxInput: 20, Budget: 30},
+	})
+
+	ctx := WithAPIKey(context.Background(), "sk-a")
+	text, err := stt.CorrectTranscript(ctx, llm, "请帮我查询由于哥的订单", nil)
+	assert.Empty(t, err)
+	assert.Equal(t, "请帮我查询鱿鱼哥的订单。", text)
+	assert.Equal(t, "qwen", got.Model)
+	assert.Contains(t, got.Messages[0].Content, "鱿鱼哥, 订单")
+	assert.Equal(t, "请帮我查询由于哥的订单", got.Messages[1].Content)
+
+	off := false
+	text, err = stt.CorrectTranscript(ctx, llm, "请帮我查询由于哥的订单", &off)
+	assert.Empty(t, err)
+	assert.Equal(t, "", text)
+
+	_, err = stt.CorrectTranscript(ctx, llm, "一二三四五六七八九十一二三四五六七八九十一", nil)
+	assert.ErrorIs(t, err, ErrCorrectionTooLong)
+
+	// 预算 30 字, 已用 11 字
+	_, err = stt.CorrectTranscript(ctx, llm, "请帮我查询由于哥的订单", nil)
+	assert.Empty(t, err)
+	_, err = stt.CorrectTranscript(ctx, llm, "请帮我查询由于哥的订单", nil)
+	assert.ErrorIs(t, err, ErrCorrectionBudget)
+}
+
+func TestCorrectTranscript_refund(t *testing.T) {
+	sample := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer sample.Close()
+	llm, err := NewOpenAIStyleBackend(&AdapterConfig{Name: "sample", Type: ModelTypeLLM, ApiStyle: "openai", ApiBase: sample.URL + "/v1/"})
+	assert.Empty(t, err)
+
+	// LLM 请求失败时退还预算
+	budget := &correctionBudget{}
+	cfg := CorrectionConfig{Budget: 10, GlobalBudget: 10}
+	ctx := WithAPIKey(context.Background(), "sk-a")
+	_, err = correctTranscript(ctx, llm, cfg, budget, "请帮我查询订单", nil)
+	assert.NotEmpty(t, err)
+	assert.Equal(t, 0, budget.used["sk-a"])
+	assert.Equal(t, 0, budget.total)
+}
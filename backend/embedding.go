@@ -0,0 +1,137 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"math"
+	"sync"
+)
+
+// defaultEmbeddingMaxBatch OpenAI 单次请求的最大输入数
+const defaultEmbeddingMaxBatch = 2048
+
+var ErrEmbeddingInput = errors.New("input must be a string, an array of strings or an array of token arrays")
+
+// embeddingInputs 拆分批量输入, 单个字符串或单个 token 数组返回 nil
+func embeddingInputs(input any) ([]any, error) {
+	switch v := input.(type) {
+	case string:
+		return nil, nil
+	case []string:
+		inputs := make([]any, len(v))
+		for i, s := range v {
+			inputs[i] = s
+		}
+		return inputs, nil
+	case [][]int:
+		inputs := make([]any, len(v))
+		for i, tokens := range v {
+			inputs[i] = tokens
+		}
+		return inputs, nil
+	case []int:
+		return nil, nil
+	case []any:
+		if len(v) == 0 {
+			return nil, ErrEmbeddingInput
+		}
+		switch v[0].(type) {
+		case string, []any:
+			return v, nil
+		case float64:
+			return nil, nil
+		}
+	}
+	return nil, ErrEmbeddingInput
+}
+
+// embedBatched 输入数超过 maxBatch 时分批并发请求, 按原始顺序合并结果并累加用量
+func embedBatched(ctx context.Context, request openai.EmbeddingRequest, maxBatch, concurrency int,
+	embed func(context.Context, openai.EmbeddingRequest) (openai.EmbeddingResponse, error)) (openai.EmbeddingResponse, error) {
+	inputs, err := embeddingInputs(request.Input)
+	if err != nil {
+		return openai.EmbeddingResponse{}, err
+	}
+	if maxBatch <= 0 {
+		maxBatch = defaultEmbeddingMaxBatch
+	}
+	if len(inputs) <= maxBatch {
+		return embed(ctx, request)
+	}
+	if concurrency <= 0 {
+		concurrency = defaultSpeechConcurrency
+	}
+
+	batches := (len(inputs) + maxBatch - 1) / maxBatch
+	results := make([]openai.EmbeddingResponse, batches)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < batches; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			req := request
+			req.Input = inputs[i*maxBatch : min((i+1)*maxBatch, len(inputs))]
+			res, erre := embed(ctx, req)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if erre != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("batch %d: %w", i, erre)
+					cancel()
+				}
+				return
+			}
+			results[i] = res
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return openai.EmbeddingResponse{}, firstErr
+	}
+
+	merged := openai.EmbeddingResponse{Object: results[0].Object, Model: results[0].Model}
+	for i, res := range results {
+		for _, emb := range res.Data {
+			emb.Index += i * maxBatch
+			merged.Data = append(merged.Data, emb)
+		}
+		merged.Usage.PromptTokens += res.Usage.PromptTokens
+		merged.Usage.TotalTokens += res.Usage.TotalTokens
+	}
+	return merged, nil
+}
+
+// truncateEmbeddings 后端忽略 dimensions 时截取前 n 维并重新归一化
+// 适用于 Matryoshka 训练的模型, 与 OpenAI text-embedding-3 的处理方式相同
+func truncateEmbeddings(res *openai.EmbeddingResponse, n int) {
+	for i := range res.Data {
+		vec := res.Data[i].Embedding
+		if n <= 0 || len(vec) <= n {
+			continue
+		}
+		vec = vec[:n]
+		norm := float64(0)
+		for _, v := range vec {
+			norm += float64(v) * float64(v)
+		}
+		if norm = math.Sqrt(norm); norm > 0 {
+			for j := range vec {
+				vec[j] = float32(float64(vec[j]) / norm)
+			}
+		}
+		res.Data[i].Embedding = vec
+	}
+}
@@ -0,0 +1,74 @@
+package backend
+
+import (
+	"context"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestEmbeddingInputs(t *testing.T) {
+	inputs, err := embeddingInputs("你好")
+	assert.Empty(t, err)
+	assert.Nil(t, inputs)
+
+	inputs, err = embeddingInputs([]any{float64(1), float64(2)})
+	assert.Empty(t, err)
+	assert.Nil(t, inputs)
+
+	inputs, err = embeddingInputs([]any{"a", "b"})
+	assert.Empty(t, err)
+	assert.Equal(t, 2, len(inputs))
+
+	inputs, err = embeddingInputs([]any{[]any{float64(1)}, []any{float64(2)}})
+	assert.Empty(t, err)
+	assert.Equal(t, 2, len(inputs))
+
+	_, err = embeddingInputs([]any{})
+	assert.ErrorIs(t, err, ErrEmbeddingInput)
+	_, err = embeddingInputs(map[string]any{})
+	assert.ErrorIs(t, err, ErrEmbeddingInput)
+}
+
+func TestEmbedBatched(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]any
+	embed := func(ctx context.Context, req openai.EmbeddingRequest) (openai.EmbeddingResponse, error) {
+		inputs := req.Input.([]any)
+		mu.Lock()
+		batches = append(batches, inputs)
+		mu.Unlock()
+		res := openai.EmbeddingResponse{Object: "list", Model: "bge-m3", Usage: openai.Usage{PromptTokens: len(inputs), TotalTokens: len(inputs)}}
+		for i, in := range inputs {
+			res.Data = append(res.Data, openai.Embedding{Object: "embedding", Index: i, Embedding: []float32{float32(len(in.(string)))}})
+		}
+		return res, nil
+	}
+
+	input := []any{"a", "bb", "ccc", "dddd", "eeeee"}
+	res, err := embedBatched(context.Background(), openai.EmbeddingRequest{Input: input}, 2, 2, embed)
+	assert.Empty(t, err)
+	assert.Equal(t, 3, len(batches))
+	assert.Equal(t, 5, len(res.Data))
+	for i, emb := range res.Data {
+		assert.Equal(t, i, emb.Index)
+		assert.Equal(t, float32(i+1), emb.Embedding[0])
+	}
+	assert.Equal(t, 5, res.Usage.PromptTokens)
+	assert.Equal(t, 5, res.Usage.TotalTokens)
+	assert.Equal(t, openai.EmbeddingModel("bge-m3"), res.Model)
+
+	// 未超过上限时原样请求
+	batches = nil
+	_, err = embedBatched(context.Background(), openai.EmbeddingRequest{Input: input}, 0, 0, embed)
+	assert.Empty(t, err)
+	assert.Equal(t, 1, len(batches))
+}
+
+func TestTruncateEmbeddings(t *testing.T) {
+	res := openai.EmbeddingResponse{Data: []openai.Embedding{{Embedding: []float32{3, 4, 12}}, {Embedding: []float32{1}}}}
+	truncateEmbeddings(&res, 2)
+	assert.InDeltaSlice(t, []float32{0.6, 0.8}, res.Data[0].Embedding, 1e-6)
+	assert.Equal(t, []float32{1}, res.Data[1].Embedding)
+}
@@ -0,0 +1,32 @@
+package backend
+
+import "strings"
+
+// whisperLanguages whisper verbose_json 返回的语言名称与 ISO-639-1 代码
+var whisperLanguages = map[string]string{
+	"afrikaans": "af", "arabic": "ar", "armenian": "hy", "azerbaijani": "az", "belarusian": "be",
+	"bosnian": "bs", "bulgarian": "bg", "cantonese": "yue", "catalan": "ca", "chinese": "zh",
+	"croatian": "hr", "czech": "cs", "danish": "da", "dutch": "nl", "english": "en",
+	"estonian": "et", "finnish": "fi", "french": "fr", "galician": "gl", "german": "de",
+	"greek": "el", "hebrew": "he", "hindi": "hi", "hungarian": "hu", "icelandic": "is",
+	"indonesian": "id", "italian": "it", "japanese": "ja", "kannada": "kn", "kazakh": "kk",
+	"korean": "ko", "latvian": "lv", "lithuanian": "lt", "macedonian": "mk", "malay": "ms",
+	"marathi": "mr", "maori": "mi", "mongolian": "mn", "nepali": "ne", "norwegian": "no",
+	"persian": "fa", "polish": "pl", "portuguese": "pt", "romanian": "ro", "russian": "ru",
+	"serbian": "sr", "slovak": "sk", "slovenian": "sl", "spanish": "es", "swahili": "sw",
+	"swedish": "sv", "tagalog": "tl", "tamil": "ta", "thai": "th", "tibetan": "bo",
+	"turkish": "tr", "ukrainian": "uk", "urdu": "ur", "uzbek": "uz", "vietnamese": "vi",
+	"welsh": "cy",
+}
+
+// languageCode 将后端返回的语言转换为请求参数使用的 ISO-639-1 代码, 无法识别时返回空
+func languageCode(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if code, ok := whisperLanguages[language]; ok {
+		return code
+	}
+	if len(language) == 2 {
+		return language
+	}
+	return ""
+}
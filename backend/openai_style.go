@@ -1,10 +1,21 @@
 package backend
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"github.com/sashabaranov/go-openai"
+	"io"
 	"net/http"
 	"net/url"
+	"path/filepath"
+	"squidward/modules/archive"
+	"squidward/modules/audio"
+	"squidward/modules/diskcache"
+	"squidward/modules/subtitle"
+	"squidward/modules/textnorm"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -50,22 +61,79 @@ func NewOpenAIStyleBackend(cfg *AdapterConfig) (*OpenAIStyleBackend, error) {
 
 	config.HTTPClient = httpClient
 
+	var speechCache *diskcache.Cache
+	if cfg.Cache != nil {
+		var err error
+		if speechCache, err = diskcache.New(*cfg.Cache); err != nil {
+			return nil, err
+		}
+	}
+
+	var archiver *archive.Archive
+	if cfg.Archive != nil {
+		var err error
+		if archiver, err = archive.New(*cfg.Archive); err != nil {
+			return nil, err
+		}
+	}
+
+	var textNorm *textnorm.Normalizer
+	if cfg.TextNorm != nil {
+		var err error
+		if textNorm, err = textnorm.New(*cfg.TextNorm); err != nil {
+			return nil, err
+		}
+	}
+
 	return &OpenAIStyleBackend{
-		name:         cfg.Name,
-		defaultModel: cfg.DefaultModel,
-		defaultVoice: dfvoice,
-		modelType:    cfg.Type,
-		client:       openai.NewClientWithConfig(config),
+		name:          cfg.Name,
+		defaultModel:  cfg.DefaultModel,
+		defaultVoice:  dfvoice,
+		modelType:     cfg.Type,
+		normalize:     cfg.Normalize,
+		systemPrompt:  cfg.SystemPrompt,
+		maxInput:      cfg.MaxInput,
+		concurrency:   cfg.Concurrency,
+		speechCache:   speechCache,
+		textNorm:      textNorm,
+		subtitle:      cfg.Subtitle,
+		longAudio:     cfg.LongAudio,
+		transcription: cfg.Transcription,
+		upload:        cfg.Upload,
+		vad:           cfg.VAD,
+		archive:       archiver,
+		correction:    cfg.Correction,
+		maxBatch:      cfg.MaxBatch,
+		completions:   cfg.Completions,
+		client:        openai.NewClientWithConfig(config),
 	}, nil
 }
 
 // OpenAIStyleBackend openai风格api
 type OpenAIStyleBackend struct {
-	name         string
-	defaultModel string
-	defaultVoice string
-	modelType    ModelType
-	client       *openai.Client
+	name          string
+	defaultModel  string
+	defaultVoice  string
+	modelType     ModelType
+	normalize     *audio.NormalizeConfig
+	systemPrompt  string
+	maxInput      int
+	concurrency   int
+	speechCache   *diskcache.Cache
+	textNorm      *textnorm.Normalizer
+	subtitle      *subtitle.Config
+	longAudio     *audio.SplitConfig
+	transcription *TranscriptionConfig
+	upload        *audio.Limits
+	vad           *audio.VADConfig
+	archive       *archive.Archive
+	correction    *CorrectionConfig
+	maxBatch      int
+	completions   string
+	budget        correctionBudget
+	// noCompletions 后端已返回不支持原生补全接口, 之后直接使用聊天接口
+	noCompletions atomic.Bool
+	client        *openai.Client
 }
 
 func (o *OpenAIStyleBackend) Type() ModelType {
@@ -94,6 +162,88 @@ func (o *OpenAIStyleBackend) ChatCompletionsStreaming(ctx context.Context, reque
 	return o.client.CreateChatCompletionStream(ctx, request)
 }
 
+// Completions 文本补全, 后端没有原生接口或模型不支持时包装为聊天请求
+func (o *OpenAIStyleBackend) Completions(ctx context.Context, request openai.CompletionRequest) (openai.CompletionResponse, error) {
+	if request.Model == "" {
+		request.Model = o.defaultModel
+	}
+	prompts, err := completionPrompts(request.Prompt)
+	if err != nil {
+		return openai.CompletionResponse{}, err
+	}
+	request.Stream = false
+	if o.nativeCompletions() {
+		res, errc := o.client.CreateCompletion(ctx, request)
+		if !o.completionsFallback(errc) {
+			return res, errc
+		}
+	}
+
+	responses := make([]openai.ChatCompletionResponse, 0, len(prompts))
+	for _, prompt := range prompts {
+		res, errc := o.client.CreateChatCompletion(ctx, completionChatRequest(request, prompt))
+		if errc != nil {
+			return openai.CompletionResponse{}, errc
+		}
+		responses = append(responses, res)
+	}
+	return completionFromChat(request, prompts, responses), nil
+}
+
+// CompletionsStreaming 流式文本补全, 聊天接口包装时只支持单个提示词
+func (o *OpenAIStyleBackend) CompletionsStreaming(ctx context.Context, request openai.CompletionRequest) (CompletionStream, error) {
+	if request.Model == "" {
+		request.Model = o.defaultModel
+	}
+	prompts, err := completionPrompts(request.Prompt)
+	if err != nil {
+		return nil, err
+	}
+	if o.nativeCompletions() {
+		stream, errc := o.client.CreateCompletionStream(ctx, request)
+		if !o.completionsFallback(errc) {
+			if errc != nil {
+				return nil, errc
+			}
+			return stream, nil
+		}
+	}
+
+	if len(prompts) > 1 {
+		return nil, ErrCompletionStream
+	}
+	stream, err := o.client.CreateChatCompletionStream(ctx, completionChatRequest(request, prompts[0]))
+	if err != nil {
+		return nil, err
+	}
+	return newChatCompletionStream(stream, request, prompts[0]), nil
+}
+
+func (o *OpenAIStyleBackend) nativeCompletions() bool {
+	return o.completions != CompletionsChat && !o.noCompletions.Load()
+}
+
+// completionsFallback 原生接口的错误是否需要改用聊天接口, 后端不支持时记住以免重复请求
+func (o *OpenAIStyleBackend) completionsFallback(err error) bool {
+	if err == nil || o.completions == CompletionsNative {
+		return false
+	}
+	// go-openai 拒绝以补全接口请求聊天模型
+	if errors.Is(err, openai.ErrCompletionUnsupportedModel) {
+		return true
+	}
+	if completionsUnsupported(err) {
+		o.noCompletions.Store(true)
+		return true
+	}
+	return false
+}
+
+// SystemPrompt 语音对话的默认系统提示词
+func (o *OpenAIStyleBackend) SystemPrompt() string {
+	return o.systemPrompt
+}
+
 func (o *OpenAIStyleBackend) AudioSpeech(ctx context.Context, request openai.CreateSpeechRequest) (openai.RawResponse, error) {
 	if request.Model == "" {
 		request.Model = openai.SpeechModel(o.defaultModel)
@@ -102,19 +252,195 @@ func (o *OpenAIStyleBackend) AudioSpeech(ctx context.Context, request openai.Cre
 		request.Voice = openai.SpeechVoice(o.defaultVoice)
 	}
 
-	return o.client.CreateSpeech(ctx, request)
+	if o.textNorm != nil {
+		request.Input = o.textNorm.Normalize(request.Input)
+	}
+
+	synthesize := func(ctx context.Context, request openai.CreateSpeechRequest) (openai.RawResponse, error) {
+		return speechChunked(ctx, request, o.maxInput, o.concurrency, o.client.CreateSpeech)
+	}
+	var res openai.RawResponse
+	var err error
+	if o.speechCache != nil {
+		res, err = speechCached(ctx, o.speechCache, speechCacheKey(o.name, request), request, synthesize)
+	} else {
+		res, err = synthesize(ctx, request)
+	}
+	if err != nil || !archiveEnabled(ctx, o.archive) {
+		return res, err
+	}
+	return archiveSpeech(ctx, o.archive, request, res), nil
+}
+
+// PurgeSpeechCache 清除语音合成缓存, key 为响应的 ETag, 为空时清空全部
+func (o *OpenAIStyleBackend) PurgeSpeechCache(key string) int {
+	if o.speechCache == nil {
+		return 0
+	}
+	if key != "" {
+		if o.speechCache.Remove(key) {
+			return 1
+		}
+		return 0
+	}
+	return o.speechCache.Purge()
+}
+
+// UploadLimits 上传音频限制, 未配置时不限制
+func (o *OpenAIStyleBackend) UploadLimits() audio.Limits {
+	if o.upload == nil {
+		return audio.Limits{}
+	}
+	return *o.upload
+}
+
+// VADConfig 流式识别的端点检测参数, 未配置的字段使用默认值
+func (o *OpenAIStyleBackend) VADConfig() audio.VADConfig {
+	if o.vad == nil {
+		return audio.DefaultVADConfig()
+	}
+	return *o.vad
 }
 
 func (o *OpenAIStyleBackend) AudioTranscriptions(ctx context.Context, request openai.AudioRequest) (openai.AudioResponse, error) {
 	if request.Model == "" {
 		request.Model = o.defaultModel
 	}
+	if o.transcription != nil {
+		request = o.transcription.defaults(APIKey(ctx)).apply(request)
+	}
+	var archived []byte
+	archivePath := request.FilePath
+	if request.Reader != nil && archiveEnabled(ctx, o.archive) {
+		var err error
+		if archived, err = io.ReadAll(request.Reader); err != nil {
+			return openai.AudioResponse{}, err
+		}
+		request.Reader = bytes.NewReader(archived)
+	}
+	if o.normalize != nil && request.Reader != nil {
+		if err := o.normalizeAudio(ctx, &request); err != nil {
+			return openai.AudioResponse{}, err
+		}
+	}
+	if o.transcription != nil && o.transcription.DetectLanguage > 0 && request.Language == "" && request.Reader != nil {
+		var language string
+		request, language = detectLanguage(ctx, request, o.transcription.DetectLanguage, o.client.CreateTranscription)
+		request.Language = language
+	}
+
+	var res openai.AudioResponse
+	var err error
+	if o.longAudio != nil && request.Reader != nil {
+		sub := subtitle.Config{}
+		if o.subtitle != nil {
+			sub = *o.subtitle
+		}
+		res, err = transcribeLong(ctx, request, *o.longAudio, o.concurrency, sub, o.transcribe)
+	} else {
+		res, err = o.transcribe(ctx, request)
+	}
+	if err != nil {
+		return res, err
+	}
+	setResponseFormat(&res, request.Format)
+	if archived != nil {
+		original := request
+		original.FilePath = archivePath
+		archiveTranscription(ctx, o.archive, original, archived, &res)
+	}
+	return res, nil
+}
+
+// AudioTranslations 识别并翻译为英文, 与识别共用默认模型、音频规整与本地字幕配置
+func (o *OpenAIStyleBackend) AudioTranslations(ctx context.Context, request openai.AudioRequest) (openai.AudioResponse, error) {
+	if request.Model == "" {
+		request.Model = o.defaultModel
+	}
+	if o.normalize != nil && request.Reader != nil {
+		if err := o.normalizeAudio(ctx, &request); err != nil {
+			return openai.AudioResponse{}, err
+		}
+	}
+
+	var res openai.AudioResponse
+	var err error
+	if o.subtitle != nil && o.subtitle.Local &&
+		(request.Format == openai.AudioResponseFormatSRT || request.Format == openai.AudioResponseFormatVTT) {
+		res, err = transcribeSubtitle(ctx, request, *o.subtitle, o.client.CreateTranslation)
+	} else {
+		res, err = o.client.CreateTranslation(ctx, request)
+	}
+	if err != nil {
+		return res, err
+	}
+	setResponseFormat(&res, request.Format)
+	return res, nil
+}
+
+// CorrectTranscript 按配置用 LLM 纠正识别文本, 热词与识别使用的热词相同, 未配置或未开启时返回空
+func (o *OpenAIStyleBackend) CorrectTranscript(ctx context.Context, llm Adapter, text string, enabled *bool) (string, error) {
+	if o.correction == nil || !o.correction.enabled(APIKey(ctx), enabled) {
+		return "", nil
+	}
+	var hotwords []string
+	if o.transcription != nil {
+		hotwords = o.transcription.defaults(APIKey(ctx)).Hotwords
+	}
+	return correctTranscript(ctx, llm, *o.correction, &o.budget, text, hotwords)
+}
+
+// Archive 请求存档, 未配置时为 nil
+func (o *OpenAIStyleBackend) Archive() *archive.Archive {
+	return o.archive
+}
+
+func (o *OpenAIStyleBackend) transcribe(ctx context.Context, request openai.AudioRequest) (openai.AudioResponse, error) {
+	if o.subtitle != nil && o.subtitle.Local &&
+		(request.Format == openai.AudioResponseFormatSRT || request.Format == openai.AudioResponseFormatVTT) {
+		return transcribeSubtitle(ctx, request, *o.subtitle, o.client.CreateTranscription)
+	}
 	return o.client.CreateTranscription(ctx, request)
 }
 
+// normalizeAudio 规整音频采样率与声道, 无文件头的裸数据按上传声明的 mime 解码, 无法解码的格式(mp3等)原样发送
+func (o *OpenAIStyleBackend) normalizeAudio(ctx context.Context, request *openai.AudioRequest) error {
+	data, err := io.ReadAll(request.Reader)
+	if err != nil {
+		return err
+	}
+
+	wav, err := audio.Normalize(data, AudioMime(ctx), *o.normalize)
+	if err != nil {
+		request.Reader = bytes.NewReader(data)
+		return nil
+	}
+
+	request.Reader = bytes.NewReader(wav)
+	request.FilePath = strings.TrimSuffix(request.FilePath, filepath.Ext(request.FilePath)) + ".wav"
+	return nil
+}
+
 func (o *OpenAIStyleBackend) ImagesGenerations(ctx context.Context, request openai.ImageRequest) (openai.ImageResponse, error) {
 	if request.Model == "" {
 		request.Model = o.defaultModel
 	}
 	return o.client.CreateImage(ctx, request)
 }
+
+// Embeddings 超过单次请求上限的输入分批请求, 统一以 float 格式请求后端
+// base64 编码由调用方处理, 后端返回的维度超过 dimensions 时截取
+func (o *OpenAIStyleBackend) Embeddings(ctx context.Context, request openai.EmbeddingRequest) (openai.EmbeddingResponse, error) {
+	if request.Model == "" {
+		request.Model = openai.EmbeddingModel(o.defaultModel)
+	}
+	request.EncodingFormat = ""
+	res, err := embedBatched(ctx, request, o.maxBatch, o.concurrency, func(ctx context.Context, req openai.EmbeddingRequest) (openai.EmbeddingResponse, error) {
+		return o.client.CreateEmbeddings(ctx, req)
+	})
+	if err != nil {
+		return res, err
+	}
+	truncateEmbeddings(&res, request.Dimensions)
+	return res, nil
+}
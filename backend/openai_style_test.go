@@ -1,15 +1,20 @@
 package backend
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/sashabaranov/go-openai"
 	"github.com/stretchr/testify/assert"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"squidward/lib"
+	"squidward/modules/audio"
 	"testing"
 )
 
@@ -206,3 +211,57 @@ func TestOpenAIStyleBackend_ImagesGenerations(t *testing.T) {
 		fmt.Println(iu.URL)
 	}
 }
+
+// 系统提示词只用于语音对话, 普通聊天请求原样转发
+func TestOpenAIStyleBackend_SystemPrompt(t *testing.T) {
+	var messages []openai.ChatCompletionMessage
+	sample := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := openai.ChatCompletionRequest{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		messages = req.Messages
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":"你好"}}]}`)
+	}))
+	t.Cleanup(sample.Close)
+
+	client, _ := NewOpenAIStyleBackend(&AdapterConfig{
+		Name:         "sample",
+		Type:         ModelTypeLLM,
+		ApiStyle:     "openai",
+		ApiBase:      sample.URL + "/v1/",
+		SystemPrompt: "你是语音助手",
+	})
+	assert.Equal(t, "你是语音助手", client.SystemPrompt())
+
+	_, err := client.ChatCompletions(context.TODO(), openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "你好"}},
+	})
+	assert.Empty(t, err)
+	assert.Equal(t, 1, len(messages))
+	assert.Equal(t, openai.ChatMessageRoleUser, messages[0].Role)
+}
+
+func TestOpenAIStyleBackend_normalizeAudio(t *testing.T) {
+	client, _ := NewOpenAIStyleBackend(&AdapterConfig{
+		Name:      "sample",
+		Type:      ModelTypeSTT,
+		Normalize: &audio.NormalizeConfig{SampleRate: 16000, Mono: true},
+	})
+	raw := make([]byte, 1600)
+
+	// 裸 L16 数据按请求声明的 mime 解码
+	req := openai.AudioRequest{FilePath: "audio.pcm", Reader: bytes.NewReader(raw)}
+	assert.Empty(t, client.normalizeAudio(WithAudioMime(context.TODO(), "audio/L16;rate=8000"), &req))
+	data, _ := io.ReadAll(req.Reader)
+	pcm, err := audio.DecodeWAV(data)
+	assert.Empty(t, err)
+	assert.Equal(t, 16000, pcm.SampleRate)
+	assert.Equal(t, "audio.wav", req.FilePath)
+
+	// 未声明 mime 时原样发送
+	req = openai.AudioRequest{FilePath: "audio.pcm", Reader: bytes.NewReader(raw)}
+	assert.Empty(t, client.normalizeAudio(context.TODO(), &req))
+	data, _ = io.ReadAll(req.Reader)
+	assert.Equal(t, raw, data)
+	assert.Equal(t, "audio.pcm", req.FilePath)
+}
@@ -3,6 +3,11 @@ package backend
 import (
 	"context"
 	"github.com/sashabaranov/go-openai"
+	"squidward/modules/archive"
+	"squidward/modules/audio"
+	"squidward/modules/diskcache"
+	"squidward/modules/subtitle"
+	"squidward/modules/textnorm"
 	"time"
 )
 
@@ -13,18 +18,35 @@ var (
 	ModelTypeSTT   ModelType = "stt"
 	ModelTypeTTS   ModelType = "tts"
 	ModelTypeImage ModelType = "image"
+
+	ModelTypeEmbedding ModelType = "embedding"
 )
 
 type AdapterConfig struct {
-	Name         string                 `mapstructure:"name"`
-	DefaultModel string                 `mapstructure:"default_model"`
-	Type         ModelType              `mapstructure:"type"`
-	ApiBase      string                 `mapstructure:"api_base"`
-	ApiStyle     string                 `mapstructure:"api_style"`
-	ApiToken     string                 `mapstructure:"api_token,omitempty"`
-	HttpTimeout  time.Duration          `mapstructure:"http_timeout,omitempty"`
-	HttpProxy    string                 `mapstructure:"http_proxy,omitempty"`
-	Extras       map[string]interface{} `mapstructure:",remain"`
+	Name          string                 `mapstructure:"name"`
+	DefaultModel  string                 `mapstructure:"default_model"`
+	Type          ModelType              `mapstructure:"type"`
+	ApiBase       string                 `mapstructure:"api_base"`
+	ApiStyle      string                 `mapstructure:"api_style"`
+	ApiToken      string                 `mapstructure:"api_token,omitempty"`
+	HttpTimeout   time.Duration          `mapstructure:"http_timeout,omitempty"`
+	HttpProxy     string                 `mapstructure:"http_proxy,omitempty"`
+	Normalize     *audio.NormalizeConfig `mapstructure:"normalize,omitempty"`      // STT 音频规整
+	SystemPrompt  string                 `mapstructure:"system_prompt,omitempty"`  // LLM 语音对话的默认系统提示词
+	MaxInput      int                    `mapstructure:"max_input,omitempty"`      // TTS 单次请求最大字符数, 超过时分段合成, 默认 4096
+	Concurrency   int                    `mapstructure:"concurrency,omitempty"`    // TTS 分段合成、STT 分段识别与 Embedding 分批请求并发数, 默认 4
+	Cache         *diskcache.Config      `mapstructure:"cache,omitempty"`          // TTS 结果磁盘缓存
+	TextNorm      *textnorm.Config       `mapstructure:"text_normalize,omitempty"` // TTS 中文文本规整
+	Subtitle      *subtitle.Config       `mapstructure:"subtitle,omitempty"`       // STT 字幕生成
+	LongAudio     *audio.SplitConfig     `mapstructure:"long_audio,omitempty"`     // STT 长音频切分
+	Transcription *TranscriptionConfig   `mapstructure:"transcription,omitempty"`  // STT 缺省参数
+	Upload        *audio.Limits          `mapstructure:"upload,omitempty"`         // STT 上传音频限制
+	VAD           *audio.VADConfig       `mapstructure:"vad,omitempty"`            // STT 流式识别语音端点检测
+	Archive       *archive.Config        `mapstructure:"archive,omitempty"`        // STT/TTS 请求存档
+	Correction    *CorrectionConfig      `mapstructure:"correction,omitempty"`     // STT 识别结果 LLM 纠错
+	MaxBatch      int                    `mapstructure:"max_batch,omitempty"`      // Embedding 单次请求最大输入数, 超过时分批请求, 默认 2048
+	Completions   string                 `mapstructure:"completions,omitempty"`    // LLM 文本补全接口, native 或 chat, 默认先请求原生接口, 不支持时改用聊天接口
+	Extras        map[string]interface{} `mapstructure:",remain"`
 }
 
 // Adapter 后端适配器
@@ -36,7 +58,31 @@ type Adapter interface {
 	ChatCompletionsStreaming(context.Context, openai.ChatCompletionRequest) (*openai.ChatCompletionStream, error)
 	AudioSpeech(context.Context, openai.CreateSpeechRequest) (openai.RawResponse, error)
 	AudioTranscriptions(context.Context, openai.AudioRequest) (openai.AudioResponse, error)
+	AudioTranslations(context.Context, openai.AudioRequest) (openai.AudioResponse, error)
 	ImagesGenerations(context.Context, openai.ImageRequest) (openai.ImageResponse, error)
+	Embeddings(context.Context, openai.EmbeddingRequest) (openai.EmbeddingResponse, error)
+	Completions(context.Context, openai.CompletionRequest) (openai.CompletionResponse, error)
+	CompletionsStreaming(context.Context, openai.CompletionRequest) (CompletionStream, error)
+}
+
+// SpeechCachePurger 支持清除语音合成缓存的后端
+type SpeechCachePurger interface {
+	PurgeSpeechCache(key string) int
+}
+
+// UploadLimiter 限制上传音频的后端
+type UploadLimiter interface {
+	UploadLimits() audio.Limits
+}
+
+// SystemPrompter 配置了语音对话默认系统提示词的 LLM 后端
+type SystemPrompter interface {
+	SystemPrompt() string
+}
+
+// VADConfigurer 配置了语音端点检测参数的后端
+type VADConfigurer interface {
+	VADConfig() audio.VADConfig
 }
 
 // AdapterService 后端适配服务
@@ -49,6 +95,8 @@ type AdapterService struct {
 	tts Adapter
 	// 图像服务
 	image Adapter
+	// 向量服务
+	embedding Adapter
 }
 
 func (s *AdapterService) SetBackend(a Adapter) {
@@ -61,6 +109,8 @@ func (s *AdapterService) SetBackend(a Adapter) {
 		s.stt = a
 	case ModelTypeImage:
 		s.image = a
+	case ModelTypeEmbedding:
+		s.embedding = a
 	}
 }
 
@@ -74,6 +124,8 @@ func (s *AdapterService) GetBackend(t ModelType) Adapter {
 		return s.stt
 	case ModelTypeImage:
 		return s.image
+	case ModelTypeEmbedding:
+		return s.embedding
 	}
 	return nil
 }
@@ -0,0 +1,165 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"io"
+	"net/http"
+	"squidward/modules/audio"
+	"squidward/modules/diskcache"
+	"squidward/modules/sentence"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// defaultSpeechMaxInput 多数 TTS 服务单次请求的字符上限
+	defaultSpeechMaxInput = 4096
+	// defaultSpeechConcurrency 长文本分段合成的默认并发数
+	defaultSpeechConcurrency = 4
+)
+
+var ErrSpeechFormatNotConcatenable = errors.New("response_format does not support long input, use mp3, wav or pcm")
+
+// speechChunked 超长文本按段落与句子切分后并发合成, 再拼接为一个完整音频
+// 仅支持可无损拼接的 mp3、wav 与 pcm 格式
+func speechChunked(ctx context.Context, request openai.CreateSpeechRequest, maxInput, concurrency int,
+	synthesize func(context.Context, openai.CreateSpeechRequest) (openai.RawResponse, error)) (openai.RawResponse, error) {
+	if maxInput <= 0 {
+		maxInput = defaultSpeechMaxInput
+	}
+	if utf8.RuneCountInString(request.Input) <= maxInput {
+		return synthesize(ctx, request)
+	}
+
+	format := request.ResponseFormat
+	if format == "" {
+		format = openai.SpeechResponseFormatMp3
+	}
+	if format != openai.SpeechResponseFormatMp3 && format != openai.SpeechResponseFormatWav && format != openai.SpeechResponseFormatPcm {
+		return openai.RawResponse{}, ErrSpeechFormatNotConcatenable
+	}
+	if concurrency <= 0 {
+		concurrency = defaultSpeechConcurrency
+	}
+
+	chunks := sentence.Chunk(request.Input, maxInput)
+	results := make([][]byte, len(chunks))
+	var header http.Header
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	sem := make(chan struct{}, concurrency)
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			req := request
+			req.Input = chunk
+			data, h, err := readSpeech(ctx, req, synthesize)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("chunk %d: %w", i, err)
+					cancel()
+				}
+				return
+			}
+			results[i] = data
+			if i == 0 {
+				header = h
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return openai.RawResponse{}, firstErr
+	}
+
+	var data []byte
+	var err error
+	switch format {
+	case openai.SpeechResponseFormatMp3:
+		data, err = audio.ConcatMP3(results...)
+	case openai.SpeechResponseFormatWav:
+		data, err = audio.ConcatWAV(results...)
+	default:
+		data = bytes.Join(results, nil)
+	}
+	if err != nil {
+		return openai.RawResponse{}, err
+	}
+
+	return newSpeechResponse(data, header, "", ""), nil
+}
+
+func readSpeech(ctx context.Context, request openai.CreateSpeechRequest,
+	synthesize func(context.Context, openai.CreateSpeechRequest) (openai.RawResponse, error)) ([]byte, http.Header, error) {
+	res, err := synthesize(ctx, request)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Close()
+	data, err := io.ReadAll(res)
+	return data, res.Header(), err
+}
+
+// speechCacheKey 缓存键, 输入文本合并空白, 格式与语速使用缺省值补齐
+func speechCacheKey(name string, request openai.CreateSpeechRequest) string {
+	format := request.ResponseFormat
+	if format == "" {
+		format = openai.SpeechResponseFormatMp3
+	}
+	speed := request.Speed
+	if speed == 0 {
+		speed = 1
+	}
+	return diskcache.Key(name, string(request.Model), string(request.Voice),
+		strconv.FormatFloat(speed, 'f', -1, 64), string(format), strings.Join(strings.Fields(request.Input), " "))
+}
+
+// speechCached 命中缓存时直接返回, 否则合成后写入缓存, 响应带 ETag 与 X-Cache
+func speechCached(ctx context.Context, cache *diskcache.Cache, key string, request openai.CreateSpeechRequest,
+	synthesize func(context.Context, openai.CreateSpeechRequest) (openai.RawResponse, error)) (openai.RawResponse, error) {
+	if data, contentType, ok := cache.Get(key); ok {
+		return newSpeechResponse(data, http.Header{"Content-Type": {contentType}}, key, "HIT"), nil
+	}
+
+	data, header, err := readSpeech(ctx, request, synthesize)
+	if err != nil {
+		return openai.RawResponse{}, err
+	}
+	// 缓存写入失败不影响本次结果
+	_ = cache.Put(key, header.Get("Content-Type"), data)
+	return newSpeechResponse(data, header, key, "MISS"), nil
+}
+
+func newSpeechResponse(data []byte, header http.Header, etag, cacheStatus string) openai.RawResponse {
+	header = header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Length", strconv.Itoa(len(data)))
+	header.Del("Transfer-Encoding")
+	if etag != "" {
+		header.Set("ETag", `"`+etag+`"`)
+		header.Set("X-Cache", cacheStatus)
+	}
+	res := openai.RawResponse{ReadCloser: io.NopCloser(bytes.NewReader(data))}
+	res.SetHeader(header)
+	return res
+}
@@ -0,0 +1,80 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"squidward/modules/audio"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestSpeechChunked(t *testing.T) {
+	var mu sync.Mutex
+	var inputs []string
+	running, peak := &atomic.Int32{}, &atomic.Int32{}
+
+	// 每个字符合成 10ms 静音
+	synthesize := func(ctx context.Context, req openai.CreateSpeechRequest) (openai.RawResponse, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		if n > peak.Load() {
+			peak.Store(n)
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		inputs = append(inputs, req.Input)
+		mu.Unlock()
+
+		pcm := &audio.PCM{SampleRate: 8000, Channels: 1, Samples: make([]int16, 80*utf8.RuneCountInString(req.Input))}
+		res := openai.RawResponse{ReadCloser: io.NopCloser(bytes.NewReader(pcm.EncodeWAV()))}
+		res.SetHeader(http.Header{"Content-Type": {"audio/wav"}})
+		return res, nil
+	}
+
+	input := strings.Repeat("这是第一句话。", 20)
+	res, err := speechChunked(context.Background(), openai.CreateSpeechRequest{
+		Input:          input,
+		ResponseFormat: openai.SpeechResponseFormatWav,
+	}, 30, 2, synthesize)
+	assert.Empty(t, err)
+
+	data, _ := io.ReadAll(res)
+	assert.Equal(t, "audio/wav", res.Header().Get("Content-Type"))
+	assert.Equal(t, strconv.Itoa(len(data)), res.Header().Get("Content-Length"))
+	pcm, err := audio.DecodeWAV(data)
+	assert.Empty(t, err)
+	assert.Equal(t, 1400*time.Millisecond, pcm.Duration())
+
+	assert.Equal(t, 5, len(inputs))
+	assert.LessOrEqual(t, peak.Load(), int32(2))
+
+	// 短文本直接合成
+	inputs = nil
+	_, err = speechChunked(context.Background(), openai.CreateSpeechRequest{Input: "你好"}, 30, 2, synthesize)
+	assert.Empty(t, err)
+	assert.Equal(t, []string{"你好"}, inputs)
+
+	_, err = speechChunked(context.Background(), openai.CreateSpeechRequest{
+		Input:          input,
+		ResponseFormat: openai.SpeechResponseFormatOpus,
+	}, 30, 2, synthesize)
+	assert.ErrorIs(t, err, ErrSpeechFormatNotConcatenable)
+
+	failed := errors.New("failed")
+	_, err = speechChunked(context.Background(), openai.CreateSpeechRequest{Input: input}, 30, 2,
+		func(ctx context.Context, req openai.CreateSpeechRequest) (openai.RawResponse, error) {
+			return openai.RawResponse{}, failed
+		})
+	assert.ErrorIs(t, err, failed)
+}
@@ -0,0 +1,334 @@
+package backend
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"squidward/modules/audio"
+	"squidward/modules/subtitle"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// transcribeSubtitle 以 verbose_json 识别后在本地渲染 srt/vtt, 结果写入 Text
+func transcribeSubtitle(ctx context.Context, request openai.AudioRequest, cfg subtitle.Config,
+	transcribe func(context.Context, openai.AudioRequest) (openai.AudioResponse, error)) (openai.AudioResponse, error) {
+	format := request.Format
+	request.Format = openai.AudioResponseFormatVerboseJSON
+	request.TimestampGranularities = []openai.TranscriptionTimestampGranularity{openai.TranscriptionTimestampGranularitySegment}
+
+	res, err := transcribe(ctx, request)
+	if err != nil {
+		return res, err
+	}
+
+	cues := subtitle.Cues(subtitleSegments(res), cfg)
+	if format == openai.AudioResponseFormatVTT {
+		res.Text = subtitle.VTT(cues)
+	} else {
+		res.Text = subtitle.SRT(cues)
+	}
+	return res, nil
+}
+
+// promptTailLength 作为下一段 prompt 的上一段结尾字数
+const promptTailLength = 200
+
+// ErrLongAudioUnsplittable 音频超过 long_audio.max_size 但格式无法解码切分
+var ErrLongAudioUnsplittable = errors.New("audio exceeds the size limit and its format cannot be split, use mp3, wav or pcm")
+
+type progressKey struct{}
+
+// ProgressFunc 长任务进度回调, done 为已完成的分段数
+type ProgressFunc func(done, total int)
+
+// WithProgress 在 ctx 中注册进度回调, 长音频分段识别时每完成一段调用一次
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+func reportProgress(ctx context.Context, done, total int) {
+	if fn, ok := ctx.Value(progressKey{}).(ProgressFunc); ok && fn != nil {
+		fn(done, total)
+	}
+}
+
+// splitMime 切分音频时使用的mime, .mp3 文件按 mp3 切分, 其余使用上传声明的类型
+func splitMime(ctx context.Context, request openai.AudioRequest) string {
+	if strings.EqualFold(filepath.Ext(request.FilePath), ".mp3") {
+		return "audio/mpeg"
+	}
+	return AudioMime(ctx)
+}
+
+// transcribeLong 超过上限的长音频在静音处切分后识别, 再按时间偏移合并分段
+// 分段按顺序分为 concurrency 组并发识别, 组内顺序识别并以上一段结尾文本作为 prompt
+// 除第一组外, 每组先识别前一组的最后一段作为第一段的 prompt, 保持组边界处的上下文
+func transcribeLong(ctx context.Context, request openai.AudioRequest, cfg audio.SplitConfig, concurrency int, sub subtitle.Config,
+	transcribe func(context.Context, openai.AudioRequest) (openai.AudioResponse, error)) (openai.AudioResponse, error) {
+	data, err := io.ReadAll(request.Reader)
+	if err != nil {
+		return openai.AudioResponse{}, err
+	}
+	chunks, err := audio.Split(data, splitMime(ctx, request), cfg)
+	if err != nil {
+		// 无法解码的格式不能切分, 超过大小上限时后端也会拒绝, 直接返回错误
+		if cfg.MaxSize > 0 && len(data) > cfg.MaxSize {
+			return openai.AudioResponse{}, fmt.Errorf("%w: %v", ErrLongAudioUnsplittable, err)
+		}
+		logrus.WithField("prefix", "transcription").Warnf("%s cannot be split, transcribing as is: %v", request.FilePath, err)
+	}
+	if len(chunks) <= 1 {
+		// 未超过上限或无法解码的格式原样识别
+		request.Reader = bytes.NewReader(data)
+		return transcribe(ctx, request)
+	}
+
+	// 字幕与 verbose_json 需要分段时间戳, 其余格式只需文本
+	chunkReq := request
+	chunkReq.Format = openai.AudioResponseFormatJSON
+	switch request.Format {
+	case openai.AudioResponseFormatVerboseJSON:
+		chunkReq.Format = openai.AudioResponseFormatVerboseJSON
+	case openai.AudioResponseFormatSRT, openai.AudioResponseFormatVTT:
+		chunkReq.Format = openai.AudioResponseFormatVerboseJSON
+		chunkReq.TimestampGranularities = []openai.TranscriptionTimestampGranularity{openai.TranscriptionTimestampGranularitySegment}
+	}
+	name := strings.TrimSuffix(filepath.Base(request.FilePath), filepath.Ext(request.FilePath))
+	chunkRequest := func(i int, tail string) openai.AudioRequest {
+		req := chunkReq
+		req.Reader = bytes.NewReader(chunks[i].Data)
+		req.FilePath = fmt.Sprintf("%s-%d.%s", name, i, chunks[i].Ext)
+		req.Prompt = strings.TrimSpace(request.Prompt + " " + tail)
+		return req
+	}
+	promptTail := func(res openai.AudioResponse) string {
+		return string(lastRunes([]rune(strings.TrimSpace(res.Text)), promptTailLength))
+	}
+
+	if concurrency <= 0 {
+		concurrency = defaultSpeechConcurrency
+	}
+	groups := min(concurrency, len(chunks))
+	results := make([]openai.AudioResponse, len(chunks))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	fail := func(i int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = fmt.Errorf("chunk %d: %w", i, err)
+			cancel()
+		}
+	}
+	done := 0
+	for g := 0; g < groups; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start, end := g*len(chunks)/groups, (g+1)*len(chunks)/groups
+			tail := ""
+			if start > 0 {
+				// 前一段的结果只用作上下文, 以该组自己的识别结果为准
+				prev, errt := transcribe(ctx, chunkRequest(start-1, ""))
+				if errt != nil {
+					fail(start-1, errt)
+					return
+				}
+				tail = promptTail(prev)
+			}
+			for i := start; i < end; i++ {
+				res, errt := transcribe(ctx, chunkRequest(i, tail))
+				if errt != nil {
+					fail(i, errt)
+					return
+				}
+
+				mu.Lock()
+				results[i] = res
+				done++
+				reportProgress(ctx, done, len(chunks))
+				mu.Unlock()
+
+				tail = promptTail(res)
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return openai.AudioResponse{}, firstErr
+	}
+
+	res := mergeTranscriptions(results, chunks)
+	switch request.Format {
+	case openai.AudioResponseFormatSRT:
+		res.Text = subtitle.SRT(subtitle.Cues(subtitleSegments(res), sub))
+	case openai.AudioResponseFormatVTT:
+		res.Text = subtitle.VTT(subtitle.Cues(subtitleSegments(res), sub))
+	}
+	return res, nil
+}
+
+// mergeTranscriptions 合并各段识别结果, 分段与词的时间戳加上所在段的起始偏移
+func mergeTranscriptions(results []openai.AudioResponse, chunks []audio.Chunk) openai.AudioResponse {
+	merged := openai.AudioResponse{Task: results[0].Task, Language: results[0].Language}
+	for i, res := range results {
+		offset := chunks[i].Start.Seconds()
+		merged.Text = JoinText(merged.Text, res.Text)
+		for _, seg := range res.Segments {
+			seg.ID = len(merged.Segments)
+			// seek 以 10ms 为单位
+			seg.Seek += int(offset * 100)
+			seg.Start += offset
+			seg.End += offset
+			merged.Segments = append(merged.Segments, seg)
+		}
+		for _, word := range res.Words {
+			word.Start += offset
+			word.End += offset
+			merged.Words = append(merged.Words, word)
+		}
+		merged.Duration = offset + chunks[i].Duration.Seconds()
+	}
+	return merged
+}
+
+func subtitleSegments(res openai.AudioResponse) []subtitle.Segment {
+	segments := make([]subtitle.Segment, 0, len(res.Segments))
+	for _, seg := range res.Segments {
+		segments = append(segments, subtitle.Segment{Start: seg.Start, End: seg.End, Text: seg.Text})
+	}
+	// 后端未返回分段时整段作为一条字幕
+	if len(segments) == 0 && res.Text != "" {
+		segments = append(segments, subtitle.Segment{End: res.Duration, Text: res.Text})
+	}
+	return segments
+}
+
+// JoinText 拼接两段文本, 中日韩文字之间不加空格
+func JoinText(a, b string) string {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	if a == "" || b == "" {
+		return a + b
+	}
+	last, _ := utf8.DecodeLastRuneInString(a)
+	first, _ := utf8.DecodeRuneInString(b)
+	if last >= utf8.RuneSelf || first >= utf8.RuneSelf {
+		return a + b
+	}
+	return a + " " + b
+}
+
+func lastRunes(rs []rune, n int) []rune {
+	return rs[max(len(rs)-n, 0):]
+}
+
+// HeaderResponseFormat 识别结果实际使用的 response_format, 请求未指定时可能由配置的缺省值决定
+const HeaderResponseFormat = "X-Response-Format"
+
+// ResponseFormat 识别结果实际使用的 response_format
+func ResponseFormat(res openai.AudioResponse) openai.AudioResponseFormat {
+	if res.Header() == nil {
+		return ""
+	}
+	return openai.AudioResponseFormat(res.Header().Get(HeaderResponseFormat))
+}
+
+func setResponseFormat(res *openai.AudioResponse, format openai.AudioResponseFormat) {
+	header := http.Header{}
+	if res.Header() != nil {
+		header = res.Header().Clone()
+	}
+	header.Set(HeaderResponseFormat, string(format))
+	res.SetHeader(header)
+}
+
+// TranscriptionDefaults STT 请求未指定参数时使用的缺省值
+type TranscriptionDefaults struct {
+	Language       string  `mapstructure:"language"`
+	Prompt         string  `mapstructure:"prompt"`
+	Temperature    float32 `mapstructure:"temperature"`
+	ResponseFormat string  `mapstructure:"response_format"`
+	// Hotwords 热词, 追加到 prompt 中提高专有名词的识别率
+	Hotwords []string `mapstructure:"hotwords"`
+}
+
+// TranscriptionConfig STT 缺省参数, 可按客户端 API Key 覆盖
+type TranscriptionConfig struct {
+	TranscriptionDefaults `mapstructure:",squash"`
+	// DetectLanguage 未指定语言时先识别开头这段时长的音频以确定语言, 0 不检测
+	// 长音频切分识别时可避免各段语言不一致
+	DetectLanguage time.Duration `mapstructure:"detect_language"`
+	// Keys 按 API Key 覆盖的缺省值, 热词与全局热词合并
+	Keys map[string]TranscriptionDefaults `mapstructure:"keys"`
+}
+
+// defaults 合并 key 的覆盖配置
+func (c *TranscriptionConfig) defaults(key string) TranscriptionDefaults {
+	d := c.TranscriptionDefaults
+	o, ok := c.Keys[key]
+	if !ok {
+		return d
+	}
+	d.Language = cmp.Or(o.Language, d.Language)
+	d.Prompt = cmp.Or(o.Prompt, d.Prompt)
+	d.Temperature = cmp.Or(o.Temperature, d.Temperature)
+	d.ResponseFormat = cmp.Or(o.ResponseFormat, d.ResponseFormat)
+	d.Hotwords = append(slices.Clone(d.Hotwords), o.Hotwords...)
+	return d
+}
+
+// apply 填充请求中未指定的参数, temperature 为 0 视为未指定
+func (d TranscriptionDefaults) apply(request openai.AudioRequest) openai.AudioRequest {
+	request.Language = cmp.Or(request.Language, d.Language)
+	request.Prompt = cmp.Or(request.Prompt, d.Prompt)
+	request.Temperature = cmp.Or(request.Temperature, d.Temperature)
+	request.Format = cmp.Or(request.Format, openai.AudioResponseFormat(d.ResponseFormat))
+	if len(d.Hotwords) > 0 {
+		request.Prompt = strings.TrimSpace(request.Prompt + " " + strings.Join(d.Hotwords, ", "))
+	}
+	return request
+}
+
+// detectLanguage 识别开头一段音频, 以返回的语言作为整段音频的语言
+// 无法截取的格式或检测失败时返回空, 由后端自行判断
+func detectLanguage(ctx context.Context, request openai.AudioRequest, head time.Duration,
+	transcribe func(context.Context, openai.AudioRequest) (openai.AudioResponse, error)) (openai.AudioRequest, string) {
+	data, err := io.ReadAll(request.Reader)
+	request.Reader = bytes.NewReader(data)
+	if err != nil {
+		return request, ""
+	}
+
+	chunks, err := audio.Split(data, splitMime(ctx, request), audio.SplitConfig{MaxDuration: head})
+	if err != nil || len(chunks) == 0 {
+		// 不超过检测时长的短音频直接识别即可
+		return request, ""
+	}
+
+	req := request
+	req.Reader = bytes.NewReader(chunks[0].Data)
+	req.FilePath = "detect." + chunks[0].Ext
+	req.Format = openai.AudioResponseFormatVerboseJSON
+	req.TimestampGranularities = nil
+	res, err := transcribe(ctx, req)
+	if err != nil {
+		return request, ""
+	}
+	return request, languageCode(res.Language)
+}
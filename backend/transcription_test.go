@@ -0,0 +1,217 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"squidward/modules/audio"
+	"squidward/modules/subtitle"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTranscribeSubtitle(t *testing.T) {
+	var got openai.AudioRequest
+	transcribe := func(ctx context.Context, req openai.AudioRequest) (openai.AudioResponse, error) {
+		got = req
+		res := openai.AudioResponse{Text: "大家好，欢迎收看今天的节目。", Duration: 2.5}
+		err := json.Unmarshal([]byte(`[{"start":0,"end":1.2,"text":" 大家好，"},{"start":1.2,"end":2.5,"text":"欢迎收看今天的节目。"}]`), &res.Segments)
+		return res, err
+	}
+
+	res, err := transcribeSubtitle(context.TODO(), openai.AudioRequest{Format: openai.AudioResponseFormatSRT},
+		subtitle.Config{Local: true}, transcribe)
+	assert.Empty(t, err)
+	assert.Equal(t, openai.AudioResponseFormatVerboseJSON, got.Format)
+	assert.Equal(t, []openai.TranscriptionTimestampGranularity{openai.TranscriptionTimestampGranularitySegment}, got.TimestampGranularities)
+	assert.Equal(t, "1\n00:00:00,000 --> 00:00:01,200\n大家好，\n\n"+
+		"2\n00:00:01,200 --> 00:00:02,500\n欢迎收看今天的节目。\n\n", res.Text)
+
+	// 无分段时整段输出
+	transcribe = func(ctx context.Context, req openai.AudioRequest) (openai.AudioResponse, error) {
+		return openai.AudioResponse{Text: "Hello world.", Duration: 1}, nil
+	}
+	res, err = transcribeSubtitle(context.TODO(), openai.AudioRequest{Format: openai.AudioResponseFormatVTT},
+		subtitle.Config{Local: true}, transcribe)
+	assert.Empty(t, err)
+	assert.Equal(t, "WEBVTT\n\n00:00:00.000 --> 00:00:01.000\nHello world.\n\n", res.Text)
+}
+
+func TestTranscribeLong(t *testing.T) {
+	// 10s 音频, 每 2s 一段语音后接 0.5s 静音
+	pcm := &audio.PCM{SampleRate: 8000, Channels: 1}
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 16000; j++ {
+			pcm.Samples = append(pcm.Samples, int16(8000*math.Sin(2*math.Pi*440*float64(j)/8000)))
+		}
+		pcm.Samples = append(pcm.Samples, make([]int16, 4000)...)
+	}
+
+	var mu sync.Mutex
+	prompts := map[string][]string{}
+	transcribe := func(ctx context.Context, req openai.AudioRequest) (openai.AudioResponse, error) {
+		data, _ := io.ReadAll(req.Reader)
+		chunk, err := audio.DecodeWAV(data)
+		if err != nil {
+			return openai.AudioResponse{}, err
+		}
+		mu.Lock()
+		prompts[req.FilePath] = append(prompts[req.FilePath], req.Prompt)
+		mu.Unlock()
+
+		assert.Equal(t, openai.AudioResponseFormatVerboseJSON, req.Format)
+		text := "第" + strings.TrimSuffix(strings.TrimPrefix(req.FilePath, "meeting-"), ".wav") + "段。"
+		res := openai.AudioResponse{Language: "zh", Text: text, Duration: chunk.Duration().Seconds()}
+		err = json.Unmarshal([]byte(fmt.Sprintf(`[{"seek":0,"start":0.1,"end":%v,"text":%q}]`, chunk.Duration().Seconds(), text)), &res.Segments)
+		return res, err
+	}
+
+	var progress []int
+	ctx := WithProgress(context.TODO(), func(done, total int) {
+		assert.Equal(t, 4, total)
+		progress = append(progress, done)
+	})
+	res, err := transcribeLong(ctx, openai.AudioRequest{
+		FilePath: "meeting.wav",
+		Reader:   bytes.NewReader(pcm.EncodeWAV()),
+		Prompt:   "会议纪要",
+		Format:   openai.AudioResponseFormatVerboseJSON,
+	}, audio.SplitConfig{MaxDuration: 3 * time.Second}, 2, subtitle.Config{}, transcribe)
+	assert.Empty(t, err)
+	assert.Equal(t, []int{1, 2, 3, 4}, progress)
+
+	assert.Equal(t, "第0段。第1段。第2段。第3段。", res.Text)
+	assert.Equal(t, "zh", res.Language)
+	assert.InDelta(t, 10, res.Duration, 0.01)
+	assert.Equal(t, 4, len(res.Segments))
+	for i, seg := range res.Segments {
+		assert.Equal(t, i, seg.ID)
+		// 切分点位于静音中间
+		assert.InDelta(t, float64(i)*2.5+0.1-0.25*float64(min(i, 1)), seg.Start, 0.1)
+	}
+
+	// 每段以上一段结尾作为 prompt, 第二组先识别第 1 段作为组边界的上下文
+	assert.Equal(t, 4, len(prompts))
+	assert.Equal(t, []string{"会议纪要"}, prompts["meeting-0.wav"])
+	assert.ElementsMatch(t, []string{"会议纪要", "会议纪要 第0段。"}, prompts["meeting-1.wav"])
+	assert.Equal(t, []string{"会议纪要 第1段。"}, prompts["meeting-2.wav"])
+	assert.Equal(t, []string{"会议纪要 第2段。"}, prompts["meeting-3.wav"])
+
+	// 未超过上限时原样识别
+	res, err = transcribeLong(context.TODO(), openai.AudioRequest{
+		FilePath: "short.wav",
+		Reader:   bytes.NewReader(pcm.EncodeWAV()),
+		Format:   openai.AudioResponseFormatVerboseJSON,
+	}, audio.SplitConfig{MaxDuration: time.Minute}, 2, subtitle.Config{}, transcribe)
+	assert.Empty(t, err)
+	assert.Equal(t, "第short段。", res.Text)
+
+	// 超过大小上限且无法切分的格式返回错误
+	_, err = transcribeLong(context.TODO(), openai.AudioRequest{
+		FilePath: "long.m4a",
+		Reader:   bytes.NewReader(make([]byte, 2048)),
+	}, audio.SplitConfig{MaxSize: 1024}, 2, subtitle.Config{}, transcribe)
+	assert.ErrorIs(t, err, ErrLongAudioUnsplittable)
+}
+
+func TestTranscriptionConfig(t *testing.T) {
+	cfg := TranscriptionConfig{
+		TranscriptionDefaults: TranscriptionDefaults{Language: "zh", Temperature: 0.2, Hotwords: []string{"蟹堡王"}},
+		Keys: map[string]TranscriptionDefaults{
+			"sk-video": {Language: "en", ResponseFormat: "srt", Hotwords: []string{"Squidward"}},
+		},
+	}
+
+	req := cfg.defaults("").apply(openai.AudioRequest{Prompt: "会议纪要"})
+	assert.Equal(t, "zh", req.Language)
+	assert.Equal(t, float32(0.2), req.Temperature)
+	assert.Equal(t, "会议纪要 蟹堡王", req.Prompt)
+	assert.Equal(t, openai.AudioResponseFormat(""), req.Format)
+
+	// 按 key 覆盖, 请求参数优先
+	req = cfg.defaults("sk-video").apply(openai.AudioRequest{Temperature: 0.5})
+	assert.Equal(t, "en", req.Language)
+	assert.Equal(t, float32(0.5), req.Temperature)
+	assert.Equal(t, openai.AudioResponseFormatSRT, req.Format)
+	assert.Equal(t, "蟹堡王, Squidward", req.Prompt)
+	assert.Equal(t, []string{"蟹堡王"}, cfg.Hotwords)
+
+	assert.Equal(t, "zh", languageCode("Chinese"))
+	assert.Equal(t, "en", languageCode("en"))
+	assert.Equal(t, "", languageCode("klingon"))
+}
+
+func TestOpenAIStyleBackend_detectLanguage(t *testing.T) {
+	var mu sync.Mutex
+	var requests []url.Values
+	sample := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseMultipartForm(32 << 20)
+		_, fh, _ := r.FormFile("file")
+		mu.Lock()
+		values := r.MultipartForm.Value
+		values["file"] = []string{fh.Filename}
+		requests = append(requests, values)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, `{"task":"transcribe","language":"chinese","duration":1,"text":"你好"}`)
+	}))
+	t.Cleanup(sample.Close)
+
+	bk, err := NewOpenAIStyleBackend(&AdapterConfig{
+		Name:     "sample",
+		Type:     ModelTypeSTT,
+		ApiStyle: "openai",
+		ApiBase:  sample.URL + "/v1/",
+		Transcription: &TranscriptionConfig{
+			DetectLanguage: time.Second,
+			Keys:           map[string]TranscriptionDefaults{"sk-en": {Language: "en"}},
+		},
+	})
+	assert.Empty(t, err)
+
+	pcm := &audio.PCM{SampleRate: 8000, Channels: 1, Samples: make([]int16, 3*8000)}
+	res, err := bk.AudioTranscriptions(context.TODO(), openai.AudioRequest{
+		FilePath: "a.wav",
+		Reader:   bytes.NewReader(pcm.EncodeWAV()),
+	})
+	assert.Empty(t, err)
+	assert.Equal(t, "你好", res.Text)
+	assert.Equal(t, openai.AudioResponseFormat(""), ResponseFormat(res))
+
+	// 先以开头 1s 检测语言, 再带上语言识别完整音频
+	assert.Equal(t, 2, len(requests))
+	assert.Equal(t, "detect.wav", requests[0].Get("file"))
+	assert.Equal(t, "verbose_json", requests[0].Get("response_format"))
+	assert.Equal(t, "a.wav", requests[1].Get("file"))
+	assert.Equal(t, "zh", requests[1].Get("language"))
+
+	// 已指定语言时不检测
+	requests = nil
+	_, err = bk.AudioTranscriptions(WithAPIKey(context.TODO(), "sk-en"), openai.AudioRequest{
+		FilePath: "a.wav",
+		Reader:   bytes.NewReader(pcm.EncodeWAV()),
+	})
+	assert.Empty(t, err)
+	assert.Equal(t, 1, len(requests))
+	assert.Equal(t, "en", requests[0].Get("language"))
+
+	// 裸数据按上传声明的类型截取
+	requests = nil
+	_, err = bk.AudioTranscriptions(WithAudioMime(context.TODO(), "audio/L16;rate=8000"), openai.AudioRequest{
+		FilePath: "a.pcm",
+		Reader:   bytes.NewReader(pcm.Bytes()),
+	})
+	assert.Empty(t, err)
+	assert.Equal(t, 2, len(requests))
+	assert.Equal(t, "detect.wav", requests[0].Get("file"))
+}
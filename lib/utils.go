@@ -1,6 +1,8 @@
 package lib
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"github.com/sirupsen/logrus"
 	"path/filepath"
 	"runtime"
@@ -24,3 +26,10 @@ func RuntimeDir() string {
 	_, b, _, _ := runtime.Caller(1)
 	return filepath.Dir(b)
 }
+
+// RandomID 生成随机十六进制id
+func RandomID() string {
+	bs := make([]byte, 12)
+	_, _ = rand.Read(bs)
+	return hex.EncodeToString(bs)
+}
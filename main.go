@@ -79,7 +79,7 @@ func main() {
 		logger.Fatalf("Fatal error config file: %v", err)
 	}
 
-	apiServer := api_server.NewApiServer(logger, aServcie)
+	apiServer := api_server.NewApiServer(logger, aServcie).SetAdminToken(viper.GetString("admin_token"))
 
 	go func() {
 		if serr := apiServer.Serve(netListener); serr != nil {
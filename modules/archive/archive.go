@@ -0,0 +1,231 @@
+package archive
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("archive not found")
+
+// purgeInterval 过期存档的清理间隔
+const purgeInterval = time.Hour
+
+// idTimeLayout 存档id以创建时间开头, 清理时无需读取元数据
+const idTimeLayout = "20060102T150405Z"
+
+// 存档类型
+const (
+	KindTranscription = "transcription"
+	KindSpeech        = "speech"
+)
+
+// MetaFile 元数据文件名
+const MetaFile = "meta.json"
+
+// Config 存档配置, Dir 与 S3 二选一
+type Config struct {
+	// Keys 需要存档的 API Key, "*" 表示全部请求
+	// 服务端不校验 API Key, 客户端更换或省略 key 即可绕过, 需要强制存档时使用 "*"
+	Keys []string `mapstructure:"keys"`
+	// Retention 保留时长, 过期后自动删除, 0 表示永久保留
+	Retention time.Duration `mapstructure:"retention"`
+	// Dir 本地存档目录
+	Dir string `mapstructure:"dir"`
+	// S3 兼容 S3 的对象存储
+	S3 *S3Config `mapstructure:"s3"`
+}
+
+// Record 存档元数据
+type Record struct {
+	ID      string    `json:"id"`
+	Kind    string    `json:"kind"`
+	Created time.Time `json:"created"`
+	// Key 脱敏后的 API Key
+	Key   string `json:"key,omitempty"`
+	Model string `json:"model,omitempty"`
+	// Duration 音频时长(秒)
+	Duration float64 `json:"duration,omitempty"`
+	// Text 识别结果或合成的输入文本
+	Text   string `json:"text,omitempty"`
+	Voice  string `json:"voice,omitempty"`
+	Format string `json:"format,omitempty"`
+	// Files 存档的文件名
+	Files []string `json:"files"`
+}
+
+// store 存档的存储后端, name 为 "id/文件名"
+type store interface {
+	put(ctx context.Context, name string, data []byte) error
+	get(ctx context.Context, name string) ([]byte, error)
+	// list 列出全部存档id
+	list(ctx context.Context) ([]string, error)
+	// remove 删除存档的全部文件
+	remove(ctx context.Context, id string) error
+}
+
+// Archive 按 API Key 存档音频与文本
+type Archive struct {
+	cfg   Config
+	store store
+}
+
+func New(cfg Config) (*Archive, error) {
+	var st store
+	switch {
+	case cfg.S3 != nil:
+		var err error
+		if st, err = newS3Store(*cfg.S3); err != nil {
+			return nil, err
+		}
+	case cfg.Dir != "":
+		var err error
+		if st, err = newDirStore(cfg.Dir); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("archive dir or s3 is required")
+	}
+
+	a := &Archive{cfg: cfg, store: st}
+	if cfg.Retention > 0 {
+		go a.purgeLoop()
+	}
+	return a, nil
+}
+
+// Enabled 判断该 API Key 的请求是否需要存档
+func (a *Archive) Enabled(key string) bool {
+	return slices.Contains(a.cfg.Keys, "*") || key != "" && slices.Contains(a.cfg.Keys, key)
+}
+
+// Save 保存一条存档, files 为文件名到内容的映射, 未指定 id 时按创建时间生成
+func (a *Archive) Save(ctx context.Context, rec Record, files map[string][]byte) (Record, error) {
+	if rec.Created.IsZero() {
+		rec.Created = time.Now()
+	}
+	if rec.ID == "" {
+		rec.ID = NewID(rec.Created)
+	}
+	if !validID(rec.ID) {
+		return rec, errors.New("invalid archive id")
+	}
+	rec.Key = MaskKey(rec.Key)
+	rec.Files = rec.Files[:0]
+	for name := range files {
+		rec.Files = append(rec.Files, name)
+	}
+	slices.Sort(rec.Files)
+
+	for _, name := range rec.Files {
+		if err := a.store.put(ctx, rec.ID+"/"+name, files[name]); err != nil {
+			return rec, err
+		}
+	}
+	// 元数据最后写入, 存在元数据即表示存档完整
+	meta, err := json.Marshal(rec)
+	if err != nil {
+		return rec, err
+	}
+	return rec, a.store.put(ctx, rec.ID+"/"+MetaFile, meta)
+}
+
+// Get 读取存档元数据
+func (a *Archive) Get(ctx context.Context, id string) (Record, error) {
+	rec := Record{}
+	data, err := a.ReadFile(ctx, id, MetaFile)
+	if err != nil {
+		return rec, err
+	}
+	err = json.Unmarshal(data, &rec)
+	return rec, err
+}
+
+// ReadFile 读取存档中的文件
+func (a *Archive) ReadFile(ctx context.Context, id, name string) ([]byte, error) {
+	if !validID(id) || name == "" || path.Base(name) != name {
+		return nil, ErrNotFound
+	}
+	return a.store.get(ctx, id+"/"+name)
+}
+
+// Delete 删除存档
+func (a *Archive) Delete(ctx context.Context, id string) error {
+	if _, err := a.Get(ctx, id); err != nil {
+		return err
+	}
+	return a.store.remove(ctx, id)
+}
+
+// Purge 删除超过保留时长的存档, 返回删除数量
+func (a *Archive) Purge(ctx context.Context) (int, error) {
+	if a.cfg.Retention <= 0 {
+		return 0, nil
+	}
+	ids, err := a.store.list(ctx)
+	if err != nil {
+		return 0, err
+	}
+	deadline := time.Now().Add(-a.cfg.Retention)
+	n := 0
+	for _, id := range ids {
+		created, ok := idTime(id)
+		if !ok || !created.Before(deadline) {
+			continue
+		}
+		if err = a.store.remove(ctx, id); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (a *Archive) purgeLoop() {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		_, _ = a.Purge(context.Background())
+		<-ticker.C
+	}
+}
+
+// MaskKey 脱敏 API Key, 只保留前缀与末 4 位
+func MaskKey(key string) string {
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+	prefix := 3
+	if i := strings.IndexAny(key, "-_"); i >= 0 && i < 8 {
+		prefix = i + 1
+	}
+	return key[:prefix] + "..." + key[len(key)-4:]
+}
+
+// NewID 生成存档id, 以创建时间开头
+func NewID(created time.Time) string {
+	bs := make([]byte, 6)
+	_, _ = rand.Read(bs)
+	return created.UTC().Format(idTimeLayout) + "-" + hex.EncodeToString(bs)
+}
+
+func idTime(id string) (time.Time, bool) {
+	if len(id) < len(idTimeLayout) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(idTimeLayout, id[:len(idTimeLayout)])
+	return t, err == nil
+}
+
+func validID(id string) bool {
+	if _, ok := idTime(id); !ok {
+		return false
+	}
+	return !strings.ContainsAny(id, `/\.`)
+}
@@ -0,0 +1,134 @@
+package archive
+
+import (
+	"context"
+	"encoding/xml"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// _fakeS3 内存中的 S3, 只实现存档用到的接口
+func _fakeS3(t *testing.T) (*httptest.Server, map[string][]byte) {
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ak/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+
+		key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+		switch {
+		case r.Method == http.MethodPut:
+			objects[key], _ = io.ReadAll(r.Body)
+		case r.Method == http.MethodDelete:
+			delete(objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		case r.URL.Query().Get("list-type") == "2":
+			prefix, delimiter := r.URL.Query().Get("prefix"), r.URL.Query().Get("delimiter")
+			result := s3ListResult{}
+			seen := map[string]bool{}
+			for k := range objects {
+				if !strings.HasPrefix(k, prefix) {
+					continue
+				}
+				if i := strings.Index(k[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+					p := k[:len(prefix)+i+1]
+					if !seen[p] {
+						seen[p] = true
+						result.CommonPrefixes = append(result.CommonPrefixes, struct {
+							Prefix string `xml:"Prefix"`
+						}{p})
+					}
+					continue
+				}
+				result.Contents = append(result.Contents, struct {
+					Key string `xml:"Key"`
+				}{k})
+			}
+			_ = xml.NewEncoder(w).Encode(struct {
+				XMLName xml.Name `xml:"ListBucketResult"`
+				s3ListResult
+			}{s3ListResult: result})
+		default:
+			data, ok := objects[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(data)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, objects
+}
+
+func _testArchive(t *testing.T, a *Archive) {
+	ctx := context.Background()
+	assert.True(t, a.Enabled("sk-audit-0001"))
+	assert.False(t, a.Enabled("sk-other"))
+	assert.False(t, a.Enabled(""))
+
+	rec, err := a.Save(ctx, Record{Kind: KindTranscription, Key: "sk-audit-0001", Model: "whisper-1", Duration: 1.5, Text: "你好"},
+		map[string][]byte{"audio.wav": []byte("RIFF"), "transcript.json": []byte(`{"text":"你好"}`)})
+	assert.Empty(t, err)
+	assert.Equal(t, "sk-...0001", rec.Key)
+	assert.Equal(t, []string{"audio.wav", "transcript.json"}, rec.Files)
+
+	got, err := a.Get(ctx, rec.ID)
+	assert.Empty(t, err)
+	assert.Equal(t, rec.Text, got.Text)
+	assert.Equal(t, rec.Files, got.Files)
+	data, err := a.ReadFile(ctx, rec.ID, "audio.wav")
+	assert.Empty(t, err)
+	assert.Equal(t, "RIFF", string(data))
+	_, err = a.ReadFile(ctx, rec.ID, "../meta.json")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// 过期存档被清理
+	old, err := a.Save(ctx, Record{Kind: KindSpeech, Created: time.Now().Add(-100 * 24 * time.Hour)},
+		map[string][]byte{"speech.mp3": []byte("ID3")})
+	assert.Empty(t, err)
+	n, err := a.Purge(ctx)
+	assert.Empty(t, err)
+	assert.Equal(t, 1, n)
+	_, err = a.Get(ctx, old.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.Empty(t, a.Delete(ctx, rec.ID))
+	_, err = a.Get(ctx, rec.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, a.Delete(ctx, rec.ID), ErrNotFound)
+}
+
+func TestArchive_dir(t *testing.T) {
+	a, err := New(Config{Keys: []string{"sk-audit-0001"}, Retention: 90 * 24 * time.Hour, Dir: t.TempDir()})
+	assert.Empty(t, err)
+	_testArchive(t, a)
+}
+
+func TestArchive_s3(t *testing.T) {
+	server, objects := _fakeS3(t)
+	a, err := New(Config{
+		Keys:      []string{"sk-audit-0001"},
+		Retention: 90 * 24 * time.Hour,
+		S3:        &S3Config{Endpoint: server.URL, Bucket: "bucket", AccessKey: "ak", SecretKey: "sk", Prefix: "archive"},
+	})
+	assert.Empty(t, err)
+	_testArchive(t, a)
+	assert.Empty(t, objects)
+}
+
+func TestMaskKey(t *testing.T) {
+	assert.Equal(t, "sk-...cdef", MaskKey("sk-1234567890abcdef"))
+	assert.Equal(t, "****", MaskKey("abcd"))
+	assert.Equal(t, "abc...6789", MaskKey("abcdef123456789"))
+}
@@ -0,0 +1,242 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config 兼容 S3 的对象存储, 使用路径风格访问(endpoint/bucket/key), 适用于 AWS S3、MinIO 等
+type S3Config struct {
+	Endpoint  string `mapstructure:"endpoint"`
+	Region    string `mapstructure:"region"`
+	Bucket    string `mapstructure:"bucket"`
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+	// Prefix 对象键前缀, 如 "squidward/archive/"
+	Prefix string `mapstructure:"prefix"`
+}
+
+// s3Store 使用 AWS Signature V4 签名的最小 S3 客户端
+type s3Store struct {
+	cfg    S3Config
+	base   *url.URL
+	client *http.Client
+}
+
+func newS3Store(cfg S3Config) (*s3Store, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket are required")
+	}
+	base, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Prefix != "" && !strings.HasSuffix(cfg.Prefix, "/") {
+		cfg.Prefix += "/"
+	}
+	return &s3Store{cfg: cfg, base: base, client: &http.Client{Timeout: time.Minute}}, nil
+}
+
+func (s *s3Store) put(ctx context.Context, name string, data []byte) error {
+	res, err := s.do(ctx, http.MethodPut, s.cfg.Prefix+name, nil, data)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	return nil
+}
+
+func (s *s3Store) get(ctx context.Context, name string) ([]byte, error) {
+	res, err := s.do(ctx, http.MethodGet, s.cfg.Prefix+name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return io.ReadAll(res.Body)
+}
+
+func (s *s3Store) list(ctx context.Context) ([]string, error) {
+	var ids []string
+	err := s.listObjects(ctx, s.cfg.Prefix, "/", func(result s3ListResult) {
+		for _, p := range result.CommonPrefixes {
+			ids = append(ids, strings.TrimSuffix(strings.TrimPrefix(p.Prefix, s.cfg.Prefix), "/"))
+		}
+	})
+	return ids, err
+}
+
+func (s *s3Store) remove(ctx context.Context, id string) error {
+	var keys []string
+	err := s.listObjects(ctx, s.cfg.Prefix+id+"/", "", func(result s3ListResult) {
+		for _, obj := range result.Contents {
+			keys = append(keys, obj.Key)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		res, errd := s.do(ctx, http.MethodDelete, key, nil, nil)
+		if errd != nil {
+			return errd
+		}
+		_ = res.Body.Close()
+	}
+	return nil
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// listObjects ListObjectsV2, 自动翻页
+func (s *s3Store) listObjects(ctx context.Context, prefix, delimiter string, fn func(s3ListResult)) error {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		res, err := s.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return err
+		}
+		result := s3ListResult{}
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		_ = res.Body.Close()
+		if err != nil {
+			return err
+		}
+		fn(result)
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do 发送签名请求, 404 返回 ErrNotFound, 其他非 2xx 状态返回错误
+func (s *s3Store) do(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := *s.base
+	u.Path = "/" + s.cfg.Bucket + "/" + key
+	u.RawPath = "/" + s.cfg.Bucket + "/" + s3Escape(key, false)
+	u.RawQuery = s3Query(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, u.RawPath, body, time.Now().UTC())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		_ = res.Body.Close()
+		return nil, ErrNotFound
+	}
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		_ = res.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s: %s %s", method, key, res.Status, msg)
+	}
+	return res, nil
+}
+
+// sign AWS Signature V4
+func (s *s3Store) sign(req *http.Request, path string, body []byte, now time.Time) {
+	date := now.Format("20060102")
+	amzDate := now.Format("20060102T150405Z")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), date)
+	for _, part := range []string{s.cfg.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+// s3Query 按键排序并编码查询参数, 与签名的规范查询字符串一致
+func s3Query(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, s3Escape(k, true)+"="+s3Escape(query.Get(k), true))
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape URI 编码, 只保留 A-Z a-z 0-9 - _ . ~, 路径中保留 /
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
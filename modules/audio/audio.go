@@ -2,17 +2,21 @@ package audio
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/binary"
 	"errors"
 	"io"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func NewAudio(mime string) *Audio {
 	return &Audio{
-		Mime:   mime,
-		Frames: []Frame{},
+		Mime:    mime,
+		Frames:  []Frame{},
+		Created: time.Now(),
 	}
 }
 
@@ -22,8 +26,9 @@ type Frame struct {
 }
 
 type Audio struct {
-	Mime   string
-	Frames []Frame
+	Mime    string
+	Frames  []Frame
+	Created time.Time
 }
 
 func (a *Audio) AddFrame(index int, frame []byte) {
@@ -33,6 +38,36 @@ func (a *Audio) AddFrame(index int, frame []byte) {
 	})
 }
 
+// SetFrame 按序号写入帧, 已存在的序号被覆盖, 用于断点续传时重发的帧
+func (a *Audio) SetFrame(index int, frame []byte) {
+	i, found := slices.BinarySearchFunc(a.Frames, index, func(f Frame, index int) int {
+		return cmp.Compare(f.Index, index)
+	})
+	if found {
+		a.Frames[i].Data = frame
+		return
+	}
+	a.Frames = slices.Insert(a.Frames, i, Frame{Index: index, Data: frame})
+}
+
+// Indexes 已收到的帧序号
+func (a *Audio) Indexes() []int {
+	indexes := make([]int, 0, len(a.Frames))
+	for _, frame := range a.Frames {
+		indexes = append(indexes, frame.Index)
+	}
+	return indexes
+}
+
+// Size 已收到的数据字节数
+func (a *Audio) Size() int {
+	size := 0
+	for _, frame := range a.Frames {
+		size += len(frame.Data)
+	}
+	return size
+}
+
 func (a *Audio) AssembleFrames() []byte {
 	audioBytes := new(bytes.Buffer)
 	for _, frame := range a.Frames {
@@ -42,6 +77,15 @@ func (a *Audio) AssembleFrames() []byte {
 }
 
 func (a *Audio) ToAudioBytesReader() io.Reader {
+	if isMP3Mime(a.Mime) {
+		// mp3 按帧拼接, 不需要额外的音频头
+		bodyBytes, err := ConcatMP3(a.frameData()...)
+		if err != nil {
+			return nil
+		}
+		return bytes.NewReader(bodyBytes)
+	}
+
 	// 添加音频头
 	audioBytes := new(bytes.Buffer)
 	bodyBytes := a.AssembleFrames()
@@ -56,8 +100,62 @@ func (a *Audio) ToAudioBytesReader() io.Reader {
 	return audioBytes
 }
 
+// Ext ToAudioBytesReader 输出数据的扩展名, mp3 原样拼接, 其余添加音频头
+func (a *Audio) Ext() string {
+	switch {
+	case isMP3Mime(a.Mime):
+		return "mp3"
+	case mimeBase(a.Mime) == "audio/ogg", mimeBase(a.Mime) == "audio/opus":
+		return "ogg"
+	}
+	return "wav"
+}
+
+func (a *Audio) frameData() [][]byte {
+	chunks := make([][]byte, 0, len(a.Frames))
+	for _, frame := range a.Frames {
+		chunks = append(chunks, frame.Data)
+	}
+	return chunks
+}
+
+// Decode 将帧数据解码为pcm, 不支持mp3等压缩格式
+func (a *Audio) Decode() (*PCM, error) {
+	return DecodeRaw(a.AssembleFrames(), a.Mime)
+}
+
+// Duration 音频时长, mp3根据帧头计算, pcm根据采样率与位深计算
+func (a *Audio) Duration() (time.Duration, error) {
+	if isMP3Mime(a.Mime) {
+		return MP3Duration(bytes.Join(a.frameData(), nil))
+	}
+
+	props, err := parseMimeProperties(a.Mime)
+	if err != nil {
+		return 0, err
+	}
+	if props.bitsPerSample/8 == 0 {
+		return 0, errors.New("unsupported mime type")
+	}
+	return rawDuration(a.Size(), props), nil
+}
+
+func isMP3Mime(mime string) bool {
+	base := mimeBase(mime)
+	return base == "audio/mp3" || base == "audio/mpeg"
+}
+
+const (
+	wavFormatPCM   uint16 = 1
+	wavFormatFloat uint16 = 3
+	wavFormatALaw  uint16 = 6
+	wavFormatMuLaw uint16 = 7
+	wavFormatExt   uint16 = 0xFFFE
+)
+
 type audioProperties struct {
 	audioFormat   uint16
+	channels      uint16
 	sampleRate    uint32
 	bitsPerSample uint16
 }
@@ -72,14 +170,29 @@ func matchFormat(value string) uint16 {
 	return 0
 }
 
-func generateRIFFHeader(mime string, dataSize int) ([]byte, error) {
-	// TODO 优化
+// mimeBase 去掉参数的mime类型
+func mimeBase(mime string) string {
+	return strings.TrimSpace(strings.Split(mime, ";")[0])
+}
+
+func parseMimeProperties(mime string) (audioProperties, error) {
 	// Default properties
-	props := audioProperties{audioFormat: 1} // Default to PCM
+	props := audioProperties{audioFormat: wavFormatPCM, channels: 1} // Default to PCM
 
 	parts := strings.Split(mime, ";")
-	if len(parts) < 1 {
-		return nil, errors.New("invalid mime type")
+	base := mimeBase(mime)
+
+	switch base {
+	case "audio/basic", "audio/PCMU":
+		// G.711 μ-law
+		props.audioFormat = wavFormatMuLaw
+		props.bitsPerSample = 8
+		props.sampleRate = 8000
+	case "audio/x-alaw-basic", "audio/PCMA":
+		// G.711 A-law
+		props.audioFormat = wavFormatALaw
+		props.bitsPerSample = 8
+		props.sampleRate = 8000
 	}
 
 	for _, part := range parts[1:] {
@@ -87,62 +200,57 @@ func generateRIFFHeader(mime string, dataSize int) ([]byte, error) {
 		if len(keyValue) != 2 {
 			continue
 		}
-		key, value := keyValue[0], keyValue[1]
+		key, value := strings.TrimSpace(keyValue[0]), strings.TrimSpace(keyValue[1])
 		switch key {
 		case "rate":
 			sampleRate, err := strconv.Atoi(value)
-			if err != nil {
-				return nil, errors.New("invalid sample rate")
+			if err != nil || sampleRate <= 0 {
+				return props, errors.New("invalid sample rate")
 			}
 			props.sampleRate = uint32(sampleRate)
+		case "channels":
+			channels, err := strconv.Atoi(value)
+			if err != nil || channels <= 0 {
+				return props, errors.New("invalid channels")
+			}
+			props.channels = uint16(channels)
 		case "format":
-			props.bitsPerSample = matchFormat(value)
-			props.bitsPerSample = 8
+			if props.audioFormat == wavFormatPCM {
+				props.bitsPerSample = matchFormat(value)
+			}
 		}
 	}
 
 	if props.bitsPerSample == 0 {
-		fts := strings.Split(parts[0], "/")
-		if len(fts) < 1 {
-			return nil, errors.New("invalid mime type")
+		fts := strings.Split(base, "/")
+		if len(fts) < 2 {
+			return props, errors.New("invalid mime type")
 		}
 		props.bitsPerSample = matchFormat(fts[1])
 	}
 
 	if props.sampleRate == 0 || props.bitsPerSample == 0 {
-		return nil, errors.New("unsupported mime type")
+		return props, errors.New("unsupported mime type")
 	}
 
-	blockAlign := props.bitsPerSample / 8
-	byteRate := props.sampleRate * uint32(blockAlign)
+	return props, nil
+}
+
+func generateRIFFHeader(mime string, dataSize int) ([]byte, error) {
+	props, err := parseMimeProperties(mime)
+	if err != nil {
+		return nil, err
+	}
 
 	header := &bytes.Buffer{}
-	switch parts[0] {
-	case "audio/L16", "audio/x-raw", "audio/basic", "audio/x-alaw-basic":
-		header.Write([]byte("RIFF"))
-		binary.Write(header, binary.LittleEndian, uint32(36+dataSize))
-		header.Write([]byte("WAVE"))
-
-		header.Write([]byte("fmt "))
-		binary.Write(header, binary.LittleEndian, uint32(16))
-		binary.Write(header, binary.LittleEndian, props.audioFormat)
-		binary.Write(header, binary.LittleEndian, uint16(1))
-		binary.Write(header, binary.LittleEndian, props.sampleRate)
-		binary.Write(header, binary.LittleEndian, byteRate)
-		binary.Write(header, binary.LittleEndian, blockAlign)
-		binary.Write(header, binary.LittleEndian, props.bitsPerSample)
-
-		header.Write([]byte("data"))
-		binary.Write(header, binary.LittleEndian, uint32(dataSize))
+	switch mimeBase(mime) {
+	case "audio/L16", "audio/x-raw", "audio/basic", "audio/x-alaw-basic", "audio/PCMU", "audio/PCMA":
+		writeRIFFHeader(header, props, dataSize)
 
 	case "audio/ogg", "audio/opus":
 		header.Write([]byte("OggS"))
 		// OGG/Opus specific header fields can be added here
 
-	case "audio/mp3":
-		header.Write([]byte("ID3"))
-		// MP3 specific header fields can be added here
-
 	default:
 		return nil, errors.New("unsupported audio format")
 	}
@@ -150,7 +258,31 @@ func generateRIFFHeader(mime string, dataSize int) ([]byte, error) {
 	return header.Bytes(), nil
 }
 
+func writeRIFFHeader(header io.Writer, props audioProperties, dataSize int) {
+	blockAlign := props.bitsPerSample / 8 * props.channels
+	byteRate := props.sampleRate * uint32(blockAlign)
+
+	header.Write([]byte("RIFF"))
+	binary.Write(header, binary.LittleEndian, uint32(36+dataSize))
+	header.Write([]byte("WAVE"))
+
+	header.Write([]byte("fmt "))
+	binary.Write(header, binary.LittleEndian, uint32(16))
+	binary.Write(header, binary.LittleEndian, props.audioFormat)
+	binary.Write(header, binary.LittleEndian, props.channels)
+	binary.Write(header, binary.LittleEndian, props.sampleRate)
+	binary.Write(header, binary.LittleEndian, byteRate)
+	binary.Write(header, binary.LittleEndian, blockAlign)
+	binary.Write(header, binary.LittleEndian, props.bitsPerSample)
+
+	header.Write([]byte("data"))
+	binary.Write(header, binary.LittleEndian, uint32(dataSize))
+}
+
 func CheckMimeValid(mime string) bool {
+	if isMP3Mime(mime) {
+		return true
+	}
 	if _, err := generateRIFFHeader(mime, 0); err == nil {
 		return true
 	}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"cmp"
 	"fmt"
+	"github.com/stretchr/testify/assert"
 	"os"
 	"path"
 	"path/filepath"
@@ -78,3 +79,16 @@ func TestAudio_parseFrames(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestAudio_SetFrame(t *testing.T) {
+	af := NewAudio("audio/L16;rate=8000")
+	af.SetFrame(2, []byte("cc"))
+	af.SetFrame(0, []byte("a"))
+	af.SetFrame(1, []byte("b"))
+	// 重发的帧覆盖原数据
+	af.SetFrame(2, []byte("c"))
+
+	assert.Equal(t, []int{0, 1, 2}, af.Indexes())
+	assert.Equal(t, 3, af.Size())
+	assert.Equal(t, "abc", string(af.AssembleFrames()))
+}
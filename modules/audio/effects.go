@@ -0,0 +1,214 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// defaultSilenceThreshold 静音判定阈值(dBFS)
+	defaultSilenceThreshold = -50
+	// defaultSilencePadding 裁剪静音后两端保留的时长
+	defaultSilencePadding = 50 * time.Millisecond
+	// loudnessPeakLimit 响度规整后的峰值上限(dBFS), 避免削波
+	loudnessPeakLimit = -1
+)
+
+// 客户端可指定的后处理范围, 过小的变速倍率与过大的采样率会按比例放大输出
+const (
+	MinTempo      = 0.25
+	MaxTempo      = 4
+	MinSampleRate = 8000
+	MaxSampleRate = 48000
+)
+
+// PostProcessConfig TTS 音频后处理配置, 零值表示不处理
+type PostProcessConfig struct {
+	// SampleRate 输出采样率, 0 保持原采样率
+	SampleRate int `json:"sample_rate,omitempty" mapstructure:"sample_rate"`
+	// Loudness 目标响度(RMS dBFS), 如 -16, 0 不处理
+	Loudness float64 `json:"loudness,omitempty" mapstructure:"loudness"`
+	// TrimSilence 裁剪首尾静音
+	TrimSilence bool `json:"trim_silence,omitempty" mapstructure:"trim_silence"`
+	// Tempo 本地变速倍率(不变调), 用于不支持 speed 的后端, 0 或 1 不处理
+	Tempo float64 `json:"tempo,omitempty" mapstructure:"tempo"`
+}
+
+// IsZero 是否无需处理
+func (c PostProcessConfig) IsZero() bool {
+	return c.SampleRate <= 0 && c.Loudness == 0 && !c.TrimSilence && (c.Tempo <= 0 || c.Tempo == 1)
+}
+
+// Validate 检查变速倍率与采样率是否在允许范围内, 零值不处理
+func (c PostProcessConfig) Validate() error {
+	if c.Tempo != 0 && (c.Tempo < MinTempo || c.Tempo > MaxTempo) {
+		return fmt.Errorf("tempo must be between %v and %v", MinTempo, MaxTempo)
+	}
+	if c.SampleRate != 0 && (c.SampleRate < MinSampleRate || c.SampleRate > MaxSampleRate) {
+		return fmt.Errorf("sample_rate must be between %d and %d", MinSampleRate, MaxSampleRate)
+	}
+	return nil
+}
+
+// Apply 依次裁剪静音、变速、响度规整与重采样
+func (c PostProcessConfig) Apply(pcm *PCM) *PCM {
+	if c.TrimSilence {
+		pcm = pcm.TrimSilence(defaultSilenceThreshold, defaultSilencePadding)
+	}
+	if c.Tempo > 0 && c.Tempo != 1 {
+		pcm = pcm.Tempo(c.Tempo)
+	}
+	if c.Loudness != 0 {
+		pcm = pcm.NormalizeLoudness(c.Loudness)
+	}
+	if c.SampleRate > 0 {
+		pcm = pcm.Resample(c.SampleRate)
+	}
+	return pcm
+}
+
+// Loudness 整段音频的 RMS 响度(dBFS), 静音返回 -Inf
+func (p *PCM) Loudness() float64 {
+	return rmsDB(p.Samples)
+}
+
+// NormalizeLoudness 增益调整到目标响度, 峰值超过 -1dBFS 时降低增益
+func (p *PCM) NormalizeLoudness(target float64) *PCM {
+	current := p.Loudness()
+	if math.IsInf(current, -1) {
+		return p
+	}
+
+	gain := math.Pow(10, (target-current)/20)
+	peak := 0.0
+	for _, v := range p.Samples {
+		peak = math.Max(peak, math.Abs(float64(v)))
+	}
+	if limit := math.Pow(10, loudnessPeakLimit/20.0) * 32767; peak*gain > limit {
+		gain = limit / peak
+	}
+
+	samples := make([]int16, len(p.Samples))
+	for i, v := range p.Samples {
+		samples[i] = clampInt16(float64(v) * gain)
+	}
+	return &PCM{SampleRate: p.SampleRate, Channels: p.Channels, Samples: samples}
+}
+
+// TrimSilence 按 10ms 窗口裁剪首尾低于阈值(dBFS)的静音, 两端各保留 padding
+func (p *PCM) TrimSilence(threshold float64, padding time.Duration) *PCM {
+	frames := p.Frames()
+	window := max(p.SampleRate/100, 1)
+	silent := func(i int) bool {
+		end := min(i+window, frames)
+		return rmsDB(p.Samples[i*p.Channels:end*p.Channels]) < threshold
+	}
+
+	start := 0
+	for start < frames && silent(start) {
+		start += window
+	}
+	if start >= frames {
+		return &PCM{SampleRate: p.SampleRate, Channels: p.Channels}
+	}
+	end := frames
+	for end > start && silent(max(end-window, start)) {
+		end -= window
+	}
+
+	pad := int(int64(padding) * int64(p.SampleRate) / int64(time.Second))
+	start = max(start-pad, 0)
+	end = min(end+pad, frames)
+	return &PCM{
+		SampleRate: p.SampleRate,
+		Channels:   p.Channels,
+		Samples:    append([]int16(nil), p.Samples[start*p.Channels:end*p.Channels]...),
+	}
+}
+
+// Tempo 使用 WSOLA 变速不变调, rate 大于 1 加快
+func (p *PCM) Tempo(rate float64) *PCM {
+	frames := p.Frames()
+	if rate <= 0 || rate == 1 || frames == 0 {
+		return p
+	}
+
+	// 20ms 窗口, 50% 重叠, 在 ±5ms 内搜索与上一段自然延续最相似的位置
+	size := max(p.SampleRate/50, 16)
+	hop := size / 2
+	tolerance := size / 4
+	window := make([]float64, size)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size))
+	}
+
+	mono := p.Mono().Samples
+	at := func(i int) float64 {
+		if i < 0 || i >= frames {
+			return 0
+		}
+		return float64(mono[i])
+	}
+
+	outFrames := int(float64(frames)/rate) + size
+	out := make([]float64, outFrames*p.Channels)
+	prev := 0
+	written := 0
+	for k := 0; ; k++ {
+		pos := int(float64(k*hop) * rate)
+		if pos >= frames || k*hop+size > outFrames {
+			break
+		}
+
+		best := pos
+		if k > 0 {
+			natural := prev + hop
+			bestScore := math.Inf(-1)
+			for d := -tolerance; d <= tolerance; d++ {
+				score := 0.0
+				for i := 0; i < size; i += 2 {
+					score += at(natural+i) * at(pos+d+i)
+				}
+				if score > bestScore {
+					bestScore, best = score, pos+d
+				}
+			}
+			best = max(best, 0)
+		}
+
+		for i := 0; i < size; i++ {
+			src := best + i
+			if src >= frames {
+				break
+			}
+			for ch := 0; ch < p.Channels; ch++ {
+				out[(k*hop+i)*p.Channels+ch] += float64(p.Samples[src*p.Channels+ch]) * window[i]
+			}
+		}
+		prev = best
+		written = k*hop + size
+	}
+
+	written = min(written, int(float64(frames)/rate))
+	samples := make([]int16, written*p.Channels)
+	for i := range samples {
+		samples[i] = clampInt16(out[i])
+	}
+	return &PCM{SampleRate: p.SampleRate, Channels: p.Channels, Samples: samples}
+}
+
+func rmsDB(samples []int16) float64 {
+	if len(samples) == 0 {
+		return math.Inf(-1)
+	}
+	sum := 0.0
+	for _, v := range samples {
+		sum += float64(v) * float64(v)
+	}
+	rms := math.Sqrt(sum / float64(len(samples)))
+	if rms == 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(rms/32768)
+}
@@ -0,0 +1,82 @@
+package audio
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+// _zeroCrossings 过零次数, 用于估计频率
+func _zeroCrossings(samples []int16) int {
+	n := 0
+	for i := 1; i < len(samples); i++ {
+		if (samples[i-1] < 0) != (samples[i] < 0) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestPCM_NormalizeLoudness(t *testing.T) {
+	pcm, _ := DecodeRaw(_sineS16LE(16000, 1, 440, time.Second), "audio/L16;rate=16000")
+	// 幅度 10000 的正弦波约 -13.3dBFS
+	assert.InDelta(t, -13.3, pcm.Loudness(), 0.1)
+
+	assert.InDelta(t, -20, pcm.NormalizeLoudness(-20).Loudness(), 0.1)
+
+	// 峰值受限, 不削波
+	loud := pcm.NormalizeLoudness(0)
+	assert.InDelta(t, -4, loud.Loudness(), 0.1)
+
+	silent := &PCM{SampleRate: 16000, Channels: 1, Samples: make([]int16, 100)}
+	assert.Equal(t, silent, silent.NormalizeLoudness(-16))
+}
+
+func TestPCM_TrimSilence(t *testing.T) {
+	tone, _ := DecodeRaw(_sineS16LE(16000, 2, 440, time.Second), "audio/L16;rate=16000;channels=2")
+	pcm := &PCM{SampleRate: 16000, Channels: 2}
+	pcm.Samples = append(pcm.Samples, make([]int16, 16000)...)
+	pcm.Samples = append(pcm.Samples, tone.Samples...)
+	pcm.Samples = append(pcm.Samples, make([]int16, 32000)...)
+
+	trimmed := pcm.TrimSilence(-50, 50*time.Millisecond)
+	assert.Equal(t, 2, trimmed.Channels)
+	assert.InDelta(t, 1100*time.Millisecond, trimmed.Duration(), float64(20*time.Millisecond))
+
+	assert.Equal(t, 0, (&PCM{SampleRate: 16000, Channels: 1, Samples: make([]int16, 1600)}).TrimSilence(-50, 0).Frames())
+}
+
+func TestPCM_Tempo(t *testing.T) {
+	pcm, _ := DecodeRaw(_sineS16LE(16000, 1, 440, 2*time.Second), "audio/L16;rate=16000")
+
+	for _, rate := range []float64{2, 0.5, 1.25} {
+		out := pcm.Tempo(rate)
+		assert.InDelta(t, 2/rate, out.Duration().Seconds(), 0.05)
+		// 音高不变: 每秒过零次数约为 2*440
+		freq := float64(_zeroCrossings(out.Samples)) / out.Duration().Seconds() / 2
+		assert.InDelta(t, 440, freq, 15, "rate %v", rate)
+		assert.Less(t, math.Abs(out.Loudness()-pcm.Loudness()), 1.0)
+	}
+
+	assert.Equal(t, pcm, pcm.Tempo(1))
+}
+
+func TestPostProcessConfig_Apply(t *testing.T) {
+	assert.True(t, PostProcessConfig{Tempo: 1}.IsZero())
+
+	pcm, _ := DecodeRaw(_sineS16LE(24000, 1, 440, time.Second), "audio/L16;rate=24000")
+	out := PostProcessConfig{SampleRate: 16000, Tempo: 2, Loudness: -20}.Apply(pcm)
+	assert.Equal(t, 16000, out.SampleRate)
+	assert.InDelta(t, 0.5, out.Duration().Seconds(), 0.05)
+	assert.InDelta(t, -20, out.Loudness(), 0.5)
+}
+
+func TestPostProcessConfig_Validate(t *testing.T) {
+	assert.Empty(t, PostProcessConfig{}.Validate())
+	assert.Empty(t, PostProcessConfig{Tempo: 0.5, SampleRate: 16000}.Validate())
+	assert.NotEmpty(t, PostProcessConfig{Tempo: 0.0001}.Validate())
+	assert.NotEmpty(t, PostProcessConfig{Tempo: -1}.Validate())
+	assert.NotEmpty(t, PostProcessConfig{SampleRate: 2000000000}.Validate())
+	assert.NotEmpty(t, PostProcessConfig{SampleRate: 100}.Validate())
+}
@@ -0,0 +1,148 @@
+package audio
+
+import (
+	"fmt"
+	"time"
+)
+
+// Limits 上传音频限制, 0 表示不限制
+type Limits struct {
+	// MaxFileSize 单个文件或分帧上传合并后的最大字节数
+	MaxFileSize int64 `mapstructure:"max_file_size"`
+	// MaxFrameSize 分帧上传单帧最大字节数
+	MaxFrameSize int `mapstructure:"max_frame_size"`
+	// MaxFrames 分帧上传最大帧数
+	MaxFrames int `mapstructure:"max_frames"`
+	// MaxDuration 音频最大时长, 分帧上传按已收到的数据累计
+	MaxDuration time.Duration `mapstructure:"max_duration"`
+	// MaxSampleRate 最大采样率
+	MaxSampleRate int `mapstructure:"max_sample_rate"`
+}
+
+// 超出限制的类型, 与 OpenAI 错误的 code 字段对应
+const (
+	LimitFileSize   = "file_too_large"
+	LimitFrameSize  = "frame_too_large"
+	LimitFrames     = "too_many_frames"
+	LimitDuration   = "audio_too_long"
+	LimitSampleRate = "sample_rate_too_high"
+)
+
+// LimitError 音频超出限制
+type LimitError struct {
+	Code    string
+	Message string
+}
+
+func (e *LimitError) Error() string {
+	return e.Message
+}
+
+func limitError(code, format string, args ...any) *LimitError {
+	return &LimitError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// CheckFile 检查完整的音频文件, 无法解析时长与采样率的格式(如 ogg)只检查大小
+func (l Limits) CheckFile(data []byte, mime string) error {
+	if l.MaxFileSize > 0 && int64(len(data)) > l.MaxFileSize {
+		return limitError(LimitFileSize, "audio file is %d bytes, maximum is %d bytes", len(data), l.MaxFileSize)
+	}
+	if l.MaxDuration <= 0 && l.MaxSampleRate <= 0 {
+		return nil
+	}
+
+	rate, duration, ok := Probe(data, mime)
+	if !ok {
+		return nil
+	}
+	return l.checkAudio(rate, duration)
+}
+
+// Probe 解析音频的采样率与时长, 支持 wav、mp3 与裸数据
+func Probe(data []byte, mime string) (int, time.Duration, bool) {
+	switch {
+	case IsWAV(data):
+		pcm, err := DecodeWAV(data)
+		if err != nil {
+			return 0, 0, false
+		}
+		return pcm.SampleRate, pcm.Duration(), true
+	case Sniff(data) == MimeMP3:
+		frames := ParseMP3Frames(data)
+		if len(frames) == 0 {
+			return 0, 0, false
+		}
+		duration, _ := MP3Duration(data)
+		return frames[0].Header.SampleRate, duration, true
+	}
+	props, err := parseMimeProperties(mime)
+	if err != nil {
+		return 0, 0, false
+	}
+	return int(props.sampleRate), rawDuration(len(data), props), true
+}
+
+// CheckFrame 写入一帧前检查分帧上传的音频, 重发的帧覆盖原数据不计入帧数
+func (l Limits) CheckFrame(a *Audio, index int, frame []byte) error {
+	frames, size := len(a.Frames)+1, a.Size()+len(frame)
+	for _, f := range a.Frames {
+		if f.Index == index {
+			frames, size = frames-1, size-len(f.Data)
+			break
+		}
+	}
+	return l.CheckStream(a.Mime, frames, size, frame)
+}
+
+// CheckStream 检查流式上传的音频, frames 与 size 为包含当前帧在内的累计帧数与字节数
+func (l Limits) CheckStream(mime string, frames, size int, frame []byte) error {
+	if l.MaxFrameSize > 0 && len(frame) > l.MaxFrameSize {
+		return limitError(LimitFrameSize, "audio frame is %d bytes, maximum is %d bytes", len(frame), l.MaxFrameSize)
+	}
+	if l.MaxFrames > 0 && frames > l.MaxFrames {
+		return limitError(LimitFrames, "audio has %d frames, maximum is %d frames", frames, l.MaxFrames)
+	}
+	if l.MaxFileSize > 0 && int64(size) > l.MaxFileSize {
+		return limitError(LimitFileSize, "audio is %d bytes, maximum is %d bytes", size, l.MaxFileSize)
+	}
+	if l.MaxDuration <= 0 && l.MaxSampleRate <= 0 {
+		return nil
+	}
+
+	if isMP3Mime(mime) {
+		parsed := ParseMP3Frames(frame)
+		if len(parsed) == 0 {
+			return nil
+		}
+		// 按当前帧的码率估算时长, 避免每帧都重新解析全部数据
+		h := parsed[0].Header
+		if h.Bitrate <= 0 {
+			return l.checkAudio(h.SampleRate, 0)
+		}
+		return l.checkAudio(h.SampleRate, time.Duration(int64(size)*8*int64(time.Second)/int64(h.Bitrate*1000)))
+	}
+	props, err := parseMimeProperties(mime)
+	if err != nil {
+		return nil
+	}
+	return l.checkAudio(int(props.sampleRate), rawDuration(size, props))
+}
+
+func (l Limits) checkAudio(rate int, duration time.Duration) error {
+	if l.MaxSampleRate > 0 && rate > l.MaxSampleRate {
+		return limitError(LimitSampleRate, "audio sample rate is %d Hz, maximum is %d Hz", rate, l.MaxSampleRate)
+	}
+	if l.MaxDuration > 0 && duration > l.MaxDuration {
+		return limitError(LimitDuration, "audio duration is %s, maximum is %s", duration.Round(time.Millisecond), l.MaxDuration)
+	}
+	return nil
+}
+
+// rawDuration 裸数据时长
+func rawDuration(size int, props audioProperties) time.Duration {
+	byteRate := int64(props.sampleRate) * int64(props.bitsPerSample/8) * int64(props.channels)
+	if byteRate == 0 {
+		return 0
+	}
+	return time.Duration(int64(size) * int64(time.Second) / byteRate)
+}
@@ -0,0 +1,58 @@
+package audio
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLimits_CheckFile(t *testing.T) {
+	pcm, _ := DecodeRaw(_sineS16LE(16000, 1, 440, 2*time.Second), "audio/L16;rate=16000")
+	wav := pcm.EncodeWAV()
+
+	assert.Empty(t, Limits{}.CheckFile(wav, "audio/wav"))
+	assert.Empty(t, Limits{MaxDuration: 3 * time.Second, MaxSampleRate: 16000}.CheckFile(wav, "audio/wav"))
+
+	var err *LimitError
+	assert.ErrorAs(t, Limits{MaxFileSize: 1000}.CheckFile(wav, "audio/wav"), &err)
+	assert.Equal(t, LimitFileSize, err.Code)
+	assert.ErrorAs(t, Limits{MaxDuration: time.Second}.CheckFile(wav, "audio/wav"), &err)
+	assert.Equal(t, LimitDuration, err.Code)
+	assert.ErrorAs(t, Limits{MaxSampleRate: 8000}.CheckFile(pcm.Bytes(), "audio/L16;rate=16000"), &err)
+	assert.Equal(t, LimitSampleRate, err.Code)
+
+	mp3 := _mp3Chunk(100)
+	d, _ := MP3Duration(mp3)
+	assert.Empty(t, Limits{MaxDuration: d}.CheckFile(mp3, "audio/mpeg"))
+	assert.ErrorAs(t, Limits{MaxDuration: d / 2}.CheckFile(mp3, "audio/mpeg"), &err)
+}
+
+func TestLimits_CheckFrame(t *testing.T) {
+	a := NewAudio("audio/L16;rate=8000")
+	frame := make([]byte, 8000) // 0.5s
+	limits := Limits{MaxFrameSize: 8000, MaxFrames: 3, MaxDuration: 1500 * time.Millisecond}
+
+	for i := 0; i < 3; i++ {
+		assert.Empty(t, limits.CheckFrame(a, i, frame))
+		a.SetFrame(i, frame)
+	}
+	// 重发的帧不计入
+	assert.Empty(t, limits.CheckFrame(a, 2, frame))
+
+	var err *LimitError
+	assert.ErrorAs(t, limits.CheckFrame(a, 3, frame), &err)
+	assert.Equal(t, LimitFrames, err.Code)
+	assert.ErrorAs(t, limits.CheckFrame(a, 2, make([]byte, 8001)), &err)
+	assert.Equal(t, LimitFrameSize, err.Code)
+
+	limits.MaxFrames = 0
+	assert.ErrorAs(t, limits.CheckFrame(a, 3, frame), &err)
+	assert.Equal(t, LimitDuration, err.Code)
+
+	// 按码率估算 mp3 时长
+	mp3 := NewAudio("audio/mpeg")
+	data := _mp3Chunk(100)
+	d, _ := MP3Duration(data)
+	assert.Empty(t, Limits{MaxDuration: d + 100*time.Millisecond}.CheckFrame(mp3, 0, data))
+	assert.ErrorAs(t, Limits{MaxDuration: d / 2}.CheckFrame(mp3, 0, data), &err)
+}
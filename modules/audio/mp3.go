@@ -0,0 +1,252 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNoMP3Frames = errors.New("no mp3 frames found")
+)
+
+// MP3 比特率表 kbps, 索引 [版本][层][比特率索引]
+var mp3Bitrates = [2][3][16]int{
+	// MPEG1
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, -1}, // Layer I
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, -1},    // Layer II
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, -1},     // Layer III
+	},
+	// MPEG2 / MPEG2.5
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, -1}, // Layer I
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, -1},      // Layer II
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, -1},      // Layer III
+	},
+}
+
+// MP3 采样率表, 索引 [版本][采样率索引]
+var mp3SampleRates = map[int][3]int{
+	mp3Version1:  {44100, 48000, 32000},
+	mp3Version2:  {22050, 24000, 16000},
+	mp3Version25: {11025, 12000, 8000},
+}
+
+const (
+	mp3Version25 = 0
+	mp3Version2  = 2
+	mp3Version1  = 3
+
+	mp3Layer3 = 1
+	mp3Layer2 = 2
+	mp3Layer1 = 3
+)
+
+// MP3FrameHeader mp3帧头信息
+type MP3FrameHeader struct {
+	Version    int
+	Layer      int
+	Bitrate    int // kbps
+	SampleRate int
+	Padding    bool
+	Mono       bool
+	Length     int // 包含帧头的帧长度
+	Samples    int // 每帧采样数
+}
+
+// parseMP3FrameHeader 解析4字节帧头
+func parseMP3FrameHeader(b []byte) (MP3FrameHeader, bool) {
+	h := MP3FrameHeader{}
+	if len(b) < 4 {
+		return h, false
+	}
+	if b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return h, false
+	}
+
+	h.Version = int(b[1]>>3) & 0x03
+	h.Layer = int(b[1]>>1) & 0x03
+	bitrateIndex := int(b[2]>>4) & 0x0F
+	rateIndex := int(b[2]>>2) & 0x03
+	h.Padding = (b[2]>>1)&0x01 == 1
+	h.Mono = (b[3]>>6)&0x03 == 3
+
+	if h.Version == 1 || h.Layer == 0 || rateIndex == 3 {
+		return h, false
+	}
+
+	vi := 0
+	if h.Version != mp3Version1 {
+		vi = 1
+	}
+	li := 3 - h.Layer
+	h.Bitrate = mp3Bitrates[vi][li][bitrateIndex]
+	// 不支持 free 格式
+	if h.Bitrate <= 0 {
+		return h, false
+	}
+	h.SampleRate = mp3SampleRates[h.Version][rateIndex]
+
+	padding := 0
+	if h.Padding {
+		padding = 1
+	}
+
+	switch h.Layer {
+	case mp3Layer1:
+		h.Samples = 384
+		h.Length = (12*h.Bitrate*1000/h.SampleRate + padding) * 4
+	case mp3Layer2:
+		h.Samples = 1152
+		h.Length = 144*h.Bitrate*1000/h.SampleRate + padding
+	case mp3Layer3:
+		if h.Version == mp3Version1 {
+			h.Samples = 1152
+			h.Length = 144*h.Bitrate*1000/h.SampleRate + padding
+		} else {
+			h.Samples = 576
+			h.Length = 72*h.Bitrate*1000/h.SampleRate + padding
+		}
+	}
+
+	if h.Length < 4 {
+		return h, false
+	}
+
+	return h, true
+}
+
+// isMP3InfoFrame 判断是否为 Xing/Info/VBRI 信息帧, 此类帧不含音频且仅在流开头有效
+func isMP3InfoFrame(h MP3FrameHeader, frame []byte) bool {
+	sideInfo := 32
+	if h.Version == mp3Version1 {
+		if h.Mono {
+			sideInfo = 17
+		}
+	} else {
+		sideInfo = 17
+		if h.Mono {
+			sideInfo = 9
+		}
+	}
+
+	if off := 4 + sideInfo; len(frame) >= off+4 {
+		tag := string(frame[off : off+4])
+		if tag == "Xing" || tag == "Info" {
+			return true
+		}
+	}
+
+	if len(frame) >= 36+4 && string(frame[36:40]) == "VBRI" {
+		return true
+	}
+	return false
+}
+
+// id3v2Size 返回 ID3v2 标签总长度, 非标签返回0
+func id3v2Size(b []byte) int {
+	if len(b) < 10 || string(b[0:3]) != "ID3" {
+		return 0
+	}
+	// synchsafe 整数
+	for _, c := range b[6:10] {
+		if c&0x80 != 0 {
+			return 0
+		}
+	}
+	size := int(b[6])<<21 | int(b[7])<<14 | int(b[8])<<7 | int(b[9])
+	size += 10
+	// footer
+	if b[5]&0x10 != 0 {
+		size += 10
+	}
+	return size
+}
+
+// MP3Frame 一个mp3音频帧
+type MP3Frame struct {
+	Header MP3FrameHeader
+	Data   []byte
+}
+
+// ParseMP3Frames 按帧边界解析mp3数据, 跳过 ID3v1/ID3v2 标签、Xing/Info/VBRI 信息帧以及无法识别的字节
+func ParseMP3Frames(data []byte) []MP3Frame {
+	frames := []MP3Frame{}
+
+	for i := 0; i < len(data); {
+		if n := id3v2Size(data[i:]); n > 0 {
+			i += n
+			continue
+		}
+
+		if len(data)-i >= 128 && string(data[i:i+3]) == "TAG" {
+			i += 128
+			continue
+		}
+
+		h, ok := parseMP3FrameHeader(data[i:])
+		if !ok || i+h.Length > len(data) {
+			i++
+			continue
+		}
+
+		// 校验下一帧, 避免把数据中的伪同步字当作帧头
+		next := i + h.Length
+		if next < len(data) && !isMP3Boundary(data[next:]) {
+			i++
+			continue
+		}
+
+		frame := data[i:next]
+		if !isMP3InfoFrame(h, frame) {
+			frames = append(frames, MP3Frame{Header: h, Data: frame})
+		}
+		i = next
+	}
+
+	return frames
+}
+
+// isMP3Boundary 判断是否为帧或标签的起始
+func isMP3Boundary(b []byte) bool {
+	if _, ok := parseMP3FrameHeader(b); ok {
+		return true
+	}
+	if id3v2Size(b) > 0 {
+		return true
+	}
+	if len(b) >= 3 && string(b[0:3]) == "TAG" {
+		return true
+	}
+	return false
+}
+
+// ConcatMP3 将多个mp3片段按帧拼接为一个完整的音频流, 去除各片段中重复的标签与信息帧
+// 片段可能在帧中间被截断, 因此先整体拼接再按帧重新解析
+func ConcatMP3(chunks ...[]byte) ([]byte, error) {
+	frames := ParseMP3Frames(bytes.Join(chunks, nil))
+	if len(frames) == 0 {
+		return nil, ErrNoMP3Frames
+	}
+
+	buf := new(bytes.Buffer)
+	for _, frame := range frames {
+		buf.Write(frame.Data)
+	}
+	return buf.Bytes(), nil
+}
+
+// MP3Duration 根据帧头计算mp3时长
+func MP3Duration(data []byte) (time.Duration, error) {
+	frames := ParseMP3Frames(data)
+	if len(frames) == 0 {
+		return 0, ErrNoMP3Frames
+	}
+
+	seconds := float64(0)
+	for _, frame := range frames {
+		seconds += float64(frame.Header.Samples) / float64(frame.Header.SampleRate)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,87 @@
+package audio
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// _mp3Frame 生成 MPEG1 Layer III 128kbps 44.1kHz 立体声的静音帧
+func _mp3Frame(tag string) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+	if tag != "" {
+		copy(frame[4+32:], tag)
+	}
+	return frame
+}
+
+func _id3v2(size int) []byte {
+	tag := []byte{'I', 'D', '3', 4, 0, 0, byte(size >> 21 & 0x7F), byte(size >> 14 & 0x7F), byte(size >> 7 & 0x7F), byte(size & 0x7F)}
+	return append(tag, make([]byte, size)...)
+}
+
+func _mp3Chunk(frames int) []byte {
+	buf := new(bytes.Buffer)
+	buf.Write(_id3v2(300))
+	buf.Write(_mp3Frame("Xing"))
+	for i := 0; i < frames; i++ {
+		buf.Write(_mp3Frame(""))
+	}
+	id3v1 := make([]byte, 128)
+	copy(id3v1, "TAG")
+	buf.Write(id3v1)
+	return buf.Bytes()
+}
+
+func TestParseMP3FrameHeader(t *testing.T) {
+	h, ok := parseMP3FrameHeader(_mp3Frame(""))
+	assert.True(t, ok)
+	assert.Equal(t, 128, h.Bitrate)
+	assert.Equal(t, 44100, h.SampleRate)
+	assert.Equal(t, 417, h.Length)
+	assert.Equal(t, 1152, h.Samples)
+
+	_, ok = parseMP3FrameHeader([]byte("ID3\x04"))
+	assert.False(t, ok)
+}
+
+func TestConcatMP3(t *testing.T) {
+	data, err := ConcatMP3(_mp3Chunk(10), _mp3Chunk(5))
+	assert.Empty(t, err)
+	assert.Equal(t, 15*417, len(data))
+	assert.Equal(t, byte(0xFF), data[0])
+
+	frames := ParseMP3Frames(data)
+	assert.Equal(t, 15, len(frames))
+
+	_, err = ConcatMP3([]byte("ID3"))
+	assert.ErrorIs(t, err, ErrNoMP3Frames)
+}
+
+func TestConcatMP3_splitFrames(t *testing.T) {
+	// 片段在帧中间截断
+	whole := _mp3Chunk(8)
+	data, err := ConcatMP3(whole[:1000], whole[1000:2500], whole[2500:])
+	assert.Empty(t, err)
+	assert.Equal(t, 8*417, len(data))
+}
+
+func TestAudio_Duration(t *testing.T) {
+	af := NewAudio("audio/mp3")
+	af.AddFrame(0, _mp3Chunk(100))
+	d, err := af.Duration()
+	assert.Empty(t, err)
+	assert.InDelta(t, float64(100*1152)/44100, d.Seconds(), 0.001)
+
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(af.ToAudioBytesReader())
+	assert.Equal(t, 100*417, buf.Len())
+
+	pcm := NewAudio("audio/L16;rate=8000")
+	pcm.AddFrame(0, make([]byte, 16000))
+	d, err = pcm.Duration()
+	assert.Empty(t, err)
+	assert.Equal(t, time.Second, d)
+}
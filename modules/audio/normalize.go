@@ -0,0 +1,31 @@
+package audio
+
+// NormalizeConfig 音频规整配置, 统一转换为 S16LE wav
+type NormalizeConfig struct {
+	// 目标采样率, 0 表示保持原采样率
+	SampleRate int `mapstructure:"sample_rate"`
+	// 是否混合为单声道
+	Mono bool `mapstructure:"mono"`
+}
+
+// Normalize 解码 wav/pcm/A-law/μ-law 音频, 按配置混音、重采样后输出 S16LE wav
+// mime 用于解析无文件头的裸数据, 输入为 wav 时忽略
+func Normalize(data []byte, mime string, cfg NormalizeConfig) ([]byte, error) {
+	pcm, err := Decode(data, mime)
+	if err != nil {
+		return nil, err
+	}
+
+	return NormalizePCM(pcm, cfg).EncodeWAV(), nil
+}
+
+// NormalizePCM 按配置混音、重采样
+func NormalizePCM(pcm *PCM, cfg NormalizeConfig) *PCM {
+	if cfg.Mono {
+		pcm = pcm.Mono()
+	}
+	if cfg.SampleRate > 0 {
+		pcm = pcm.Resample(cfg.SampleRate)
+	}
+	return pcm
+}
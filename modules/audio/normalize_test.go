@@ -0,0 +1,43 @@
+package audio
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestNormalize(t *testing.T) {
+	af := NewAudio("audio/L16;rate=44100;channels=2")
+	af.AddFrame(0, _sineS16LE(44100, 2, 440, time.Second))
+
+	buf, err := Normalize(af.AssembleFrames(), af.Mime, NormalizeConfig{SampleRate: 16000, Mono: true})
+	assert.Empty(t, err)
+
+	pcm, err := DecodeWAV(buf)
+	assert.Empty(t, err)
+	assert.Equal(t, 16000, pcm.SampleRate)
+	assert.Equal(t, 1, pcm.Channels)
+	assert.InDelta(t, 16000, pcm.Frames(), 1)
+
+	// 正弦波幅度应基本保持
+	peak := int16(0)
+	for _, v := range pcm.Samples[100 : len(pcm.Samples)-100] {
+		peak = max(peak, v)
+	}
+	assert.InDelta(t, 10000, peak, 300)
+}
+
+func TestNormalize_wav(t *testing.T) {
+	af := NewAudio("audio/x-alaw-basic")
+	af.AddFrame(0, make([]byte, 8000))
+
+	wav, _ := io.ReadAll(af.ToAudioBytesReader())
+	buf, err := Normalize(wav, "", NormalizeConfig{SampleRate: 16000})
+	assert.Empty(t, err)
+
+	pcm, err := DecodeWAV(buf)
+	assert.Empty(t, err)
+	assert.Equal(t, 16000, pcm.SampleRate)
+	assert.Equal(t, 16000, pcm.Frames())
+}
@@ -0,0 +1,332 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+var (
+	ErrNotWAV          = errors.New("not a wav file")
+	ErrUnsupportedWAV  = errors.New("unsupported wav format")
+	ErrUnsupportedMime = errors.New("unsupported mime type")
+)
+
+// PCM 解码后的 16bit 有符号交错采样
+type PCM struct {
+	SampleRate int
+	Channels   int
+	Samples    []int16
+}
+
+// Frames 每声道采样数
+func (p *PCM) Frames() int {
+	if p.Channels == 0 {
+		return 0
+	}
+	return len(p.Samples) / p.Channels
+}
+
+// Duration 时长
+func (p *PCM) Duration() time.Duration {
+	if p.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(int64(p.Frames()) * int64(time.Second) / int64(p.SampleRate))
+}
+
+// Bytes S16LE 裸数据
+func (p *PCM) Bytes() []byte {
+	bs := make([]byte, len(p.Samples)*2)
+	for i, v := range p.Samples {
+		binary.LittleEndian.PutUint16(bs[i*2:], uint16(v))
+	}
+	return bs
+}
+
+// EncodeWAV 编码为 S16LE wav
+func (p *PCM) EncodeWAV() []byte {
+	body := p.Bytes()
+	buf := new(bytes.Buffer)
+	writeRIFFHeader(buf, audioProperties{
+		audioFormat:   wavFormatPCM,
+		channels:      uint16(p.Channels),
+		sampleRate:    uint32(p.SampleRate),
+		bitsPerSample: 16,
+	}, len(body))
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// ConcatWAV 拼接多个 wav, 采样率与声道数以第一个为准
+func ConcatWAV(chunks ...[]byte) ([]byte, error) {
+	var out *PCM
+	for _, chunk := range chunks {
+		pcm, err := DecodeWAV(chunk)
+		if err != nil {
+			return nil, err
+		}
+		if out == nil {
+			out = &PCM{SampleRate: pcm.SampleRate, Channels: pcm.Channels}
+		}
+		if pcm.Channels != out.Channels {
+			if out.Channels != 1 {
+				return nil, ErrUnsupportedWAV
+			}
+			pcm = pcm.Mono()
+		}
+		if pcm.SampleRate != out.SampleRate {
+			pcm = pcm.Resample(out.SampleRate)
+		}
+		out.Samples = append(out.Samples, pcm.Samples...)
+	}
+	if out == nil {
+		return nil, ErrNotWAV
+	}
+	return out.EncodeWAV(), nil
+}
+
+// Encode 按mime编码为裸数据, 支持 S16LE、A-law 与 μ-law, 声道与采样率保持不变
+func (p *PCM) Encode(mime string) ([]byte, error) {
+	props, err := parseMimeProperties(mime)
+	if err != nil {
+		return nil, ErrUnsupportedMime
+	}
+
+	switch {
+	case props.audioFormat == wavFormatPCM && props.bitsPerSample == 16:
+		return p.Bytes(), nil
+	case props.audioFormat == wavFormatALaw:
+		bs := make([]byte, len(p.Samples))
+		for i, v := range p.Samples {
+			bs[i] = linearToAlaw(v)
+		}
+		return bs, nil
+	case props.audioFormat == wavFormatMuLaw:
+		bs := make([]byte, len(p.Samples))
+		for i, v := range p.Samples {
+			bs[i] = linearToUlaw(v)
+		}
+		return bs, nil
+	}
+	return nil, ErrUnsupportedMime
+}
+
+// IsWAV 根据文件头判断是否为wav
+func IsWAV(data []byte) bool {
+	return len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE"
+}
+
+// DecodeWAV 解码 wav, 支持 8/16/24/32bit PCM、32bit 浮点、A-law 与 μ-law
+func DecodeWAV(data []byte) (*PCM, error) {
+	if !IsWAV(data) {
+		return nil, ErrNotWAV
+	}
+
+	var props *audioProperties
+	var body []byte
+
+	for i := 12; i+8 <= len(data); {
+		id := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4 : i+8]))
+		start := i + 8
+		end := start + size
+		// 流式写入的 wav 可能没有正确的长度
+		if size < 0 || end > len(data) {
+			end = len(data)
+		}
+
+		switch id {
+		case "fmt ":
+			chunk := data[start:end]
+			if len(chunk) < 16 {
+				return nil, ErrUnsupportedWAV
+			}
+			props = &audioProperties{
+				audioFormat:   binary.LittleEndian.Uint16(chunk[0:2]),
+				channels:      binary.LittleEndian.Uint16(chunk[2:4]),
+				sampleRate:    binary.LittleEndian.Uint32(chunk[4:8]),
+				bitsPerSample: binary.LittleEndian.Uint16(chunk[14:16]),
+			}
+			// WAVE_FORMAT_EXTENSIBLE, 子格式GUID的前两个字节为实际格式
+			if props.audioFormat == wavFormatExt && len(chunk) >= 26 {
+				props.audioFormat = binary.LittleEndian.Uint16(chunk[24:26])
+			}
+		case "data":
+			body = data[start:end]
+		}
+
+		if body != nil && props != nil {
+			break
+		}
+		// 块按偶数字节对齐
+		i = end + end%2
+	}
+
+	if props == nil || body == nil {
+		return nil, ErrUnsupportedWAV
+	}
+
+	return decodeSamples(body, *props)
+}
+
+// DecodeRaw 根据mime类型解码无文件头的音频数据
+func DecodeRaw(data []byte, mime string) (*PCM, error) {
+	props, err := parseMimeProperties(mime)
+	if err != nil {
+		return nil, ErrUnsupportedMime
+	}
+	return decodeSamples(data, props)
+}
+
+// Decode 解码音频, wav 按文件头解析, 其余按mime解析
+func Decode(data []byte, mime string) (*PCM, error) {
+	if IsWAV(data) {
+		return DecodeWAV(data)
+	}
+	return DecodeRaw(data, mime)
+}
+
+func decodeSamples(body []byte, props audioProperties) (*PCM, error) {
+	if props.channels == 0 || props.sampleRate == 0 {
+		return nil, ErrUnsupportedWAV
+	}
+
+	width := int(props.bitsPerSample) / 8
+	var conv func([]byte) int16
+
+	switch props.audioFormat {
+	case wavFormatPCM:
+		switch props.bitsPerSample {
+		case 8:
+			conv = func(b []byte) int16 { return int16(int(b[0])-128) << 8 }
+		case 16:
+			conv = func(b []byte) int16 { return int16(binary.LittleEndian.Uint16(b)) }
+		case 24:
+			conv = func(b []byte) int16 { return int16(uint16(b[1]) | uint16(b[2])<<8) }
+		case 32:
+			conv = func(b []byte) int16 { return int16(binary.LittleEndian.Uint32(b) >> 16) }
+		}
+	case wavFormatFloat:
+		if props.bitsPerSample == 32 {
+			conv = func(b []byte) int16 {
+				return floatToInt16(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
+			}
+		}
+	case wavFormatALaw:
+		if props.bitsPerSample == 8 {
+			conv = func(b []byte) int16 { return alawToLinear(b[0]) }
+		}
+	case wavFormatMuLaw:
+		if props.bitsPerSample == 8 {
+			conv = func(b []byte) int16 { return ulawToLinear(b[0]) }
+		}
+	}
+
+	if conv == nil {
+		return nil, ErrUnsupportedWAV
+	}
+
+	count := len(body) / width
+	count -= count % int(props.channels)
+	samples := make([]int16, count)
+	for i := 0; i < count; i++ {
+		samples[i] = conv(body[i*width : i*width+width])
+	}
+
+	return &PCM{
+		SampleRate: int(props.sampleRate),
+		Channels:   int(props.channels),
+		Samples:    samples,
+	}, nil
+}
+
+func floatToInt16(v float64) int16 {
+	v = math.Round(v * 32767)
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+// alawToLinear G.711 A-law 解码
+func alawToLinear(a byte) int16 {
+	a ^= 0x55
+	t := int16(a&0x0F) << 4
+	seg := (a & 0x70) >> 4
+	switch seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= seg - 1
+	}
+	if a&0x80 != 0 {
+		return t
+	}
+	return -t
+}
+
+// ulawToLinear G.711 μ-law 解码
+func ulawToLinear(u byte) int16 {
+	u = ^u
+	t := (int16(u&0x0F) << 3) + 0x84
+	t <<= (u & 0x70) >> 4
+	if u&0x80 != 0 {
+		return 0x84 - t
+	}
+	return t - 0x84
+}
+
+// linearToAlaw G.711 A-law 编码
+func linearToAlaw(s int16) byte {
+	v := int(s)
+	sign := 0x80
+	if v < 0 {
+		v = -v
+		sign = 0
+	}
+	if v > 32635 {
+		v = 32635
+	}
+
+	var exp, mant int
+	if v >= 256 {
+		exp = 7
+		for mask := 0x4000; v&mask == 0 && exp > 1; mask >>= 1 {
+			exp--
+		}
+		mant = (v >> (exp + 3)) & 0x0F
+	} else {
+		mant = v >> 4
+	}
+	return byte(sign|exp<<4|mant) ^ 0x55
+}
+
+// linearToUlaw G.711 μ-law 编码
+func linearToUlaw(s int16) byte {
+	v := int(s)
+	sign := 0
+	if v < 0 {
+		v = -v
+		sign = 0x80
+	}
+	if v > 32635 {
+		v = 32635
+	}
+	v += 0x84
+
+	exp := 7
+	for mask := 0x4000; v&mask == 0 && exp > 0; mask >>= 1 {
+		exp--
+	}
+	mant := (v >> (exp + 3)) & 0x0F
+	return ^byte(sign | exp<<4 | mant)
+}
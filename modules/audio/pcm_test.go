@@ -0,0 +1,98 @@
+package audio
+
+import (
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+func _sineS16LE(rate, channels int, freq float64, d time.Duration) []byte {
+	frames := int(int64(rate) * int64(d) / int64(time.Second))
+	bs := make([]byte, frames*channels*2)
+	for i := 0; i < frames; i++ {
+		v := int16(10000 * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)))
+		for ch := 0; ch < channels; ch++ {
+			binary.LittleEndian.PutUint16(bs[(i*channels+ch)*2:], uint16(v))
+		}
+	}
+	return bs
+}
+
+func TestDecodeRaw(t *testing.T) {
+	pcm, err := DecodeRaw(_sineS16LE(8000, 1, 440, time.Second), "audio/L16;rate=8000")
+	assert.Empty(t, err)
+	assert.Equal(t, 8000, pcm.SampleRate)
+	assert.Equal(t, 8000, pcm.Frames())
+	assert.Equal(t, time.Second, pcm.Duration())
+
+	pcm, err = DecodeRaw(make([]byte, 800), "audio/basic")
+	assert.Empty(t, err)
+	assert.Equal(t, 8000, pcm.SampleRate)
+	assert.Equal(t, 800, len(pcm.Samples))
+
+	_, err = DecodeRaw(make([]byte, 800), "audio/ogg")
+	assert.ErrorIs(t, err, ErrUnsupportedMime)
+}
+
+func TestDecodeWAV(t *testing.T) {
+	af := NewAudio("audio/L16;rate=44100;channels=2")
+	af.AddFrame(0, _sineS16LE(44100, 2, 440, 500*time.Millisecond))
+	pcm, err := af.Decode()
+	assert.Empty(t, err)
+
+	wav := pcm.EncodeWAV()
+	assert.True(t, IsWAV(wav))
+
+	decoded, err := DecodeWAV(wav)
+	assert.Empty(t, err)
+	assert.Equal(t, 44100, decoded.SampleRate)
+	assert.Equal(t, 2, decoded.Channels)
+	assert.Equal(t, pcm.Samples, decoded.Samples)
+
+	_, err = DecodeWAV([]byte("ID3"))
+	assert.ErrorIs(t, err, ErrNotWAV)
+}
+
+func TestG711(t *testing.T) {
+	// 0xD5 / 0xFF 分别为 A-law 与 μ-law 的近零值
+	assert.InDelta(t, 0, alawToLinear(0xD5), 8)
+	assert.Equal(t, int16(0), ulawToLinear(0xFF))
+	assert.Equal(t, int16(-32124), ulawToLinear(0x00))
+	assert.Equal(t, int16(-5504), alawToLinear(0x00))
+}
+
+func TestPCM_Encode(t *testing.T) {
+	pcm := &PCM{SampleRate: 8000, Channels: 1, Samples: []int16{0, 1000, -1000, 12345, -32768, 32767}}
+
+	for _, mime := range []string{"audio/PCMU", "audio/PCMA"} {
+		bs, err := pcm.Encode(mime)
+		assert.Empty(t, err)
+		decoded, err := DecodeRaw(bs, mime)
+		assert.Empty(t, err)
+		for i, v := range pcm.Samples {
+			// G.711 量化误差约为幅度的 1/16
+			assert.InDelta(t, v, decoded.Samples[i], math.Max(64, math.Abs(float64(v))/16), mime)
+		}
+	}
+
+	bs, err := pcm.Encode("audio/L16;rate=8000")
+	assert.Empty(t, err)
+	assert.Equal(t, pcm.Bytes(), bs)
+}
+
+func TestConcatWAV(t *testing.T) {
+	a, _ := DecodeRaw(_sineS16LE(16000, 1, 440, 500*time.Millisecond), "audio/L16;rate=16000")
+	b, _ := DecodeRaw(_sineS16LE(8000, 1, 440, 250*time.Millisecond), "audio/L16;rate=8000")
+
+	wav, err := ConcatWAV(a.EncodeWAV(), b.EncodeWAV())
+	assert.Empty(t, err)
+	pcm, err := DecodeWAV(wav)
+	assert.Empty(t, err)
+	assert.Equal(t, 16000, pcm.SampleRate)
+	assert.Equal(t, 750*time.Millisecond, pcm.Duration())
+
+	_, err = ConcatWAV(a.EncodeWAV(), []byte("ID3"))
+	assert.ErrorIs(t, err, ErrNotWAV)
+}
@@ -0,0 +1,106 @@
+package audio
+
+import (
+	"math"
+)
+
+// 重采样滤波器半宽
+const resampleTaps = 16
+
+// Mono 多声道平均混合为单声道
+func (p *PCM) Mono() *PCM {
+	if p.Channels <= 1 {
+		return p
+	}
+
+	frames := p.Frames()
+	samples := make([]int16, frames)
+	for i := 0; i < frames; i++ {
+		sum := 0
+		for ch := 0; ch < p.Channels; ch++ {
+			sum += int(p.Samples[i*p.Channels+ch])
+		}
+		samples[i] = int16(sum / p.Channels)
+	}
+
+	return &PCM{
+		SampleRate: p.SampleRate,
+		Channels:   1,
+		Samples:    samples,
+	}
+}
+
+// Resample 使用加窗 sinc 插值重采样, 降采样时同时做低通抗混叠
+func (p *PCM) Resample(rate int) *PCM {
+	if rate <= 0 || rate == p.SampleRate || p.Frames() == 0 {
+		return p
+	}
+
+	ratio := float64(p.SampleRate) / float64(rate)
+	// 降采样时截止频率随目标采样率降低
+	cutoff := math.Min(1, 1/ratio)
+	width := float64(resampleTaps) / cutoff
+
+	inFrames := p.Frames()
+	outFrames := int(float64(inFrames) / ratio)
+	samples := make([]int16, outFrames*p.Channels)
+
+	for i := 0; i < outFrames; i++ {
+		t := float64(i) * ratio
+		lo := int(math.Floor(t - width))
+		hi := int(math.Ceil(t + width))
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > inFrames-1 {
+			hi = inFrames - 1
+		}
+
+		for ch := 0; ch < p.Channels; ch++ {
+			sum, wsum := 0.0, 0.0
+			for j := lo; j <= hi; j++ {
+				x := t - float64(j)
+				w := cutoff * sinc(cutoff*x) * hann(x/width)
+				sum += w * float64(p.Samples[j*p.Channels+ch])
+				wsum += w
+			}
+			if wsum != 0 {
+				sum /= wsum
+			}
+			samples[i*p.Channels+ch] = clampInt16(sum)
+		}
+	}
+
+	return &PCM{
+		SampleRate: rate,
+		Channels:   p.Channels,
+		Samples:    samples,
+	}
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	x *= math.Pi
+	return math.Sin(x) / x
+}
+
+// hann 窗函数, x 取值 [-1, 1]
+func hann(x float64) float64 {
+	if x <= -1 || x >= 1 {
+		return 0
+	}
+	return 0.5 + 0.5*math.Cos(math.Pi*x)
+}
+
+func clampInt16(v float64) int16 {
+	v = math.Round(v)
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
@@ -0,0 +1,130 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+var ErrMimeMismatch = errors.New("audio content does not match declared mime type")
+
+// 文件头识别出的容器格式
+const (
+	MimeWAV  = "audio/wav"
+	MimeMP3  = "audio/mpeg"
+	MimeOGG  = "audio/ogg"
+	MimeFLAC = "audio/flac"
+	MimeMP4  = "audio/mp4"
+	MimeWebM = "audio/webm"
+	MimeAMR  = "audio/amr"
+)
+
+// containerMimes 声明的mime与容器格式的对应关系
+var containerMimes = map[string]string{
+	"audio/wav":       MimeWAV,
+	"audio/wave":      MimeWAV,
+	"audio/x-wav":     MimeWAV,
+	"audio/vnd.wave":  MimeWAV,
+	"audio/mpeg":      MimeMP3,
+	"audio/mp3":       MimeMP3,
+	"audio/mpga":      MimeMP3,
+	"audio/ogg":       MimeOGG,
+	"audio/opus":      MimeOGG,
+	"application/ogg": MimeOGG,
+	"audio/flac":      MimeFLAC,
+	"audio/x-flac":    MimeFLAC,
+	"audio/mp4":       MimeMP4,
+	"audio/m4a":       MimeMP4,
+	"audio/x-m4a":     MimeMP4,
+	"video/mp4":       MimeMP4,
+	"audio/webm":      MimeWebM,
+	"video/webm":      MimeWebM,
+	"audio/amr":       MimeAMR,
+}
+
+// rawMimes 不带文件头的裸数据类型, 按 mime 参数解码
+var rawMimes = map[string]bool{
+	"audio/l16":          true,
+	"audio/x-raw":        true,
+	"audio/basic":        true,
+	"audio/x-alaw-basic": true,
+	"audio/pcmu":         true,
+	"audio/pcma":         true,
+}
+
+// extMimes 文件扩展名对应的mime, 上传未声明类型时使用
+var extMimes = map[string]string{
+	".wav":  MimeWAV,
+	".mp3":  MimeMP3,
+	".mpga": MimeMP3,
+	".mpeg": MimeMP3,
+	".ogg":  MimeOGG,
+	".oga":  MimeOGG,
+	".opus": MimeOGG,
+	".flac": MimeFLAC,
+	".mp4":  MimeMP4,
+	".m4a":  MimeMP4,
+	".webm": MimeWebM,
+	".amr":  MimeAMR,
+}
+
+// Sniff 根据文件头识别容器格式, 无法识别时返回空
+func Sniff(data []byte) string {
+	switch {
+	case IsWAV(data):
+		return MimeWAV
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return MimeOGG
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		return MimeFLAC
+	case bytes.HasPrefix(data, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return MimeWebM
+	case bytes.HasPrefix(data, []byte("#!AMR")):
+		return MimeAMR
+	case len(data) >= 12 && string(data[4:8]) == "ftyp":
+		return MimeMP4
+	case id3v2Size(data) > 0:
+		return MimeMP3
+	}
+	// 裸 mp3 以帧同步字开头, 需连续两帧校验避免误判
+	if h, ok := parseMP3FrameHeader(data); ok {
+		if rest := data[min(h.Length, len(data)):]; len(rest) < 4 || isMP3Boundary(rest) {
+			return MimeMP3
+		}
+	}
+	return ""
+}
+
+// DeclaredMime 上传文件声明的mime, Content-Type 缺省或为通用类型时按扩展名推断
+func DeclaredMime(contentType, filename string) string {
+	base := mimeBase(contentType)
+	if base != "" && base != "application/octet-stream" {
+		return contentType
+	}
+	return extMimes[strings.ToLower(filepath.Ext(filename))]
+}
+
+// CheckContent 检查音频数据与声明的mime是否一致, 只拒绝文件头与声明明确矛盾的数据
+// 裸数据(L16、A-law 等)不能带容器文件头, 已知容器格式的文件头须一致
+// 其他声明的类型与未声明类型的数据不检查, 由后端解码
+func CheckContent(data []byte, mime string) error {
+	sniffed := Sniff(data)
+	base := strings.ToLower(mimeBase(mime))
+	if container, ok := containerMimes[base]; ok {
+		if sniffed != "" && sniffed != container {
+			return ErrMimeMismatch
+		}
+		return nil
+	}
+	if rawMimes[base] {
+		if _, err := parseMimeProperties(mime); err != nil {
+			return ErrUnsupportedMime
+		}
+		if sniffed != "" {
+			return ErrMimeMismatch
+		}
+		return nil
+	}
+	return nil
+}
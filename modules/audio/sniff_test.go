@@ -0,0 +1,39 @@
+package audio
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSniff(t *testing.T) {
+	pcm, _ := DecodeRaw(_sineS16LE(8000, 1, 440, 100*time.Millisecond), "audio/L16;rate=8000")
+	wav := pcm.EncodeWAV()
+	mp3 := _mp3Chunk(3)
+
+	assert.Equal(t, MimeWAV, Sniff(wav))
+	assert.Equal(t, MimeMP3, Sniff(mp3))
+	assert.Equal(t, MimeOGG, Sniff([]byte("OggS\x00\x02")))
+	assert.Equal(t, MimeMP4, Sniff([]byte("\x00\x00\x00\x20ftypM4A ")))
+	assert.Equal(t, "", Sniff(pcm.Bytes()))
+
+	assert.Equal(t, "audio/mp4", DeclaredMime("application/octet-stream", "a.M4A"))
+	assert.Equal(t, "audio/L16;rate=8000", DeclaredMime("audio/L16;rate=8000", "a.pcm"))
+	assert.Equal(t, "", DeclaredMime("", "a.txt"))
+
+	assert.Empty(t, CheckContent(wav, "audio/x-wav"))
+	assert.Empty(t, CheckContent(mp3, "audio/mpeg"))
+	assert.Empty(t, CheckContent(wav, ""))
+	assert.Empty(t, CheckContent(pcm.Bytes(), "audio/L16;rate=8000"))
+	assert.ErrorIs(t, CheckContent(wav, "audio/mpeg"), ErrMimeMismatch)
+	assert.ErrorIs(t, CheckContent(mp3, "audio/L16;rate=8000"), ErrMimeMismatch)
+	// 未声明类型且无法识别的数据交由后端解码
+	assert.Empty(t, CheckContent([]byte("hello world"), ""))
+
+	// 未知但合法的类型不检查, 已知容器无法识别文件头时不视为矛盾
+	aac := []byte{0xFF, 0xF1, 0x50, 0x80, 0x02, 0x1F, 0xFC}
+	assert.Empty(t, CheckContent(aac, "audio/aac"))
+	assert.Empty(t, CheckContent([]byte("\x00\x00\x00\x14ftypqt  "), "video/quicktime"))
+	assert.Empty(t, CheckContent(aac, "audio/mp4"))
+	assert.ErrorIs(t, CheckContent(wav, "audio/L16;rate=x"), ErrUnsupportedMime)
+}
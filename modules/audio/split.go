@@ -0,0 +1,153 @@
+package audio
+
+import (
+	"bytes"
+	"math"
+	"time"
+)
+
+// SplitConfig 长音频切分配置, 两项均为 0 时不切分
+type SplitConfig struct {
+	// MaxDuration 每段最大时长
+	MaxDuration time.Duration `mapstructure:"max_duration"`
+	// MaxSize 每段编码后的最大字节数, 如 OpenAI 的 25MB 上限
+	MaxSize int `mapstructure:"max_size"`
+}
+
+// Chunk 切分后的一段音频
+type Chunk struct {
+	Start    time.Duration
+	Duration time.Duration
+	// Data 编码后的音频, 裸数据与 wav 输入编码为 S16LE wav, mp3 输入仍为 mp3
+	Data []byte
+	// Ext 文件扩展名, wav 或 mp3
+	Ext string
+}
+
+// silenceWindow 静音检测窗口与平滑窗口
+const (
+	silenceWindow = 10 * time.Millisecond
+	silenceSmooth = 15
+)
+
+// Split 超过上限时切分音频, 未超过时返回 nil
+// wav 与裸数据在上限后半段内最安静的位置切分, mp3 无法解码, 按帧边界切分
+func Split(data []byte, mime string, cfg SplitConfig) ([]Chunk, error) {
+	if cfg.MaxDuration <= 0 && cfg.MaxSize <= 0 {
+		return nil, nil
+	}
+	if !IsWAV(data) && (isMP3Mime(mime) || mime == "" && len(ParseMP3Frames(data)) > 0) {
+		return splitMP3(data, cfg)
+	}
+
+	pcm, err := Decode(data, mime)
+	if err != nil {
+		return nil, err
+	}
+
+	maxFrames := math.MaxInt
+	if cfg.MaxDuration > 0 {
+		maxFrames = int(int64(cfg.MaxDuration) * int64(pcm.SampleRate) / int64(time.Second))
+	}
+	if cfg.MaxSize > 0 {
+		maxFrames = min(maxFrames, (cfg.MaxSize-44)/(2*pcm.Channels))
+	}
+	if maxFrames <= 0 || pcm.Frames() <= maxFrames && (cfg.MaxSize <= 0 || len(data) <= cfg.MaxSize) {
+		return nil, nil
+	}
+
+	var chunks []Chunk
+	cuts := append(pcm.silenceCuts(maxFrames), pcm.Frames())
+	start := 0
+	for _, cut := range cuts {
+		part := &PCM{SampleRate: pcm.SampleRate, Channels: pcm.Channels, Samples: pcm.Samples[start*pcm.Channels : cut*pcm.Channels]}
+		chunks = append(chunks, Chunk{
+			Start:    framesDuration(start, pcm.SampleRate),
+			Duration: part.Duration(),
+			Data:     part.EncodeWAV(),
+			Ext:      "wav",
+		})
+		start = cut
+	}
+	return chunks, nil
+}
+
+// silenceCuts 切分点(帧序号), 每段不超过 maxFrames, 在每段后半部分能量最低处切分
+func (p *PCM) silenceCuts(maxFrames int) []int {
+	frames := p.Frames()
+	window := max(int(int64(silenceWindow)*int64(p.SampleRate)/int64(time.Second)), 1)
+	mono := p.Mono().Samples
+
+	energy := make([]float64, (frames+window-1)/window)
+	for i := range energy {
+		energy[i] = rmsDB(mono[i*window : min((i+1)*window, frames)])
+		if math.IsInf(energy[i], -1) {
+			energy[i] = -120
+		}
+	}
+	// 平滑后取最低点, 避免在字间短暂停顿处切分
+	smoothed := make([]float64, len(energy))
+	for i := range energy {
+		lo, hi := max(i-silenceSmooth, 0), min(i+silenceSmooth+1, len(energy))
+		sum := 0.0
+		for _, e := range energy[lo:hi] {
+			sum += e
+		}
+		smoothed[i] = sum / float64(hi-lo)
+	}
+
+	var cuts []int
+	for start := 0; frames-start > maxFrames; {
+		lo := (start + maxFrames/2) / window
+		hi := (start + maxFrames) / window
+		// 能量相同时取靠后的位置, 使每段尽量长
+		best := hi - 1
+		for i := hi - 2; i >= lo; i-- {
+			if smoothed[i] < smoothed[best] {
+				best = i
+			}
+		}
+		cut := min(best*window+window/2, start+maxFrames)
+		if cut <= start {
+			cut = start + maxFrames
+		}
+		cuts = append(cuts, cut)
+		start = cut
+	}
+	return cuts
+}
+
+func splitMP3(data []byte, cfg SplitConfig) ([]Chunk, error) {
+	frames := ParseMP3Frames(data)
+	if len(frames) == 0 {
+		return nil, ErrNoMP3Frames
+	}
+
+	var chunks []Chunk
+	var buf bytes.Buffer
+	var start, duration time.Duration
+	flush := func() {
+		chunks = append(chunks, Chunk{Start: start, Duration: duration, Data: bytes.Clone(buf.Bytes()), Ext: "mp3"})
+		start += duration
+		duration = 0
+		buf.Reset()
+	}
+	for _, frame := range frames {
+		d := time.Duration(float64(frame.Header.Samples) / float64(frame.Header.SampleRate) * float64(time.Second))
+		if buf.Len() > 0 && (cfg.MaxSize > 0 && buf.Len()+len(frame.Data) > cfg.MaxSize ||
+			cfg.MaxDuration > 0 && duration+d > cfg.MaxDuration) {
+			flush()
+		}
+		buf.Write(frame.Data)
+		duration += d
+	}
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+	flush()
+	return chunks, nil
+}
+
+func framesDuration(frames, rate int) time.Duration {
+	return time.Duration(int64(frames) * int64(time.Second) / int64(rate))
+}
@@ -0,0 +1,62 @@
+package audio
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSplit(t *testing.T) {
+	// 6s 语音, 1.5s 处有 300ms 停顿, 3.2s 处有 200ms 停顿
+	tone, _ := DecodeRaw(_sineS16LE(16000, 1, 440, 6*time.Second), "audio/L16;rate=16000")
+	samples := append([]int16(nil), tone.Samples...)
+	for _, pause := range [][2]float64{{1.5, 1.8}, {3.2, 3.4}} {
+		clear(samples[int(pause[0]*16000):int(pause[1]*16000)])
+	}
+	pcm := &PCM{SampleRate: 16000, Channels: 1, Samples: samples}
+	wav := pcm.EncodeWAV()
+
+	chunks, err := Split(wav, "", SplitConfig{MaxDuration: 2 * time.Second})
+	assert.Empty(t, err)
+	assert.Equal(t, 4, len(chunks))
+	assert.InDelta(t, 1650*time.Millisecond, chunks[1].Start, float64(50*time.Millisecond))
+	assert.InDelta(t, 3300*time.Millisecond, chunks[2].Start, float64(50*time.Millisecond))
+
+	total := time.Duration(0)
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, chunk.Duration, 2*time.Second)
+		assert.Equal(t, total, chunk.Start)
+		part, errd := DecodeWAV(chunk.Data)
+		assert.Empty(t, errd)
+		assert.Equal(t, chunk.Duration, part.Duration())
+		total += chunk.Duration
+	}
+	assert.Equal(t, pcm.Duration(), total)
+
+	// 按大小切分
+	chunks, err = Split(wav, "", SplitConfig{MaxSize: 64044})
+	assert.Empty(t, err)
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, len(chunk.Data), 64044)
+	}
+
+	chunks, err = Split(wav, "", SplitConfig{MaxDuration: time.Minute})
+	assert.Empty(t, err)
+	assert.Nil(t, chunks)
+}
+
+func TestSplit_mp3(t *testing.T) {
+	data := _mp3Chunk(100)
+	d, _ := MP3Duration(data)
+
+	chunks, err := Split(data, "audio/mpeg", SplitConfig{MaxDuration: d / 3})
+	assert.Empty(t, err)
+	assert.Equal(t, 4, len(chunks))
+	total := time.Duration(0)
+	for _, chunk := range chunks {
+		assert.Equal(t, "mp3", chunk.Ext)
+		assert.Equal(t, total, chunk.Start)
+		total += chunk.Duration
+	}
+	assert.InDelta(t, d, total, float64(time.Millisecond))
+}
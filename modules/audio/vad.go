@@ -0,0 +1,320 @@
+package audio
+
+import (
+	"math"
+	"time"
+)
+
+// VADConfig 语音端点检测配置
+type VADConfig struct {
+	// 分析帧长
+	FrameDuration time.Duration `mapstructure:"frame_duration"`
+	// 语音能量阈值 dBFS
+	EnergyThreshold float64 `mapstructure:"energy_threshold"`
+	// 能量需高于背景噪声的倍数
+	NoiseFactor float64 `mapstructure:"noise_factor"`
+	// 过零率阈值, 用于识别能量较低的清辅音
+	ZCRThreshold float64 `mapstructure:"zcr_threshold"`
+	// 判定开始说话所需的最短语音时长
+	MinSpeech time.Duration `mapstructure:"min_speech"`
+	// 判定说话结束所需的静音时长
+	MinSilence time.Duration `mapstructure:"min_silence"`
+	// 语音段前保留的静音时长
+	Padding time.Duration `mapstructure:"padding"`
+	// 单个语音段最大时长, 超过后强制切分
+	MaxSegment time.Duration `mapstructure:"max_segment"`
+}
+
+func DefaultVADConfig() VADConfig {
+	return VADConfig{
+		FrameDuration:   20 * time.Millisecond,
+		EnergyThreshold: -45,
+		NoiseFactor:     3,
+		ZCRThreshold:    0.25,
+		MinSpeech:       200 * time.Millisecond,
+		MinSilence:      700 * time.Millisecond,
+		Padding:         300 * time.Millisecond,
+		MaxSegment:      30 * time.Second,
+	}
+}
+
+// Segment 一段完整语音
+type Segment struct {
+	Start time.Duration
+	End   time.Duration
+	PCM   *PCM
+}
+
+// VAD 基于短时能量与过零率的语音端点检测, 输入单声道采样
+type VAD struct {
+	cfg        VADConfig
+	sampleRate int
+	frameSize  int
+
+	minSpeechFrames  int
+	minSilenceFrames int
+	paddingSize      int
+	maxSegmentSize   int
+
+	pending    []int16 // 不足一帧的采样
+	preroll    []int16 // 未说话时的最近采样
+	segment    []int16 // 当前语音段
+	speaking   bool
+	speechRun  int
+	silenceRun int
+	noiseFloor float64
+	offset     int64 // 已分析的采样数
+	segStart   int64
+}
+
+func NewVAD(sampleRate int, cfg VADConfig) *VAD {
+	df := DefaultVADConfig()
+	if cfg.FrameDuration <= 0 {
+		cfg.FrameDuration = df.FrameDuration
+	}
+	if cfg.EnergyThreshold == 0 {
+		cfg.EnergyThreshold = df.EnergyThreshold
+	}
+	if cfg.NoiseFactor <= 0 {
+		cfg.NoiseFactor = df.NoiseFactor
+	}
+	if cfg.ZCRThreshold <= 0 {
+		cfg.ZCRThreshold = df.ZCRThreshold
+	}
+	if cfg.MinSpeech <= 0 {
+		cfg.MinSpeech = df.MinSpeech
+	}
+	if cfg.MinSilence <= 0 {
+		cfg.MinSilence = df.MinSilence
+	}
+	if cfg.Padding <= 0 {
+		cfg.Padding = df.Padding
+	}
+	if cfg.MaxSegment <= 0 {
+		cfg.MaxSegment = df.MaxSegment
+	}
+
+	samplesOf := func(d time.Duration) int {
+		return int(int64(sampleRate) * int64(d) / int64(time.Second))
+	}
+
+	frameSize := max(samplesOf(cfg.FrameDuration), 1)
+
+	return &VAD{
+		cfg:              cfg,
+		sampleRate:       sampleRate,
+		frameSize:        frameSize,
+		minSpeechFrames:  max(samplesOf(cfg.MinSpeech)/frameSize, 1),
+		minSilenceFrames: max(samplesOf(cfg.MinSilence)/frameSize, 1),
+		paddingSize:      samplesOf(cfg.Padding),
+		maxSegmentSize:   samplesOf(cfg.MaxSegment),
+	}
+}
+
+// Write 输入采样, 返回已结束的语音段
+func (v *VAD) Write(samples []int16) []Segment {
+	var segments []Segment
+
+	v.pending = append(v.pending, samples...)
+	for len(v.pending) >= v.frameSize {
+		frame := v.pending[:v.frameSize]
+		if seg := v.process(frame); seg != nil {
+			segments = append(segments, *seg)
+		}
+		v.pending = v.pending[v.frameSize:]
+	}
+	v.pending = append([]int16(nil), v.pending...)
+
+	return segments
+}
+
+// Flush 结束输入, 返回未结束的语音段
+func (v *VAD) Flush() *Segment {
+	if v.speaking {
+		v.segment = append(v.segment, v.pending...)
+		v.offset += int64(len(v.pending))
+	}
+	v.pending = nil
+
+	var seg *Segment
+	if v.speaking && len(v.segment) > 0 {
+		seg = v.cut()
+	}
+	v.reset()
+	return seg
+}
+
+// Current 当前未结束语音段的副本, 未在说话时返回 nil
+func (v *VAD) Current() *PCM {
+	if !v.speaking || len(v.segment) == 0 {
+		return nil
+	}
+	return &PCM{
+		SampleRate: v.sampleRate,
+		Channels:   1,
+		Samples:    append([]int16(nil), v.segment...),
+	}
+}
+
+// Speaking 当前是否处于语音段中
+func (v *VAD) Speaking() bool {
+	return v.speaking
+}
+
+func (v *VAD) process(frame []int16) *Segment {
+	speech := v.isSpeech(frame)
+	v.offset += int64(len(frame))
+
+	if !v.speaking {
+		v.preroll = append(v.preroll, frame...)
+		if speech {
+			v.speechRun++
+		} else {
+			v.speechRun = 0
+		}
+
+		keep := v.paddingSize + v.speechRun*v.frameSize
+		if len(v.preroll) > keep {
+			v.preroll = append([]int16(nil), v.preroll[len(v.preroll)-keep:]...)
+		}
+
+		if v.speechRun >= v.minSpeechFrames {
+			v.speaking = true
+			v.silenceRun = 0
+			v.segment = v.preroll
+			v.segStart = v.offset - int64(len(v.preroll))
+			v.preroll = nil
+		}
+		return nil
+	}
+
+	v.segment = append(v.segment, frame...)
+	if speech {
+		v.silenceRun = 0
+	} else {
+		v.silenceRun++
+	}
+
+	if v.silenceRun >= v.minSilenceFrames || (v.maxSegmentSize > 0 && len(v.segment) >= v.maxSegmentSize) {
+		seg := v.cut()
+		v.reset()
+		return seg
+	}
+	return nil
+}
+
+func (v *VAD) cut() *Segment {
+	start := v.segStart
+	end := v.segStart + int64(len(v.segment))
+	return &Segment{
+		Start: v.duration(start),
+		End:   v.duration(end),
+		PCM: &PCM{
+			SampleRate: v.sampleRate,
+			Channels:   1,
+			Samples:    v.segment,
+		},
+	}
+}
+
+func (v *VAD) reset() {
+	v.speaking = false
+	v.speechRun = 0
+	v.silenceRun = 0
+	v.segment = nil
+	v.preroll = nil
+}
+
+func (v *VAD) duration(samples int64) time.Duration {
+	return time.Duration(samples * int64(time.Second) / int64(v.sampleRate))
+}
+
+// isSpeech 判断一帧是否为语音, 并在静音时更新背景噪声估计
+func (v *VAD) isSpeech(frame []int16) bool {
+	energy, zcr := frameFeatures(frame)
+
+	threshold := math.Pow(10, v.cfg.EnergyThreshold/20)
+	if v.noiseFloor > 0 {
+		threshold = math.Max(threshold, v.noiseFloor*v.cfg.NoiseFactor)
+	}
+
+	speech := energy > threshold
+	// 清辅音能量低但过零率高
+	if !speech && energy > threshold/2 && zcr > v.cfg.ZCRThreshold {
+		speech = true
+	}
+
+	if !speech {
+		if v.noiseFloor == 0 {
+			v.noiseFloor = energy
+		} else {
+			v.noiseFloor = 0.95*v.noiseFloor + 0.05*energy
+		}
+	}
+	return speech
+}
+
+// frameFeatures 计算归一化的均方根能量与过零率
+func frameFeatures(frame []int16) (float64, float64) {
+	if len(frame) == 0 {
+		return 0, 0
+	}
+	sum := 0.0
+	crossings := 0
+	for i, s := range frame {
+		f := float64(s) / 32768
+		sum += f * f
+		if i > 0 && (s >= 0) != (frame[i-1] >= 0) {
+			crossings++
+		}
+	}
+	return math.Sqrt(sum / float64(len(frame))), float64(crossings) / float64(len(frame))
+}
+
+// Segmenter 将连续到达的裸音频数据解码后按语音端点切分
+type Segmenter struct {
+	props     audioProperties
+	remainder []byte
+	vad       *VAD
+}
+
+func NewSegmenter(mime string, cfg VADConfig) (*Segmenter, error) {
+	props, err := parseMimeProperties(mime)
+	if err != nil {
+		return nil, ErrUnsupportedMime
+	}
+	return &Segmenter{
+		props: props,
+		vad:   NewVAD(int(props.sampleRate), cfg),
+	}, nil
+}
+
+// Write 输入一帧裸数据, 返回已结束的语音段
+func (s *Segmenter) Write(data []byte) ([]Segment, error) {
+	block := int(s.props.bitsPerSample/8) * int(s.props.channels)
+	data = append(s.remainder, data...)
+	n := len(data) - len(data)%block
+	s.remainder = append([]byte(nil), data[n:]...)
+
+	pcm, err := decodeSamples(data[:n], s.props)
+	if err != nil {
+		return nil, err
+	}
+	return s.vad.Write(pcm.Mono().Samples), nil
+}
+
+// Current 当前未结束语音段的副本, 未在说话时返回 nil
+func (s *Segmenter) Current() *PCM {
+	return s.vad.Current()
+}
+
+// Flush 结束输入, 返回未结束的语音段
+func (s *Segmenter) Flush() *Segment {
+	s.remainder = nil
+	return s.vad.Flush()
+}
+
+// Speaking 当前是否处于语音段中
+func (s *Segmenter) Speaking() bool {
+	return s.vad.Speaking()
+}
@@ -0,0 +1,60 @@
+package audio
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestVAD(t *testing.T) {
+	silence := make([]byte, 8000*2)
+	buf := new(bytes.Buffer)
+	buf.Write(silence)
+	buf.Write(_sineS16LE(8000, 1, 440, time.Second))
+	buf.Write(silence)
+	buf.Write(_sineS16LE(8000, 1, 300, 500*time.Millisecond))
+	buf.Write(silence[:8000])
+
+	seg, err := NewSegmenter("audio/L16;rate=8000", DefaultVADConfig())
+	assert.Empty(t, err)
+
+	var segments []Segment
+	data := buf.Bytes()
+	// 模拟奇数长度的网络帧
+	for i := 0; i < len(data); i += 333 {
+		ss, errw := seg.Write(data[i:min(i+333, len(data))])
+		assert.Empty(t, errw)
+		segments = append(segments, ss...)
+	}
+	if last := seg.Flush(); last != nil {
+		segments = append(segments, *last)
+	}
+
+	assert.Equal(t, 2, len(segments))
+	assert.InDelta(t, 0.7, segments[0].Start.Seconds(), 0.05)
+	assert.InDelta(t, 2.7, segments[0].End.Seconds(), 0.05)
+	assert.InDelta(t, 2.7, segments[1].Start.Seconds(), 0.05)
+	// 结尾静音不足 MinSilence, 由 Flush 输出
+	assert.InDelta(t, 4.0, segments[1].End.Seconds(), 0.05)
+}
+
+func TestVAD_maxSegment(t *testing.T) {
+	cfg := DefaultVADConfig()
+	cfg.MaxSegment = time.Second
+
+	vad := NewVAD(8000, cfg)
+	pcm, _ := DecodeRaw(_sineS16LE(8000, 1, 440, 2500*time.Millisecond), "audio/L16;rate=8000")
+	segments := vad.Write(pcm.Samples)
+	assert.Equal(t, 2, len(segments))
+	assert.True(t, vad.Speaking())
+	assert.NotNil(t, vad.Flush())
+	assert.False(t, vad.Speaking())
+}
+
+func TestNewVAD_defaults(t *testing.T) {
+	// 只配置部分字段时其余使用默认值
+	vad := NewVAD(8000, VADConfig{MinSilence: time.Second})
+	assert.Equal(t, 2400, vad.paddingSize)
+	assert.Equal(t, 50, vad.minSilenceFrames)
+}
@@ -0,0 +1,236 @@
+package diskcache
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrTooLarge = errors.New("entry exceeds cache size")
+
+// Config 磁盘缓存配置
+type Config struct {
+	// Dir 缓存目录
+	Dir string `mapstructure:"dir"`
+	// MaxSize 缓存总大小上限(字节), 超出后淘汰最久未使用的条目, 0 不限制
+	MaxSize int64 `mapstructure:"max_size"`
+}
+
+// Cache 按 LRU 淘汰的磁盘缓存, 每个条目一个文件, 首行为 Content-Type
+// 重启后按文件修改时间恢复使用顺序
+type Cache struct {
+	cfg Config
+
+	mu    sync.Mutex
+	lru   *list.List // 最近使用的在前, 值为 *entry
+	items map[string]*list.Element
+	size  int64
+}
+
+type entry struct {
+	key  string
+	size int64
+}
+
+// Key 由多个字段计算缓存键
+func Key(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func New(cfg Config) (*Cache, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("cache dir is required")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		cfg:   cfg,
+		lru:   list.New(),
+		items: map[string]*list.Element{},
+	}
+
+	files, err := os.ReadDir(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	type loaded struct {
+		entry
+		mtime time.Time
+	}
+	var entries []loaded
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(f.Name(), ".tmp") {
+			// 上次写入未完成
+			_ = os.Remove(filepath.Join(cfg.Dir, f.Name()))
+			continue
+		}
+		info, errf := f.Info()
+		if errf != nil || !validKey(f.Name()) {
+			continue
+		}
+		entries = append(entries, loaded{entry{f.Name(), info.Size()}, info.ModTime()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].mtime.After(entries[j].mtime) })
+	for _, e := range entries {
+		c.items[e.key] = c.lru.PushBack(&entry{e.key, e.size})
+		c.size += e.size
+	}
+	c.evict()
+
+	return c, nil
+}
+
+// Get 读取缓存, 返回数据与 Content-Type
+func (c *Cache) Get(key string) ([]byte, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, "", false
+	}
+
+	path := c.path(key)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		c.remove(el)
+		return nil, "", false
+	}
+	contentType, data, found := bytes.Cut(raw, []byte{'\n'})
+	if !found {
+		c.remove(el)
+		_ = os.Remove(path)
+		return nil, "", false
+	}
+
+	c.lru.MoveToFront(el)
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return data, string(contentType), true
+}
+
+// Put 写入缓存, 超出大小上限时淘汰最久未使用的条目
+func (c *Cache) Put(key, contentType string, data []byte) error {
+	if !validKey(key) {
+		return errors.New("invalid cache key")
+	}
+	size := int64(len(contentType) + 1 + len(data))
+	if c.cfg.MaxSize > 0 && size > c.cfg.MaxSize {
+		return ErrTooLarge
+	}
+
+	tmp, err := os.CreateTemp(c.cfg.Dir, key+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(append([]byte(contentType+"\n"), data...))
+	if errc := tmp.Close(); err == nil {
+		err = errc
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(key))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.size -= el.Value.(*entry).size
+		c.lru.Remove(el)
+	}
+	c.items[key] = c.lru.PushFront(&entry{key, size})
+	c.size += size
+	c.evict()
+	return nil
+}
+
+// Remove 删除一个条目
+func (c *Cache) Remove(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return false
+	}
+	c.remove(el)
+	_ = os.Remove(c.path(key))
+	return true
+}
+
+// Purge 清空缓存, 返回删除的条目数
+func (c *Cache) Purge() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.items)
+	for key, el := range c.items {
+		c.remove(el)
+		_ = os.Remove(c.path(key))
+	}
+	return n
+}
+
+// Len 条目数
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+// Size 缓存总大小
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *Cache) evict() {
+	for c.cfg.MaxSize > 0 && c.size > c.cfg.MaxSize {
+		el := c.lru.Back()
+		if el == nil {
+			return
+		}
+		c.remove(el)
+		_ = os.Remove(c.path(el.Value.(*entry).key))
+	}
+}
+
+func (c *Cache) remove(el *list.Element) {
+	e := el.Value.(*entry)
+	c.lru.Remove(el)
+	delete(c.items, e.key)
+	c.size -= e.size
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.cfg.Dir, key)
+}
+
+// validKey 键必须为 sha256 十六进制, 避免路径穿越
+func validKey(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
@@ -0,0 +1,51 @@
+package diskcache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(Config{Dir: dir, MaxSize: 100})
+	assert.Empty(t, err)
+
+	k1, k2, k3 := Key("a"), Key("b"), Key("c")
+	assert.NotEqual(t, Key("a", "b"), Key("ab"))
+
+	assert.Empty(t, c.Put(k1, "audio/mpeg", make([]byte, 30)))
+	assert.Empty(t, c.Put(k2, "audio/wav", make([]byte, 30)))
+
+	data, contentType, ok := c.Get(k1)
+	assert.True(t, ok)
+	assert.Equal(t, "audio/mpeg", contentType)
+	assert.Equal(t, 30, len(data))
+
+	// k2 最久未使用, 被淘汰
+	time.Sleep(10 * time.Millisecond)
+	assert.Empty(t, c.Put(k3, "audio/wav", make([]byte, 30)))
+	_, _, ok = c.Get(k2)
+	assert.False(t, ok)
+	assert.Equal(t, 2, c.Len())
+	_, err = os.Stat(filepath.Join(dir, k2))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.ErrorIs(t, c.Put(Key("d"), "audio/wav", make([]byte, 200)), ErrTooLarge)
+	assert.Error(t, c.Put("../x", "audio/wav", nil))
+
+	// 重启后恢复
+	c, err = New(Config{Dir: dir, MaxSize: 100})
+	assert.Empty(t, err)
+	assert.Equal(t, 2, c.Len())
+	_, contentType, ok = c.Get(k3)
+	assert.True(t, ok)
+	assert.Equal(t, "audio/wav", contentType)
+
+	assert.True(t, c.Remove(k3))
+	assert.False(t, c.Remove(k3))
+	assert.Equal(t, 1, c.Purge())
+	assert.Equal(t, int64(0), c.Size())
+}
@@ -0,0 +1,225 @@
+package realtime
+
+// OpenAI Realtime API 事件定义, 仅包含本服务支持的字段
+
+// 客户端事件
+const (
+	EventSessionUpdate          = "session.update"
+	EventInputAudioBufferAppend = "input_audio_buffer.append"
+	EventInputAudioBufferCommit = "input_audio_buffer.commit"
+	EventInputAudioBufferClear  = "input_audio_buffer.clear"
+	EventConversationItemCreate = "conversation.item.create"
+	EventResponseCreate         = "response.create"
+	EventResponseCancel         = "response.cancel"
+)
+
+// 服务端事件
+const (
+	EventError                            = "error"
+	EventSessionCreated                   = "session.created"
+	EventSessionUpdated                   = "session.updated"
+	EventInputAudioBufferCommitted        = "input_audio_buffer.committed"
+	EventInputAudioBufferCleared          = "input_audio_buffer.cleared"
+	EventInputAudioBufferSpeechStarted    = "input_audio_buffer.speech_started"
+	EventInputAudioBufferSpeechStopped    = "input_audio_buffer.speech_stopped"
+	EventConversationItemCreated          = "conversation.item.created"
+	EventInputAudioTranscriptionCompleted = "conversation.item.input_audio_transcription.completed"
+	EventInputAudioTranscriptionFailed    = "conversation.item.input_audio_transcription.failed"
+	EventResponseCreated                  = "response.created"
+	EventResponseDone                     = "response.done"
+	EventResponseOutputItemAdded          = "response.output_item.added"
+	EventResponseOutputItemDone           = "response.output_item.done"
+	EventResponseContentPartAdded         = "response.content_part.added"
+	EventResponseContentPartDone          = "response.content_part.done"
+	EventResponseTextDelta                = "response.text.delta"
+	EventResponseTextDone                 = "response.text.done"
+	EventResponseAudioTranscriptDelta     = "response.audio_transcript.delta"
+	EventResponseAudioTranscriptDone      = "response.audio_transcript.done"
+	EventResponseAudioDelta               = "response.audio.delta"
+	EventResponseAudioDone                = "response.audio.done"
+)
+
+// 音频格式
+const (
+	AudioFormatPCM16    = "pcm16"
+	AudioFormatG711ULaw = "g711_ulaw"
+	AudioFormatG711ALaw = "g711_alaw"
+)
+
+// 模态
+const (
+	ModalityText  = "text"
+	ModalityAudio = "audio"
+)
+
+// 内容类型
+const (
+	ContentInputText  = "input_text"
+	ContentInputAudio = "input_audio"
+	ContentText       = "text"
+	ContentAudio      = "audio"
+)
+
+// 状态
+const (
+	StatusInProgress = "in_progress"
+	StatusCompleted  = "completed"
+	StatusCancelled  = "cancelled"
+	StatusFailed     = "failed"
+	StatusIncomplete = "incomplete"
+)
+
+// AudioMime 音频格式对应的mime, pcm16 为 24kHz 单声道
+func AudioMime(format string) string {
+	switch format {
+	case AudioFormatG711ULaw:
+		return "audio/PCMU"
+	case AudioFormatG711ALaw:
+		return "audio/PCMA"
+	}
+	return "audio/L16;rate=24000"
+}
+
+// AudioSampleRate 音频格式对应的采样率
+func AudioSampleRate(format string) int {
+	switch format {
+	case AudioFormatG711ULaw, AudioFormatG711ALaw:
+		return 8000
+	}
+	return 24000
+}
+
+type InputAudioTranscription struct {
+	Model string `json:"model,omitempty"`
+}
+
+type TurnDetection struct {
+	Type              string  `json:"type"`
+	Threshold         float64 `json:"threshold,omitempty"`
+	PrefixPaddingMs   int     `json:"prefix_padding_ms,omitempty"`
+	SilenceDurationMs int     `json:"silence_duration_ms,omitempty"`
+	CreateResponse    *bool   `json:"create_response,omitempty"`
+}
+
+// Session 会话配置
+type Session struct {
+	ID                      string                   `json:"id,omitempty"`
+	Object                  string                   `json:"object,omitempty"`
+	Model                   string                   `json:"model,omitempty"`
+	Modalities              []string                 `json:"modalities,omitempty"`
+	Instructions            string                   `json:"instructions,omitempty"`
+	Voice                   string                   `json:"voice,omitempty"`
+	InputAudioFormat        string                   `json:"input_audio_format,omitempty"`
+	OutputAudioFormat       string                   `json:"output_audio_format,omitempty"`
+	InputAudioTranscription *InputAudioTranscription `json:"input_audio_transcription,omitempty"`
+	TurnDetection           *TurnDetection           `json:"turn_detection"`
+	Temperature             float32                  `json:"temperature,omitempty"`
+	MaxResponseOutputTokens interface{}              `json:"max_response_output_tokens,omitempty"`
+}
+
+// ContentPart 消息内容
+type ContentPart struct {
+	Type       string `json:"type"`
+	Text       string `json:"text,omitempty"`
+	Audio      string `json:"audio,omitempty"`
+	Transcript string `json:"transcript,omitempty"`
+}
+
+// Item 会话中的一条消息
+type Item struct {
+	ID      string        `json:"id,omitempty"`
+	Object  string        `json:"object,omitempty"`
+	Type    string        `json:"type"`
+	Status  string        `json:"status,omitempty"`
+	Role    string        `json:"role,omitempty"`
+	Content []ContentPart `json:"content,omitempty"`
+}
+
+// Text 消息的文本内容, 音频使用转写文本
+func (i *Item) Text() string {
+	text := ""
+	for _, part := range i.Content {
+		switch part.Type {
+		case ContentInputText, ContentText:
+			text += part.Text
+		case ContentInputAudio, ContentAudio:
+			text += part.Transcript
+		}
+	}
+	return text
+}
+
+// ResponseConfig response.create 的参数, 未设置的字段使用会话配置
+type ResponseConfig struct {
+	Modalities              []string    `json:"modalities,omitempty"`
+	Instructions            string      `json:"instructions,omitempty"`
+	Voice                   string      `json:"voice,omitempty"`
+	OutputAudioFormat       string      `json:"output_audio_format,omitempty"`
+	Temperature             float32     `json:"temperature,omitempty"`
+	MaxResponseOutputTokens interface{} `json:"max_response_output_tokens,omitempty"`
+}
+
+type Usage struct {
+	TotalTokens  int `json:"total_tokens"`
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type Response struct {
+	ID            string      `json:"id"`
+	Object        string      `json:"object"`
+	Status        string      `json:"status"`
+	StatusDetails interface{} `json:"status_details"`
+	Output        []Item      `json:"output"`
+	Usage         *Usage      `json:"usage,omitempty"`
+}
+
+type Error struct {
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+	Param   string `json:"param,omitempty"`
+	EventID string `json:"event_id,omitempty"`
+}
+
+// ClientEvent 客户端事件
+type ClientEvent struct {
+	EventID        string          `json:"event_id,omitempty"`
+	Type           string          `json:"type"`
+	Session        *Session        `json:"session,omitempty"`
+	Audio          string          `json:"audio,omitempty"`
+	Item           *Item           `json:"item,omitempty"`
+	PreviousItemID string          `json:"previous_item_id,omitempty"`
+	Response       *ResponseConfig `json:"response,omitempty"`
+}
+
+// ServerEvent 服务端事件, 不同事件使用不同字段
+type ServerEvent struct {
+	EventID        string       `json:"event_id"`
+	Type           string       `json:"type"`
+	Session        *Session     `json:"session,omitempty"`
+	Item           *Item        `json:"item,omitempty"`
+	PreviousItemID *string      `json:"previous_item_id,omitempty"`
+	ItemID         string       `json:"item_id,omitempty"`
+	ResponseID     string       `json:"response_id,omitempty"`
+	OutputIndex    *int         `json:"output_index,omitempty"`
+	ContentIndex   *int         `json:"content_index,omitempty"`
+	Part           *ContentPart `json:"part,omitempty"`
+	Delta          string       `json:"delta,omitempty"`
+	Text           string       `json:"text,omitempty"`
+	Transcript     string       `json:"transcript,omitempty"`
+	AudioStartMs   *int         `json:"audio_start_ms,omitempty"`
+	AudioEndMs     *int         `json:"audio_end_ms,omitempty"`
+	Response       *Response    `json:"response,omitempty"`
+	Error          *Error       `json:"error,omitempty"`
+}
+
+// Int 用于可选的数值字段
+func Int(i int) *int {
+	return &i
+}
+
+// String 用于可选的字符串字段
+func String(s string) *string {
+	return &s
+}
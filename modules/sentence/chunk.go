@@ -0,0 +1,59 @@
+package sentence
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var paragraphSep = regexp.MustCompile(`\n\s*\n`)
+
+// Chunk 将长文本切分为不超过 max 个字符的片段
+// 优先在段落处切分, 段落过长时在句子处切分, 句子过长时在逗号等位置切分
+func Chunk(text string, max int) []string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	if max <= 0 || utf8.RuneCountInString(text) <= max {
+		return []string{text}
+	}
+
+	var pieces []string
+	for _, para := range paragraphSep.Split(text, -1) {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		if utf8.RuneCountInString(para) <= max {
+			pieces = append(pieces, para+"\n\n")
+			continue
+		}
+		s := &Splitter{MaxLength: max}
+		sentences := append(s.Write(para), s.Flush()...)
+		for i, sentence := range sentences {
+			if i == len(sentences)-1 {
+				sentence += "\n\n"
+			} else if r, _ := utf8.DecodeLastRuneInString(sentence); r < utf8.RuneSelf {
+				// 西文句子之间保留空格
+				sentence += " "
+			}
+			pieces = append(pieces, sentence)
+		}
+	}
+
+	// 相邻片段合并到 max 以内
+	var chunks []string
+	cur := ""
+	for _, piece := range pieces {
+		if cur != "" && utf8.RuneCountInString(strings.TrimSpace(cur+piece)) > max {
+			chunks = append(chunks, strings.TrimSpace(cur))
+			cur = ""
+		}
+		cur += piece
+	}
+	if strings.TrimSpace(cur) != "" {
+		chunks = append(chunks, strings.TrimSpace(cur))
+	}
+	return chunks
+}
@@ -0,0 +1,28 @@
+package sentence
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChunk(t *testing.T) {
+	assert.Equal(t, []string{"短文本。"}, Chunk(" 短文本。\n", 10))
+	assert.Nil(t, Chunk("", 10))
+
+	// 段落优先
+	assert.Equal(t, []string{"第一段。", "第二段第二段。"}, Chunk("第一段。\n\n第二段第二段。", 10))
+	assert.Equal(t, []string{"一段。\n\n二段。", "三段三段三段。"}, Chunk("一段。\n\n二段。\n\n三段三段三段。", 10))
+
+	// 长段落按句子切分, 西文保留空格
+	assert.Equal(t, []string{"Hello world.", "How are you?"}, Chunk("Hello world. How are you?", 14))
+	assert.Equal(t, []string{"你好。今天天气不错。", "出去走走吧！"}, Chunk("你好。今天天气不错。出去走走吧！", 10))
+
+	text := strings.Repeat("这是一个很长的句子，没有句号", 100)
+	chunks := Chunk(text, 50)
+	assert.Equal(t, text, strings.Join(chunks, ""))
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, utf8.RuneCountInString(chunk), 50)
+	}
+}
@@ -0,0 +1,118 @@
+package sentence
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 句末标点, 英文句点需后跟空白才视为句末, 以免切开小数与缩写
+const terminators = "。！？；…!?;\n"
+
+// 句末标点后可能跟随的闭合符号
+const closers = "”’\"'」』）)】]》"
+
+// 超长时可以切分的位置
+const softBreaks = "，、：,: \t"
+
+// Splitter 将流式文本按句子切分, 中英文标点均可识别
+type Splitter struct {
+	// MinLength 短于此长度(字符数)的句子与下一句合并, 减少过短的TTS请求
+	MinLength int
+	// MaxLength 没有句末标点且超过此长度时在逗号等位置切分, 0 不限制
+	MaxLength int
+
+	buf []rune
+}
+
+// Write 追加文本, 返回已完整的句子
+func (s *Splitter) Write(text string) []string {
+	s.buf = append(s.buf, []rune(text)...)
+
+	var sentences []string
+	for {
+		end := s.boundary(false)
+		if end < 0 {
+			return sentences
+		}
+		if sentence := s.cut(end); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+	}
+}
+
+// Flush 结束输入, 返回剩余的句子
+func (s *Splitter) Flush() []string {
+	var sentences []string
+	for len(s.buf) > 0 {
+		end := s.boundary(true)
+		if end < 0 {
+			end = len(s.buf)
+		}
+		if sentence := s.cut(end); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+	}
+	return sentences
+}
+
+// Split 切分完整文本
+func Split(text string) []string {
+	s := &Splitter{}
+	return append(s.Write(text), s.Flush()...)
+}
+
+func (s *Splitter) cut(end int) string {
+	sentence := strings.TrimSpace(string(s.buf[:end]))
+	s.buf = s.buf[end:]
+	return sentence
+}
+
+// boundary 返回第一个句子的结束位置, 没有完整句子返回 -1
+// 句末标点位于缓冲末尾时需要等待后续文本确认, final 为 true 时不再等待
+func (s *Splitter) boundary(final bool) int {
+	for i := 0; i < len(s.buf); i++ {
+		r := s.buf[i]
+		if !strings.ContainsRune(terminators, r) && r != '.' {
+			continue
+		}
+
+		end := i + 1
+		for end < len(s.buf) && (strings.ContainsRune(terminators, s.buf[end]) || s.buf[end] == '.' ||
+			strings.ContainsRune(closers, s.buf[end])) {
+			end++
+		}
+		if end == len(s.buf) && !final {
+			return -1
+		}
+		if r == '.' && end < len(s.buf) && !unicode.IsSpace(s.buf[end]) {
+			i = end - 1
+			continue
+		}
+		if s.length(end) < s.MinLength {
+			i = end - 1
+			continue
+		}
+		return end
+	}
+
+	if s.MaxLength > 0 && len(s.buf) > s.MaxLength {
+		for i := s.MaxLength; i > s.MaxLength/2; i-- {
+			if strings.ContainsRune(softBreaks, s.buf[i-1]) {
+				return i
+			}
+		}
+		return s.MaxLength
+	}
+	return -1
+}
+
+// length 不计空白的字符数
+func (s *Splitter) length(end int) int {
+	n := 0
+	for _, r := range s.buf[:end] {
+		if !unicode.IsSpace(r) {
+			n++
+		}
+	}
+	return n
+}
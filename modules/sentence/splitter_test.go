@@ -0,0 +1,36 @@
+package sentence
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	assert.Equal(t, []string{"你好。", "今天天气怎么样？", "气温是 3.5 度!", "Hello world.", "How are you?"},
+		Split("你好。今天天气怎么样？气温是 3.5 度! Hello world. How are you?"))
+	assert.Equal(t, []string{"他说：“好的。”", "然后走了……", "再见"}, Split("他说：“好的。”然后走了……再见"))
+	assert.Equal(t, []string{"第一段", "第二段"}, Split("第一段\n\n第二段\n"))
+	assert.Empty(t, Split("  "))
+}
+
+func TestSplitter_Write(t *testing.T) {
+	s := &Splitter{}
+	var got []string
+	for _, delta := range []string{"一加", "二等于三", "。", "还有", "问题吗", "？", "Pi is 3", ".", "14."} {
+		got = append(got, s.Write(delta)...)
+	}
+	// 句末标点在末尾时等待下一段文本
+	assert.Equal(t, []string{"一加二等于三。", "还有问题吗？"}, got)
+	assert.Equal(t, []string{"Pi is 3.14."}, s.Write(" OK"))
+	assert.Equal(t, []string{"OK"}, s.Flush())
+}
+
+func TestSplitter_Length(t *testing.T) {
+	s := &Splitter{MinLength: 5}
+	assert.Equal(t, []string{"好。嗯。你好吗？"}, s.Write("好。嗯。你好吗？我"))
+	assert.Equal(t, []string{"我"}, s.Flush())
+
+	s = &Splitter{MaxLength: 10}
+	assert.Equal(t, []string{"一二三四五六，", "七八九十一二三四五六"}, s.Write("一二三四五六，七八九十一二三四五六七八"))
+	assert.Equal(t, []string{"七八"}, s.Flush())
+}
@@ -0,0 +1,175 @@
+package sttws
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrProtocolNotSupported  = errors.New("server does not support " + ProtocolV1)
+	ErrMultiplexNotSupported = errors.New("server does not support " + ProtocolV2)
+)
+
+// Client squidward 流式语音识别客户端
+type Client struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+
+	// Version 服务端协议版本
+	Version int
+}
+
+// Dial 连接 /v1/audio/transcriptions/ws, url 使用 ws:// 或 wss://
+// protocols 为空时优先协商 v2
+func Dial(ctx context.Context, url string, header http.Header, protocols ...string) (*Client, error) {
+	if len(protocols) == 0 {
+		protocols = Protocols
+	}
+	dialer := websocket.Dialer{
+		HandshakeTimeout: 10 * time.Second,
+		Subprotocols:     protocols,
+	}
+
+	conn, _, err := dialer.DialContext(ctx, url, header)
+	if err != nil {
+		return nil, err
+	}
+	if ProtocolVersion(conn.Subprotocol()) == 0 {
+		_ = conn.Close()
+		return nil, ErrProtocolNotSupported
+	}
+
+	c := &Client{conn: conn}
+
+	_ = conn.SetReadDeadline(time.Now().Add(PongWait))
+	conn.SetPingHandler(func(data string) error {
+		_ = conn.SetReadDeadline(time.Now().Add(PongWait))
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(WriteWait))
+	})
+
+	msg, err := c.Recv()
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if msg.Type != TypeReady {
+		_ = conn.Close()
+		return nil, ErrProtocolNotSupported
+	}
+	c.Version = msg.Version
+
+	return c, nil
+}
+
+// Start 开始一段音频, 等待 started 消息前可以直接发送音频
+// v2 中可以同时开始多段音频, 需指定不同的 AudioID
+func (c *Client) Start(start ClientMessage) error {
+	start.Type = TypeStart
+	return c.writeJSON(start)
+}
+
+// SendAudio 发送当前音频数据, v2 中使用 SendSessionAudio
+func (c *Client) SendAudio(data []byte) error {
+	return c.writeBinary(data)
+}
+
+// SendSessionAudio 发送指定音频的数据, 仅 v2
+func (c *Client) SendSessionAudio(audioID string, data []byte) error {
+	if c.Version < 2 {
+		return ErrMultiplexNotSupported
+	}
+	return c.writeBinary(EncodeAudioFrame(audioID, data))
+}
+
+// Stop 结束当前音频, 服务端识别后返回 final 消息, v2 中使用 StopSession
+func (c *Client) Stop() error {
+	return c.writeJSON(ClientMessage{Type: TypeStop})
+}
+
+// StopSession 结束指定音频, 仅 v2
+func (c *Client) StopSession(audioID string) error {
+	if c.Version < 2 {
+		return ErrMultiplexNotSupported
+	}
+	return c.writeJSON(ClientMessage{Type: TypeStop, AudioID: audioID})
+}
+
+// Recv 读取下一条服务端消息, error 类型的消息以 *Error 返回
+func (c *Client) Recv() (*ServerMessage, error) {
+	msg := &ServerMessage{}
+	if err := c.conn.ReadJSON(msg); err != nil {
+		return nil, err
+	}
+	_ = c.conn.SetReadDeadline(time.Now().Add(PongWait))
+
+	if msg.Type == TypeError {
+		return msg, &Error{Code: msg.Code, Message: msg.Message}
+	}
+	return msg, nil
+}
+
+// Transcribe 识别一段完整音频, 返回最终结果
+// 期间收到的其他音频的消息将被丢弃, 同时识别多段音频时请直接使用 Recv
+func (c *Client) Transcribe(start ClientMessage, data []byte) (*ServerMessage, error) {
+	if c.Version >= 2 && start.AudioID == "" {
+		start.AudioID = strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	if err := c.Start(start); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if c.Version >= 2 {
+		if err = c.SendSessionAudio(start.AudioID, data); err == nil {
+			err = c.StopSession(start.AudioID)
+		}
+	} else {
+		if err = c.SendAudio(data); err == nil {
+			err = c.Stop()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		msg, errr := c.Recv()
+		if start.AudioID != "" && msg != nil && msg.AudioID != "" && msg.AudioID != start.AudioID {
+			continue
+		}
+		if errr != nil {
+			return msg, errr
+		}
+		if msg.Type == TypeFinal {
+			return msg, nil
+		}
+	}
+}
+
+// Close 正常关闭连接
+func (c *Client) Close() error {
+	c.mu.Lock()
+	_ = c.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(WriteWait))
+	c.mu.Unlock()
+	return c.conn.Close()
+}
+
+func (c *Client) writeBinary(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(WriteWait))
+	return c.conn.WriteMessage(websocket.BinaryMessage, data)
+}
+
+func (c *Client) writeJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(WriteWait))
+	return c.conn.WriteJSON(v)
+}
@@ -0,0 +1,137 @@
+package sttws
+
+import (
+	"errors"
+	"time"
+)
+
+// websocket 子协议名称, 客户端通过 Sec-WebSocket-Protocol 协商
+const (
+	// ProtocolV1 单连接单音频
+	ProtocolV1 = "squidward.stt.v1"
+	// ProtocolV2 单连接多路音频, 二进制帧携带音频id
+	ProtocolV2 = "squidward.stt.v2"
+)
+
+// Protocols 服务端支持的子协议, 按优先级排列
+var Protocols = []string{ProtocolV2, ProtocolV1}
+
+// ProtocolVersion 子协议对应的版本号, 不支持返回0
+func ProtocolVersion(protocol string) int {
+	switch protocol {
+	case ProtocolV1:
+		return 1
+	case ProtocolV2:
+		return 2
+	}
+	return 0
+}
+
+var ErrInvalidAudioFrame = errors.New("invalid audio frame")
+
+// EncodeAudioFrame v2 二进制帧: 1字节id长度 + id + 音频数据
+func EncodeAudioFrame(audioID string, data []byte) []byte {
+	frame := make([]byte, 0, 1+len(audioID)+len(data))
+	frame = append(frame, byte(len(audioID)))
+	frame = append(frame, audioID...)
+	return append(frame, data...)
+}
+
+// DecodeAudioFrame 解析 v2 二进制帧
+func DecodeAudioFrame(frame []byte) (string, []byte, error) {
+	if len(frame) < 1 {
+		return "", nil, ErrInvalidAudioFrame
+	}
+	n := int(frame[0])
+	if n == 0 || len(frame) < 1+n {
+		return "", nil, ErrInvalidAudioFrame
+	}
+	return string(frame[1 : 1+n]), frame[1+n:], nil
+}
+
+const (
+	// PingPeriod 服务端发送 ping 的间隔
+	PingPeriod = 20 * time.Second
+	// PongWait 读超时, 期间未收到任何消息或 pong 则断开
+	PongWait = 60 * time.Second
+	// WriteWait 写超时
+	WriteWait = 10 * time.Second
+)
+
+// 客户端控制消息类型
+const (
+	TypeStart = "start"
+	TypeStop  = "stop"
+)
+
+// 服务端消息类型
+const (
+	TypeReady   = "ready"
+	TypeStarted = "started"
+	TypePartial = "partial"
+	TypeFinal   = "final"
+	TypeError   = "error"
+)
+
+// 错误码
+const (
+	ErrCodeInvalidMessage      = "invalid_message"
+	ErrCodeUnsupportedMime     = "unsupported_mime"
+	ErrCodeNotStarted          = "not_started"
+	ErrCodeAlreadyStarted      = "already_started"
+	ErrCodeTranscriptionFailed = "transcription_failed"
+	ErrCodeInternal            = "internal_error"
+)
+
+// ClientMessage 客户端发送的 json 控制消息, 音频数据使用二进制帧发送
+type ClientMessage struct {
+	Type string `json:"type"`
+
+	// v2 中 start/stop 必填, 最长255字节
+	AudioID string `json:"audio_id,omitempty"`
+
+	// start 参数
+	Mime            string  `json:"mime,omitempty"`
+	Model           string  `json:"model,omitempty"`
+	Language        string  `json:"language,omitempty"`
+	Prompt          string  `json:"prompt,omitempty"`
+	Temperature     float32 `json:"temperature,omitempty"`
+	ResponseFormat  string  `json:"response_format,omitempty"`
+	VAD             bool    `json:"vad,omitempty"`
+	PartialInterval int     `json:"partial_interval,omitempty"` // 毫秒, 0 表示不推送中间结果
+}
+
+// Segment 带时间戳的识别片段, 单位秒
+type Segment struct {
+	ID    int     `json:"id"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// ServerMessage 服务端发送的 json 消息
+type ServerMessage struct {
+	Type    string `json:"type"`
+	Version int    `json:"version,omitempty"`
+	AudioID string `json:"audio_id,omitempty"`
+
+	// partial/final
+	Text     string    `json:"text,omitempty"`
+	Language string    `json:"language,omitempty"`
+	Duration float64   `json:"duration,omitempty"`
+	Segments []Segment `json:"segments,omitempty"`
+
+	// error
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Error 服务端返回的错误
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
@@ -0,0 +1,109 @@
+package subtitle
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxLineWidth = 42
+	defaultMaxLines     = 2
+)
+
+// Config 字幕生成配置
+type Config struct {
+	// Local 后端不支持 srt/vtt 时, 请求 verbose_json 后在本地生成字幕
+	Local bool `mapstructure:"local"`
+	// MaxLineWidth 每行最大显示宽度, 中日韩文字计 2, 默认 42
+	MaxLineWidth int `mapstructure:"max_line_width"`
+	// MaxLines 每条字幕最多行数, 超出时按字数比例拆分时间轴, 默认 2
+	MaxLines int `mapstructure:"max_lines"`
+}
+
+// Cue 一条字幕
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Lines []string
+}
+
+// Segment 带时间戳的识别片段, 时间单位为秒
+type Segment struct {
+	Start float64
+	End   float64
+	Text  string
+}
+
+// Cues 折行后生成字幕, 行数超出时拆为多条
+func Cues(segments []Segment, cfg Config) []Cue {
+	maxWidth := cfg.MaxLineWidth
+	if maxWidth <= 0 {
+		maxWidth = defaultMaxLineWidth
+	}
+	maxLines := cfg.MaxLines
+	if maxLines <= 0 {
+		maxLines = defaultMaxLines
+	}
+
+	var cues []Cue
+	for _, seg := range segments {
+		lines := Wrap(seg.Text, maxWidth)
+		if len(lines) == 0 {
+			continue
+		}
+
+		begin := seconds(seg.Start)
+		duration := seconds(seg.End) - begin
+		total := 0
+		for _, l := range lines {
+			total += Width(l)
+		}
+
+		start, done := begin, 0
+		for i := 0; i < len(lines); i += maxLines {
+			group := lines[i:min(i+maxLines, len(lines))]
+			for _, l := range group {
+				done += Width(l)
+			}
+			end := begin + duration*time.Duration(done)/time.Duration(total)
+			if i+maxLines >= len(lines) {
+				end = seconds(seg.End)
+			}
+			cues = append(cues, Cue{Start: start, End: end, Lines: group})
+			start = end
+		}
+	}
+	return cues
+}
+
+// SRT 渲染为 SubRip 格式
+func SRT(cues []Cue) string {
+	var b strings.Builder
+	for i, cue := range cues {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1,
+			timestamp(cue.Start, ","), timestamp(cue.End, ","), strings.Join(cue.Lines, "\n"))
+	}
+	return b.String()
+}
+
+// VTT 渲染为 WebVTT 格式
+func VTT(cues []Cue) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	for _, cue := range cues {
+		fmt.Fprintf(&b, "%s --> %s\n%s\n\n",
+			timestamp(cue.Start, "."), timestamp(cue.End, "."), strings.Join(cue.Lines, "\n"))
+	}
+	return b.String()
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond)
+}
+
+// timestamp 格式化为 hh:mm:ss,mmm, sep 为毫秒分隔符
+func timestamp(d time.Duration, sep string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
@@ -0,0 +1,49 @@
+package subtitle
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	assert.Equal(t, []string{"The quick brown fox", "jumps over the lazy", "dog."},
+		Wrap("The quick brown fox jumps over the lazy dog.", 20))
+
+	// 标点不出现在行首
+	assert.Equal(t, []string{"今天天气很好，", "我们去公园散步吧。"},
+		Wrap("今天天气很好，我们去公园散步吧。", 18))
+
+	// 优先在标点后断行
+	assert.Equal(t, []string{"欢迎收看今天的节目，", "主持人是小王"},
+		Wrap("欢迎收看今天的节目，主持人是小王", 24))
+
+	// 开括号不出现在行尾
+	assert.Equal(t, []string{"他说道", "《三体》", "很好看"},
+		Wrap("他说道《三体》很好看", 8))
+
+	// 中英混排
+	assert.Equal(t, []string{"我们使用 Go 语言", "开发 API 服务"},
+		Wrap("我们使用 Go 语言开发 API 服务", 16))
+
+	assert.Equal(t, []string{"abcdefgh", "ij"}, Wrap("abcdefghij", 8))
+	assert.Empty(t, Wrap("  ", 8))
+}
+
+func TestRender(t *testing.T) {
+	cues := Cues([]Segment{
+		{Start: 0, End: 2.5, Text: " 大家好，欢迎收看今天的节目。"},
+		{Start: 2.5, End: 6, Text: "今天我们来聊一聊人工智能在语音识别领域的最新进展，以及它如何改变我们的生活方式。"},
+	}, Config{MaxLineWidth: 30, MaxLines: 1})
+
+	assert.Equal(t, "1\n"+
+		"00:00:00,000 --> 00:00:02,500\n大家好，欢迎收看今天的节目。\n\n"+
+		"2\n"+
+		"00:00:02,500 --> 00:00:03,812\n今天我们来聊一聊人工智能在语音\n\n"+
+		"3\n"+
+		"00:00:03,812 --> 00:00:04,687\n识别领域的最新进展，\n\n"+
+		"4\n"+
+		"00:00:04,687 --> 00:00:06,000\n以及它如何改变我们的生活方式。\n\n", SRT(cues))
+
+	cues = Cues([]Segment{{Start: 3661.5, End: 3663, Text: "Hello world, this is a subtitle test."}}, Config{MaxLineWidth: 20})
+	assert.Equal(t, "WEBVTT\n\n01:01:01.500 --> 01:01:03.000\nHello world, this is\na subtitle test.\n\n", VTT(cues))
+}
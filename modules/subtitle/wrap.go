@@ -0,0 +1,150 @@
+package subtitle
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 不能出现在行首的标点
+const noLineStart = "，。、；：？！）》」』】〕〉”’…—,.;:?!)]}%"
+
+// 不能出现在行尾的标点
+const noLineEnd = "（《「『【〔〈“‘([{"
+
+// 优先在这些标点之后断行
+const breakAfter = "，。、；：？！,.;:?!"
+
+// isWide 中日韩文字与全角符号, 按两个字符宽度计算, 且可在任意字符间断行
+func isWide(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		r >= 0x3000 && r <= 0x303F || r >= 0xFF00 && r <= 0xFFEF || r == '“' || r == '”' || r == '‘' || r == '’' || r == '…' || r == '—'
+}
+
+// Width 显示宽度, 中日韩文字计 2
+func Width(text string) int {
+	w := 0
+	for _, r := range text {
+		if isWide(r) {
+			w += 2
+		} else {
+			w++
+		}
+	}
+	return w
+}
+
+// tokenize 中日韩字符各自成词, 西文按空格分词, 空格附在词尾
+func tokenize(text string) []string {
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			if word.Len() == 0 && len(tokens) > 0 {
+				// 连续空格只保留一个
+				if !strings.HasSuffix(tokens[len(tokens)-1], " ") {
+					tokens[len(tokens)-1] += " "
+				}
+				continue
+			}
+			word.WriteRune(' ')
+			flush()
+		case isWide(r):
+			flush()
+			tokens = append(tokens, string(r))
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// Wrap 按显示宽度折行, 中日韩文本可在字间断行, 西文在空格处断行
+// 避免标点出现在行首、开括号出现在行尾, 并尽量在标点后断行
+func Wrap(text string, maxWidth int) []string {
+	text = strings.TrimSpace(text)
+	if maxWidth <= 0 || Width(text) <= maxWidth {
+		if text == "" {
+			return nil
+		}
+		return []string{text}
+	}
+
+	var lines []string
+	var line []string
+	width := 0
+	emit := func(tokens []string) {
+		if s := strings.TrimSpace(strings.Join(tokens, "")); s != "" {
+			lines = append(lines, s)
+		}
+	}
+
+	for _, token := range tokenize(text) {
+		tw := Width(strings.TrimRight(token, " "))
+		if width+tw <= maxWidth || len(line) == 0 || strings.ContainsAny(firstRune(token), noLineStart) {
+			line = append(line, token)
+			width += Width(token)
+			continue
+		}
+
+		// 回溯到最近的标点或行尾禁则之前断行, 不超过行长的三分之一
+		cut := len(line)
+		for i := len(line) - 1; i > 0 && widthOf(line[i:]) <= maxWidth/3; i-- {
+			if strings.ContainsAny(lastRune(line[i-1]), breakAfter) {
+				cut = i
+				break
+			}
+		}
+		for cut > 1 && strings.ContainsAny(lastRune(line[cut-1]), noLineEnd) {
+			cut--
+		}
+
+		emit(line[:cut])
+		line = append(append([]string(nil), line[cut:]...), token)
+		width = widthOf(line)
+	}
+	emit(line)
+
+	// 超长单词强制截断
+	var out []string
+	for _, l := range lines {
+		for Width(l) > maxWidth && !strings.ContainsFunc(l, isWide) && !strings.Contains(l, " ") {
+			runes := []rune(l)
+			out = append(out, string(runes[:maxWidth]))
+			l = string(runes[maxWidth:])
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+func widthOf(tokens []string) int {
+	w := 0
+	for _, t := range tokens {
+		w += Width(t)
+	}
+	return w
+}
+
+func firstRune(s string) string {
+	for _, r := range s {
+		return string(r)
+	}
+	return ""
+}
+
+func lastRune(s string) string {
+	s = strings.TrimRight(s, " ")
+	runes := []rune(s)
+	if len(runes) == 0 {
+		return ""
+	}
+	return string(runes[len(runes)-1])
+}
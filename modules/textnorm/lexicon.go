@@ -0,0 +1,92 @@
+package textnorm
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Lexicon 用户发音词典, 匹配的词语替换为指定读法且不再经过内置规则
+type Lexicon struct {
+	words map[string]string
+	re    *regexp.Regexp
+}
+
+// LoadLexicon 读取词典文件, 每行 "词语<Tab或=>读法", # 开头为注释
+func LoadLexicon(path string) (*Lexicon, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	words := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		word, reading, found := strings.Cut(line, "\t")
+		if !found {
+			word, reading, found = strings.Cut(line, "=")
+		}
+		if !found || strings.TrimSpace(word) == "" {
+			continue
+		}
+		words[strings.TrimSpace(word)] = strings.TrimSpace(reading)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewLexicon(words), nil
+}
+
+func NewLexicon(words map[string]string) *Lexicon {
+	l := &Lexicon{words: words}
+	if len(words) == 0 {
+		return l
+	}
+
+	// 长词优先
+	keys := make([]string, 0, len(words))
+	for word := range words {
+		keys = append(keys, regexp.QuoteMeta(word))
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	l.re = regexp.MustCompile(strings.Join(keys, "|"))
+	return l
+}
+
+// apply 将词语替换为占位符, 规则处理完成后再还原为读法
+func (l *Lexicon) apply(text string) (string, []string) {
+	if l.re == nil {
+		return text, nil
+	}
+	var readings []string
+	text = l.re.ReplaceAllStringFunc(text, func(word string) string {
+		readings = append(readings, l.words[word])
+		return string(rune(placeholderBase + len(readings) - 1))
+	})
+	return text, readings
+}
+
+// 占位符使用私用区字符, 不会被规则匹配
+const placeholderBase = 0xF0000
+
+func restoreProtected(text string, readings []string) string {
+	if len(readings) == 0 {
+		return text
+	}
+	var b strings.Builder
+	for _, r := range text {
+		if i := int(r) - placeholderBase; i >= 0 && i < len(readings) {
+			b.WriteString(readings[i])
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
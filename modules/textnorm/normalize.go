@@ -0,0 +1,189 @@
+package textnorm
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Config TTS 中文文本规整配置
+type Config struct {
+	// Lexicon 用户发音词典文件, 每行 "词语<Tab或=>读法", # 开头为注释
+	Lexicon string `mapstructure:"lexicon"`
+	// SpellAcronyms 将连续大写字母拆开逐个朗读, 如 "API" 读作 "A P I"
+	SpellAcronyms bool `mapstructure:"spell_acronyms"`
+}
+
+// Normalizer 将数字、日期、货币、电话号码、单位等转换为中文读法
+type Normalizer struct {
+	cfg     Config
+	lexicon *Lexicon
+}
+
+func New(cfg Config) (*Normalizer, error) {
+	n := &Normalizer{cfg: cfg}
+	if cfg.Lexicon != "" {
+		lexicon, err := LoadLexicon(cfg.Lexicon)
+		if err != nil {
+			return nil, err
+		}
+		n.lexicon = lexicon
+	}
+	return n, nil
+}
+
+type rule struct {
+	re      *regexp.Regexp
+	replace func(m []string) string
+}
+
+const number = `\d+(?:\.\d+)?`
+
+var (
+	thousandsRe = regexp.MustCompile(`\d{1,3}(?:,\d{3})+`)
+	numberRe    = regexp.MustCompile(`-?` + number)
+	acronymRe   = regexp.MustCompile(`\b[A-Z]{2,}\b`)
+)
+
+var currencies = map[string]string{
+	"¥": "元", "￥": "元", "$": "美元", "€": "欧元", "£": "英镑",
+}
+
+// units 按长度降序匹配
+var units = []struct{ symbol, name string }{
+	{"km/h", "千米每小时"}, {"m/s", "米每秒"},
+	{"km²", "平方千米"}, {"m²", "平方米"}, {"m³", "立方米"}, {"cm²", "平方厘米"},
+	{"°C", "摄氏度"}, {"℃", "摄氏度"}, {"°F", "华氏度"},
+	{"km", "千米"}, {"cm", "厘米"}, {"mm", "毫米"}, {"kg", "千克"}, {"mg", "毫克"},
+	{"ml", "毫升"}, {"mL", "毫升"}, {"kW", "千瓦"}, {"kHz", "千赫兹"}, {"Hz", "赫兹"},
+	{"TB", "T B"}, {"GB", "G B"}, {"MB", "M B"}, {"KB", "K B"},
+	{"m", "米"}, {"g", "克"}, {"L", "升"}, {"h", "小时"}, {"s", "秒"},
+}
+
+var unitNames = map[string]string{}
+
+var rules []rule
+
+func init() {
+	var symbols []string
+	for _, u := range units {
+		symbols = append(symbols, regexp.QuoteMeta(u.symbol))
+		unitNames[u.symbol] = u.name
+	}
+
+	rules = []rule{
+		// 2024年10月17日 / 2024-10-17 / 2024/10/17
+		{regexp.MustCompile(`(\d{4})年(\d{1,2})月(\d{1,2})([日号])`), func(m []string) string {
+			return Digits(m[1], false) + "年" + Integer(m[2]) + "月" + Integer(m[3]) + m[4]
+		}},
+		{regexp.MustCompile(`\b(\d{4})[-/.](\d{1,2})[-/.](\d{1,2})\b`), func(m []string) string {
+			return Digits(m[1], false) + "年" + Integer(m[2]) + "月" + Integer(m[3]) + "日"
+		}},
+		{regexp.MustCompile(`(\d{4})年`), func(m []string) string {
+			return Digits(m[1], false) + "年"
+		}},
+		{regexp.MustCompile(`(\d{1,2})月(\d{1,2})([日号])`), func(m []string) string {
+			return Integer(m[1]) + "月" + Integer(m[2]) + m[3]
+		}},
+		// 时间 10:30 / 08:05:09
+		{regexp.MustCompile(`\b(\d{1,2}):(\d{2})(?::(\d{2}))?\b`), func(m []string) string {
+			text := Integer(m[1]) + "点"
+			switch {
+			case m[2] == "00" && m[3] == "":
+				return text + "整"
+			case m[2][0] == '0' && m[2] != "00":
+				text += "零" + Integer(m[2]) + "分"
+			default:
+				text += Integer(m[2]) + "分"
+			}
+			if m[3] != "" {
+				text += Integer(m[3]) + "秒"
+			}
+			return text
+		}},
+		// 手机、座机与 400 电话, 逐位读且 1 读作 幺
+		{regexp.MustCompile(`\b(?:\+?86[- ]?)?1[3-9]\d[- ]?\d{4}[- ]?\d{4}\b|\b0\d{2,3}-\d{7,8}\b|\b[48]00-?\d{3}-?\d{4}\b`), func(m []string) string {
+			return Digits(strings.TrimPrefix(m[0], "+"), true)
+		}},
+		// 货币
+		{regexp.MustCompile(`([¥￥$€£])\s?(-?` + number + `)`), func(m []string) string {
+			return Decimal(m[2]) + currencies[m[1]]
+		}},
+		// 百分比
+		{regexp.MustCompile(`(-?` + number + `)%`), func(m []string) string {
+			return "百分之" + Decimal(m[1])
+		}},
+		// 分数
+		{regexp.MustCompile(`\b(\d+)/(\d+)\b`), func(m []string) string {
+			return Integer(m[2]) + "分之" + Integer(m[1])
+		}},
+		// 范围 3~5 / 3-5, 连字符前后不能是字母数字, 避免误读 "A3-5" 一类编号
+		{regexp.MustCompile(`(` + number + `)\s?[~～]\s?(` + number + `)|\b(` + number + `)-(` + number + `)\b`), func(m []string) string {
+			if m[1] == "" {
+				return Decimal(m[3]) + "到" + Decimal(m[4])
+			}
+			return Decimal(m[1]) + "到" + Decimal(m[2])
+		}},
+		// 单位, 需紧跟数字且后面不是字母
+		{regexp.MustCompile(`(-?` + number + `)\s?(` + strings.Join(symbols, "|") + `)([^A-Za-z]|$)`), func(m []string) string {
+			return Decimal(m[1]) + unitNames[m[2]] + m[3]
+		}},
+	}
+}
+
+// Normalize 规整文本, 词典优先于内置规则
+func (n *Normalizer) Normalize(text string) string {
+	var protected []string
+	if n.lexicon != nil {
+		text, protected = n.lexicon.apply(text)
+	}
+
+	text = thousandsRe.ReplaceAllStringFunc(text, func(s string) string {
+		return strings.ReplaceAll(s, ",", "")
+	})
+	for _, r := range rules {
+		text = r.re.ReplaceAllStringFunc(text, func(s string) string {
+			return r.replace(r.re.FindStringSubmatch(s))
+		})
+	}
+	text = replaceNumbers(text)
+
+	if n.cfg.SpellAcronyms {
+		text = acronymRe.ReplaceAllStringFunc(text, func(s string) string {
+			return strings.Join(strings.Split(s, ""), " ")
+		})
+	}
+
+	return restoreProtected(text, protected)
+}
+
+// replaceNumbers 其余数字: 0 开头或超长的按位读, 其他按数值读
+// 负号仅在前面不是字母数字时生效, 避免误读 "A-1" 一类编号
+func replaceNumbers(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range numberRe.FindAllStringIndex(text, -1) {
+		start, end := loc[0], loc[1]
+		s := text[start:end]
+		if s[0] == '-' {
+			prev, _ := utf8.DecodeLastRuneInString(text[:start])
+			if start > 0 && (prev < utf8.RuneSelf && (unicode.IsLetter(prev) || unicode.IsDigit(prev))) {
+				b.WriteString(text[last : start+1])
+				start++
+				s = s[1:]
+				last = start
+			}
+		}
+		b.WriteString(text[last:start])
+		intPart, _, _ := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+		if len(intPart) > 1 && intPart[0] == '0' || len(intPart) > 12 {
+			b.WriteString(Digits(s, false))
+		} else {
+			b.WriteString(Decimal(s))
+		}
+		last = end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
@@ -0,0 +1,72 @@
+package textnorm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInteger(t *testing.T) {
+	for s, want := range map[string]string{
+		"0":         "零",
+		"10":        "十",
+		"15":        "十五",
+		"101":       "一百零一",
+		"1005":      "一千零五",
+		"1010":      "一千零一十",
+		"10000":     "一万",
+		"100010":    "十万零一十",
+		"20300":     "二万零三百",
+		"100000001": "一亿零一",
+		"123456789": "一亿二千三百四十五万六千七百八十九",
+	} {
+		assert.Equal(t, want, Integer(s), s)
+	}
+	assert.Equal(t, "负三十五点五", Decimal("-35.5"))
+	assert.Equal(t, "幺三八", Digits("138", true))
+}
+
+func TestNormalizer_Normalize(t *testing.T) {
+	n, err := New(Config{})
+	assert.Empty(t, err)
+
+	for text, want := range map[string]string{
+		"2024年10月17日":        "二零二四年十月十七日",
+		"2024-10-17 发布":      "二零二四年十月十七日 发布",
+		"成立于1998年":           "成立于一九九八年",
+		"¥35.5":              "三十五点五元",
+		"共计$1,200":           "共计一千二百美元",
+		"请拨打13812345678":     "请拨打幺三八幺二三四五六七八",
+		"客服电话010-12345678":   "客服电话零幺零幺二三四五六七八",
+		"增长了12.5%":           "增长了百分之十二点五",
+		"会议10:30开始, 12:00结束": "会议十点三十分开始, 十二点整结束",
+		"全程42.195km":         "全程四十二点一九五千米",
+		"气温-5℃":              "气温负五摄氏度",
+		"约3/4的人":             "约四分之三的人",
+		"编号007":              "编号零零七",
+		"A-1 号":              "A-一 号",
+		"3~5天":               "三到五天",
+		"3-5天":               "三到五天",
+		"每次1.5-2小时":          "每次一点五到二小时",
+		"型号A3-5":             "型号A三-五",
+		"版本 2.0":             "版本 二点零",
+	} {
+		assert.Equal(t, want, n.Normalize(text), text)
+	}
+
+	n, _ = New(Config{SpellAcronyms: true})
+	assert.Equal(t, "调用 A P I", n.Normalize("调用 API"))
+}
+
+func TestLexicon(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lexicon.txt")
+	assert.Empty(t, os.WriteFile(path, []byte("# 词典\n重庆=虫庆\n12306\t幺二三零六\nNASA=纳萨\n"), 0o644))
+
+	n, err := New(Config{Lexicon: path, SpellAcronyms: true})
+	assert.Empty(t, err)
+	assert.Equal(t, "虫庆的 纳萨 与 幺二三零六, 共二人", n.Normalize("重庆的 NASA 与 12306, 共2人"))
+
+	_, err = New(Config{Lexicon: filepath.Join(t.TempDir(), "none.txt")})
+	assert.Error(t, err)
+}
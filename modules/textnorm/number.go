@@ -0,0 +1,101 @@
+package textnorm
+
+import "strings"
+
+var digitNames = []string{"零", "一", "二", "三", "四", "五", "六", "七", "八", "九"}
+
+var smallUnits = []string{"", "十", "百", "千"}
+
+var bigUnits = []string{"", "万", "亿", "万亿"}
+
+// Digits 逐位读数字, 如年份与编号, yao 为 true 时 1 读作 "幺"(电话号码)
+func Digits(s string, yao bool) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '1' && yao:
+			b.WriteString("幺")
+		case r >= '0' && r <= '9':
+			b.WriteString(digitNames[r-'0'])
+		}
+	}
+	return b.String()
+}
+
+// Integer 按数值读整数, 如 10 读作 "十", 1005 读作 "一千零五"
+// 超过万亿的数字逐位读
+func Integer(s string) string {
+	s = strings.TrimLeft(s, "0")
+	if s == "" {
+		return digitNames[0]
+	}
+	if len(s) > 16 {
+		return Digits(s, false)
+	}
+
+	// 从低位起每四位一组
+	var groups []string
+	for end := len(s); end > 0; end -= 4 {
+		groups = append(groups, s[max(end-4, 0):end])
+	}
+
+	var b strings.Builder
+	zero := false
+	for i := len(groups) - 1; i >= 0; i-- {
+		group := groups[i]
+		if strings.Trim(group, "0") == "" {
+			zero = true
+			continue
+		}
+		if b.Len() > 0 && (zero || len(group) < 4 || group[0] == '0') {
+			b.WriteString(digitNames[0])
+		}
+		b.WriteString(readGroup(group))
+		b.WriteString(bigUnits[i])
+		zero = false
+	}
+
+	text := b.String()
+	// 一十 开头读作 十
+	if strings.HasPrefix(text, "一十") {
+		text = strings.TrimPrefix(text, "一")
+	}
+	return text
+}
+
+// readGroup 读不超过四位的数字, 组内的零只读一次
+func readGroup(group string) string {
+	group = strings.TrimLeft(group, "0")
+	var b strings.Builder
+	zero := false
+	for i, r := range group {
+		d := int(r - '0')
+		unit := len(group) - 1 - i
+		if d == 0 {
+			zero = true
+			continue
+		}
+		if zero {
+			b.WriteString(digitNames[0])
+			zero = false
+		}
+		b.WriteString(digitNames[d])
+		b.WriteString(smallUnits[unit])
+	}
+	return b.String()
+}
+
+// Decimal 读小数, 如 35.5 读作 "三十五点五", 可带负号
+func Decimal(s string) string {
+	prefix := ""
+	if strings.HasPrefix(s, "-") {
+		prefix = "负"
+		s = s[1:]
+	}
+	intPart, fracPart, found := strings.Cut(s, ".")
+	text := prefix + Integer(intPart)
+	if found && fracPart != "" {
+		text += "点" + Digits(fracPart, false)
+	}
+	return text
+}